@@ -8,8 +8,12 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/rx3lixir/laba_zis/internal/auth"
 	"github.com/rx3lixir/laba_zis/internal/config"
+	"github.com/rx3lixir/laba_zis/internal/device"
+	"github.com/rx3lixir/laba_zis/internal/metrics"
 	"github.com/rx3lixir/laba_zis/internal/room"
 	"github.com/rx3lixir/laba_zis/internal/server"
 	"github.com/rx3lixir/laba_zis/internal/storage/postgres"
@@ -18,6 +22,9 @@ import (
 	"github.com/rx3lixir/laba_zis/internal/voice"
 	"github.com/rx3lixir/laba_zis/internal/websocket"
 	"github.com/rx3lixir/laba_zis/pkg/logger"
+	"github.com/rx3lixir/laba_zis/pkg/mail"
+	"github.com/rx3lixir/laba_zis/pkg/push"
+	"github.com/rx3lixir/laba_zis/pkg/ratelimit"
 )
 
 func main() {
@@ -48,6 +55,15 @@ func main() {
 		"database", c.MainDBParams.Name,
 	)
 
+	// Validate config file edits as they happen. Nothing reads the reloaded
+	// config yet, so every change takes effect after a restart
+	cm.Watch(func(next *config.Config) {
+		log.Warn("configuration file changed, restart to apply it",
+			"connection_settings_changed", next.RestartRequired(c))
+	}, func(err error) {
+		log.Error("configuration reload rejected", "error", err)
+	})
+
 	// Initializing Postgres connections pool
 	pool, err := postgres.NewPool(context.Background(), c.MainDBParams.GetDSN())
 	if err != nil {
@@ -65,9 +81,29 @@ func main() {
 		"db", c.MainDBParams.GetDSN(),
 	)
 
+	// `laba_zis migrate [up|down|status]` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(context.Background(), pool, os.Args[2:], log)
+		pool.Close()
+		if err != nil {
+			log.Error("migration command failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if c.MainDBParams.AutoMigrate {
+		applied, err := postgres.Migrate(context.Background(), pool)
+		if err != nil {
+			log.Error("failed to apply migrations", "error", err)
+			os.Exit(1)
+		}
+		log.Info("database schema up to date", "applied", applied)
+	}
+
 	// Creating S3 storage
 	minioClient, err := s3.NewClient(
-		c.S3Params.Endpoint,
+		c.S3Params.Host(),
 		c.S3Params.AccessKeyID,
 		c.S3Params.SecretAccessKey,
 		c.S3Params.UseSSL,
@@ -92,39 +128,240 @@ func main() {
 	voiceMessageFileStore := voice.NewMinIOVoiceStore(minioClient, c.S3Params.BucketName)
 
 	// Create auth service
-	authService := auth.NewService(
+	signer, err := auth.LoadSigner(
+		c.GeneralParams.SigningAlgorithm,
 		c.GeneralParams.SecretKey,
+		c.GeneralParams.PrivateKeyPath,
+	)
+	if err != nil {
+		log.Error("failed to load token signing key", "error", err)
+		os.Exit(1)
+	}
+
+	authService := auth.NewService(
+		signer,
 		time.Duration(c.GeneralParams.AccessTokenTTL)*time.Minute,
 		time.Duration(c.GeneralParams.RefreshTokenTTL)*24*time.Hour,
+		auth.NewPostgresStore(pool),
 	)
 
 	// Creating websocket manager
-	wsManager := websocket.NewConnectionManager(log)
+	wsOptions := websocket.Options{
+		DropAlertThreshold:    c.WebsocketParams.DropAlertThreshold,
+		DropAlertWindow:       time.Duration(c.WebsocketParams.DropAlertWindow) * time.Second,
+		OnDropAlert:           websocket.NewLogDropAlert(log),
+		AllowedOrigins:        c.HttpServerParams.CORSOrigins,
+		AllowAnyOrigin:        c.GeneralParams.Env == "dev",
+		MaxClientsPerRoom:     c.WebsocketParams.MaxClientsPerRoom,
+		MaxConnectionsPerUser: c.WebsocketParams.MaxConnectionsPerUser,
+		RecordReadReceipt:     voiceMessageDBStore.MarkRead,
+		MarkRoomRead: func(ctx context.Context, userID, roomID uuid.UUID) (time.Time, int, error) {
+			return voiceMessageDBStore.MarkRoomRead(ctx, userID, roomID, nil)
+		},
+		EnableCompression: c.WebsocketParams.CompressionEnabled,
+		OnUserOffline: func(userID uuid.UUID, at time.Time) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := userStore.UpdateLastSeen(ctx, userID, at); err != nil {
+				log.Warn("failed to record last seen", "user_id", userID, "error", err)
+			}
+		},
+	}
+	if c.WebsocketParams.DropAlertWebhookURL != "" {
+		wsOptions.OnDropAlert = websocket.NewWebhookDropAlert(c.WebsocketParams.DropAlertWebhookURL, log)
+	}
+
+	// Relaying room broadcasts between instances, single-node without redis
+	if c.RedisParams.Addr != "" {
+		redisClient := redis.NewClient(&redis.Options{
+			Addr:     c.RedisParams.Addr,
+			Password: c.RedisParams.Password,
+			DB:       c.RedisParams.DB,
+		})
+		defer redisClient.Close()
+
+		wsOptions.Broker = websocket.NewRedisBroker(redisClient, c.RedisParams.ChannelPrefix)
+		log.Info("websocket broadcasts relayed through redis", "addr", c.RedisParams.Addr)
+	}
+
+	wsManager := websocket.NewConnectionManager(log, wsOptions)
+	wsManager.StartJanitor(0)
+	if c.HttpServerParams.MetricsEnabled {
+		metrics.RegisterWebsocket(wsManager)
+	}
 
 	// Converting database timeout from config to actual time
 	dbTimeout := time.Duration(c.MainDBParams.Timeout) * time.Second
 
+	voiceConfig := voice.Config{
+		EnabledFormats:       c.VoiceParams.EnabledFormats,
+		MaxUploadBytes:       c.VoiceParams.MaxUploadBytes,
+		MaxDurationSeconds:   c.VoiceParams.MaxDurationSeconds,
+		URLExpiry:            time.Duration(c.VoiceParams.URLExpiry) * time.Second,
+		RequireVerifiedEmail: c.GeneralParams.RequireVerifiedEmail,
+		Limits: voice.Limits{
+			MaxSampleRate:  c.VoiceParams.MaxSampleRate,
+			MaxChannels:    c.VoiceParams.MaxChannels,
+			MaxBitrateKbps: c.VoiceParams.MaxBitrateKbps,
+		},
+		DeleteGracePeriod: time.Duration(c.VoiceParams.DeleteGracePeriod) * time.Hour,
+	}
+
+	// Optional Ogg/Opus transcoding, uploads are stored as received without ffmpeg
+	if c.VoiceParams.TranscodeEnabled {
+		transcoder, err := voice.NewFFmpegTranscoder(
+			c.VoiceParams.FFmpegPath,
+			time.Duration(c.VoiceParams.TranscodeTimeout)*time.Second,
+		)
+		if err != nil {
+			log.Warn("transcoding disabled", "error", err)
+		} else {
+			voiceConfig.Transcoder = transcoder
+		}
+	}
+
+	// Optional speech-to-text, transcripts are searched with postgres full-text search
+	if c.VoiceParams.STTURL != "" {
+		voiceConfig.Transcriber = voice.NewHTTPTranscriber(
+			c.VoiceParams.STTURL,
+			c.VoiceParams.STTAPIKey,
+			time.Duration(c.VoiceParams.STTTimeout)*time.Second,
+		)
+	}
+
 	// Create Handlers
-	roomHandler := room.NewHandler(roomStore, log, dbTimeout)
-	userHandler := user.NewHandler(userStore, authService, log, dbTimeout)
+	roomHandler := room.NewHandler(roomStore, wsManager, log, dbTimeout, room.Config{
+		MaxParticipants:      c.RoomParams.MaxParticipants,
+		RequireVerifiedEmail: c.GeneralParams.RequireVerifiedEmail,
+	})
+
+	loginLimiter := user.NewLoginLimiter(
+		c.LoginParams.MaxAttempts,
+		time.Duration(c.LoginParams.Window)*time.Second,
+		time.Duration(c.LoginParams.Lockout)*time.Second,
+	)
+
+	// Emails are only logged unless an SMTP server is configured
+	var mailer mail.Mailer = mail.NewLogMailer(log)
+	if c.MailParams.SMTPHost != "" {
+		mailer = mail.NewSMTPMailer(
+			c.MailParams.SMTPHost,
+			c.MailParams.SMTPPort,
+			c.MailParams.Username,
+			c.MailParams.Password,
+			c.MailParams.From,
+		)
+	}
+
+	deviceStore := device.NewPostgresStore(pool)
+	deviceHandler := device.NewHandler(deviceStore, log, dbTimeout)
+
+	// Push notifications are only logged unless a provider is configured
+	var notifier push.Notifier = push.NewNopNotifier(log)
+	if c.PushParams.Endpoint != "" {
+		notifier = push.NewHTTPNotifier(c.PushParams.Endpoint, c.PushParams.APIKey)
+	}
+	pushService := device.NewPushService(deviceStore, notifier, log)
+
 	wsHandler := websocket.NewHandler(wsManager, authService, roomStore, dbTimeout, log)
 	voiceHandler := voice.NewHandler(
 		voiceMessageDBStore,
 		voiceMessageFileStore,
+		voiceMessageDBStore,
+		voiceMessageDBStore,
+		voiceMessageDBStore,
+		voiceMessageDBStore,
+		voiceMessageDBStore,
 		roomStore,
 		wsManager,
+		pushService,
 		log,
 		dbTimeout,
+		voiceConfig,
 	)
+	userHandler := user.NewHandler(
+		userStore,
+		authService,
+		loginLimiter,
+		mailer,
+		wsManager,
+		voiceHandler,
+		user.Config{
+			ResetPasswordURL: c.MailParams.ResetPasswordURL,
+			VerifyEmailURL:   c.MailParams.VerifyEmailURL,
+			AdminUserIDs:     c.GeneralParams.AdminIDs(),
+		},
+		log,
+		dbTimeout,
+	)
+
+	// Background sweeper for S3 objects whose deletion failed or was deferred
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+
+	sweeper := voice.NewSweeper(voiceMessageDBStore, voiceMessageFileStore, log, 0)
+	go sweeper.Run(sweeperCtx)
+
+	// Optional scheduled removal of S3 objects no message references
+	reconciler := voice.NewReconciler(voiceMessageDBStore, voiceMessageFileStore, log, voice.ReconcilerOptions{
+		Interval:     time.Duration(c.VoiceParams.ReconcileInterval) * time.Minute,
+		DryRun:       c.VoiceParams.ReconcileDryRun,
+		CheckMissing: true,
+	})
+	go reconciler.Run(sweeperCtx)
+
+	// Retries transcriptions that failed or hit an open breaker
+	go voiceHandler.RunEnrichmentRetries(sweeperCtx, 0)
+
+	// In-memory rate limiters, per IP for auth routes and per user elsewhere
+	var authLimiter, userLimiter ratelimit.Limiter
+	if c.RateLimitParams.Enabled {
+		authLimiter = ratelimit.NewMemoryLimiter(ratelimit.Rate{
+			PerSecond: float64(c.RateLimitParams.AuthPerMinute) / 60,
+			Burst:     c.RateLimitParams.AuthBurst,
+		})
+		userLimiter = ratelimit.NewMemoryLimiter(ratelimit.Rate{
+			PerSecond: c.RateLimitParams.UserPerSecond,
+			Burst:     c.RateLimitParams.UserBurst,
+		})
+	}
+
+	// ffmpeg runs on the upload's request context, so uploads get the transcode
+	// timeout on top of the usual deadline instead of being cut off by it
+	requestTimeout := time.Duration(c.HttpServerParams.RequestTimeout) * time.Second
+	uploadTimeout := requestTimeout
+	if voiceConfig.Transcoder != nil {
+		uploadTimeout += time.Duration(c.VoiceParams.TranscodeTimeout) * time.Second
+	}
 
 	// Setup router
 	router := server.NewRouter(server.RouterConfig{
-		UserHandler:  userHandler,
-		RoomHandler:  roomHandler,
-		VoiceHandler: voiceHandler,
-		AuthService:  authService,
-		WsHandler:    wsHandler,
-		Log:          log,
+		UserHandler:    userHandler,
+		RoomHandler:    roomHandler,
+		VoiceHandler:   voiceHandler,
+		DeviceHandler:  deviceHandler,
+		AuthService:    authService,
+		WsHandler:      wsHandler,
+		Log:            log,
+		CORSOrigins:    c.HttpServerParams.CORSOrigins,
+		CORSMethods:    c.HttpServerParams.CORSMethods,
+		CORSHeaders:    c.HttpServerParams.CORSHeaders,
+		MetricsEnabled: c.HttpServerParams.MetricsEnabled,
+		AuthRateLimit:  authLimiter,
+		UserRateLimit:  userLimiter,
+		RequestTimeout: requestTimeout,
+		UploadTimeout:  uploadTimeout,
+		AdminUserIDs:   c.GeneralParams.AdminIDs(),
+		DB:             pool,
+		S3:             minioClient,
+		BucketName:     c.S3Params.BucketName,
+		ClientConfig: server.ClientConfig{
+			AudioFormats:         voiceConfig.Formats(),
+			AudioLimits:          voiceConfig.Limits,
+			MaxUploadBytes:       voiceConfig.MaxUploadBytes,
+			MaxDurationSeconds:   voiceConfig.MaxDurationSeconds,
+			RequireVerifiedEmail: c.GeneralParams.RequireVerifiedEmail,
+		},
 	})
 
 	// Create server with all passed parameters
@@ -152,19 +389,24 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		// Shutdown websocket connections first
-		log.Info("shutting down websocket conections...")
-		wsManager.Shutdown()
-		log.Info("websocket connections closed")
+		stopSweeper()
 
-		// Shutdown HTTP server
+		// Shutdown HTTP server first, so broadcasts from in-flight requests
+		// still reach websocket clients. Hijacked websocket connections
+		// aren't tracked by it
 		log.Info("shutting down http server...")
 
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Error("graceful shutdown failed", "error", err)
+			wsManager.Shutdown(ctx)
 			os.Exit(1)
 		}
 
+		// Then tell websocket clients we're restarting and close them
+		log.Info("shutting down websocket conections...")
+		wsManager.Shutdown(ctx)
+		log.Info("websocket connections closed")
+
 		log.Info("server stopped gracefully")
 	}
 }
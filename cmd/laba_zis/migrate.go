@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rx3lixir/laba_zis/internal/storage/postgres"
+)
+
+const migrateUsage = "usage: laba_zis migrate [up|down|status]"
+
+// runMigrate handles `laba_zis migrate <command>` against the embedded migrations
+func runMigrate(ctx context.Context, pool *pgxpool.Pool, args []string, log *slog.Logger) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := postgres.Migrate(ctx, pool)
+		if err != nil {
+			return err
+		}
+		log.Info("migrations applied", "count", applied)
+
+	case "down":
+		reverted, err := postgres.Rollback(ctx, pool)
+		if err != nil {
+			return err
+		}
+		log.Info("migration rolled back",
+			"version", reverted.Version,
+			"name", reverted.Name)
+
+	case "status":
+		states, err := postgres.MigrationStatus(ctx, pool)
+		if err != nil {
+			return err
+		}
+		for _, st := range states {
+			applied := "pending"
+			if st.Applied {
+				applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", applied, st.Name)
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %q. %s", command, migrateUsage)
+	}
+
+	return nil
+}
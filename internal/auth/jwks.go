@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+)
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public signing keys, or false when tokens are signed
+// with a shared secret and there is nothing to publish
+func (s *Service) JWKS() (*JWKS, bool) {
+	jwk, ok := publicJWK(s.signer.verifyKey, s.signer.Algorithm())
+	if !ok {
+		return nil, false
+	}
+	return &JWKS{Keys: []JWK{jwk}}, true
+}
+
+// publicJWK encodes an RSA or ECDSA public key with its RFC 7638 thumbprint as kid
+func publicJWK(key any, alg string) (JWK, bool) {
+	enc := base64.RawURLEncoding
+
+	var jwk JWK
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{
+			Kty: "RSA",
+			N:   enc.EncodeToString(k.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk = JWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   enc.EncodeToString(k.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(k.Y.FillBytes(make([]byte, size))),
+		}
+	default:
+		return JWK{}, false
+	}
+
+	jwk.Kid = thumbprint(jwk)
+	jwk.Use = "sig"
+	jwk.Alg = alg
+
+	return jwk, true
+}
+
+// thumbprint hashes the required members in lexicographic order (RFC 7638)
+func thumbprint(jwk JWK) string {
+	var members any
+	if jwk.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	}
+
+	// Marshalling a struct of strings can't fail
+	b, _ := json.Marshal(members)
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
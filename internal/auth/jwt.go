@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -8,36 +9,44 @@ import (
 	"github.com/google/uuid"
 )
 
+// Roles carried in access tokens
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type Claims struct {
 	UserID   uuid.UUID `json:"user_id"`
 	Email    string    `json:"email"`
 	Username string    `json:"username"`
+	// Role is empty in tokens issued before roles existed, which count as RoleUser
+	Role string `json:"role,omitempty"`
+	// EmailVerified is the account's verification state when the token was issued
+	EmailVerified bool `json:"email_verified,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type Service struct {
-	secretKey            []byte
+	signer               *Signer
 	accessTokenDuration  time.Duration
 	refreshTokenDuration time.Duration
+	refreshTokens        RefreshTokenStore
 }
 
-// NewService creates a new JWT service
-func NewService(secretKey string, accessDuration, refreshDuration time.Duration) *Service {
+// NewService creates a new JWT service that signs tokens with signer.
+// Issued refresh tokens are persisted in refreshTokens so they can be rotated and revoked
+func NewService(signer *Signer, accessDuration, refreshDuration time.Duration, refreshTokens RefreshTokenStore) *Service {
 	return &Service{
-		secretKey:            []byte(secretKey),
+		signer:               signer,
 		accessTokenDuration:  accessDuration,
 		refreshTokenDuration: refreshDuration,
+		refreshTokens:        refreshTokens,
 	}
 }
 
 // ValidateToken validates and parses the JWT token
 func (s *Service) ValidateAccessToken(tokenStirng string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenStirng, &Claims{}, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStirng, &Claims{}, s.signer.keyFunc, s.signer.parserOptions()...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
@@ -59,15 +68,22 @@ func (s *Service) ValidateAccessToken(tokenStirng string) (*Claims, error) {
 		return nil, fmt.Errorf("invalid access token: missing username")
 	}
 
+	// Tokens from before the role claim are still valid until they expire
+	if claims.Role == "" {
+		claims.Role = RoleUser
+	}
+
 	return claims, nil
 }
 
 // GenerateAccessToken creates a short-lived access token
-func (s *Service) GenerateAccessToken(userID uuid.UUID, email, username string) (string, error) {
+func (s *Service) GenerateAccessToken(userID uuid.UUID, email, username, role string, emailVerified bool) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Email:    email,
-		Username: username,
+		UserID:        userID,
+		Email:         email,
+		Username:      username,
+		Role:          role,
+		EmailVerified: emailVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.accessTokenDuration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -75,48 +91,137 @@ func (s *Service) GenerateAccessToken(userID uuid.UUID, email, username string)
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secretKey)
+	return s.signer.sign(claims)
+}
+
+// GenerateRefreshToken creates a long-lived refresh token starting a new token family
+func (s *Service) GenerateRefreshToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	return s.issueRefreshToken(ctx, userID, uuid.New())
 }
 
-// GenerateRefreshToken creates a long-lived refresh token
-func (s *Service) GenerateRefreshToken(userID uuid.UUID) (string, error) {
+// issueRefreshToken signs a refresh token with a fresh jti and records it in the store
+func (s *Service) issueRefreshToken(ctx context.Context, userID, familyID uuid.UUID) (string, error) {
+	now := time.Now()
+
+	record := &RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(s.refreshTokenDuration),
+	}
+
 	claims := jwt.RegisteredClaims{
+		ID:        record.ID.String(),
 		Subject:   userID.String(),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.refreshTokenDuration)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(record.ExpiresAt),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+
+	signed, err := s.signer.sign(claims)
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.secretKey)
+	if err := s.refreshTokens.CreateRefreshToken(ctx, record); err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return signed, nil
 }
 
-// ValidateRefreshToken validates token and returns the user ID
-func (s *Service) ValidateRefreshToken(tokenString string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(t *jwt.Token) (any, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return s.secretKey, nil
-	})
+// parseRefreshToken verifies the signature (and by default the expiry) and returns the registered claims
+func (s *Service) parseRefreshToken(tokenString string, opts ...jwt.ParserOption) (*jwt.RegisteredClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, s.signer.keyFunc, s.signer.parserOptions(opts...)...)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to parse refresh token: %w", err)
+		return nil, fmt.Errorf("failed to parse refresh token: %w", err)
 	}
 
 	claims, ok := token.Claims.(*jwt.RegisteredClaims)
 	if !ok || !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid refresh token")
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+
+	return claims, nil
+}
+
+// ValidateRefreshToken validates the token and its server-side record.
+// A token that was already rotated yields a *ReusedTokenError (errors.Is ErrRefreshTokenReused)
+func (s *Service) ValidateRefreshToken(ctx context.Context, tokenString string) (*RefreshToken, error) {
+	claims, err := s.parseRefreshToken(tokenString)
+	if err != nil {
+		return nil, err
 	}
 
 	if claims.Subject == "" {
-		return uuid.Nil, fmt.Errorf("invalid refresh token: missing subject")
+		return nil, fmt.Errorf("invalid refresh token: missing subject")
 	}
 
 	userID, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID in token: %w", err)
+		return nil, fmt.Errorf("invalid user ID in token: %w", err)
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refresh token: missing jti")
+	}
+
+	record, err := s.refreshTokens.GetRefreshToken(ctx, jti)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.UserID != userID {
+		return nil, fmt.Errorf("invalid refresh token: subject mismatch")
+	}
+	if record.RevokedAt != nil {
+		return nil, ErrRefreshTokenRevoked
+	}
+	if record.UsedAt != nil {
+		return nil, &ReusedTokenError{UserID: record.UserID, FamilyID: record.FamilyID}
+	}
+
+	return record, nil
+}
+
+// RotateRefreshToken marks a validated token as used and issues its successor
+// in the same family. Losing a race against a concurrent rotation counts as reuse
+func (s *Service) RotateRefreshToken(ctx context.Context, current *RefreshToken) (string, error) {
+	marked, err := s.refreshTokens.MarkRefreshTokenUsed(ctx, current.ID)
+	if err != nil {
+		return "", err
+	}
+	if !marked {
+		return "", &ReusedTokenError{UserID: current.UserID, FamilyID: current.FamilyID}
+	}
+
+	return s.issueRefreshToken(ctx, current.UserID, current.FamilyID)
+}
+
+// RevokeTokenFamily invalidates every refresh token rotated from the same signin
+func (s *Service) RevokeTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	return s.refreshTokens.RevokeRefreshTokenFamily(ctx, familyID)
+}
+
+// RevokeUserSessions invalidates every refresh token issued to the user
+func (s *Service) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	return s.refreshTokens.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// RevokeRefreshToken records the token's jti as revoked so it can't be used again.
+// Expired tokens are accepted (their signature is still checked) and revoking
+// an already revoked token is a no-op, so clients can call logout blindly
+func (s *Service) RevokeRefreshToken(ctx context.Context, tokenString string) error {
+	claims, err := s.parseRefreshToken(tokenString, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return fmt.Errorf("%w: missing jti", ErrInvalidToken)
 	}
 
-	return userID, nil
+	return s.refreshTokens.RevokeRefreshToken(ctx, jti)
 }
@@ -4,18 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
 )
 
 type contextKey string
 
-const (
-	userIDKey    contextKey = "user_id"
-	userEmailKey contextKey = "user_email"
-	userNameKey  contextKey = "username"
-)
+// claimsKey holds the *Claims of the authenticated request
+const claimsKey contextKey = "claims"
 
 func Middleware(authService *Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -47,28 +46,152 @@ func Middleware(authService *Service) func(http.Handler) http.Handler {
 				return
 			}
 
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, userIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, userEmailKey, claims.Email)
-			ctx = context.WithValue(ctx, userNameKey, claims.Username)
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// OptionalMiddleware sets the user like Middleware when the request carries a
+// valid token, and otherwise lets it through anonymously. Handlers tell the two
+// apart with UserIDFromContext
+func OptionalMiddleware(authService *Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(r.Header.Get("Authorization"), " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := authService.ValidateAccessToken(parts[1])
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// RequireRole lets through only users whose token carries role, and the users
+// listed in allowed whatever their role. It authenticates the request itself
+// when Middleware hasn't run before it
+func RequireRole(authService *Service, role string, allowed ...uuid.UUID) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		check := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasRole(r.Context(), role, allowed...) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Insufficient role"})
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+		authenticated := Middleware(authService)(check)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := UserIDFromContext(r.Context()); ok {
+				check.ServeHTTP(w, r)
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdmin is RequireRole for RoleAdmin. The adminIDs allowlist covers
+// deployments that haven't granted the role to anyone yet
+func RequireAdmin(authService *Service, adminIDs []uuid.UUID) func(http.Handler) http.Handler {
+	return RequireRole(authService, RoleAdmin, adminIDs...)
+}
+
+// HasRole reports whether the authenticated user's token carries role or the
+// user is listed in allowed. Unauthenticated requests never have a role
+func HasRole(ctx context.Context, role string, allowed ...uuid.UUID) bool {
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return false
+	}
+	return claims.Role == role || slices.Contains(allowed, claims.UserID)
+}
+
+// RequireVerifiedEmail rejects users whose token says their email isn't verified
+// yet, it must run after Middleware. When required is false it lets everyone through
+func RequireVerifiedEmail(required bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !required {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !IsEmailVerified(r.Context()) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Email verification required"})
+
+				return
+			}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// Helper functions to extract from context
+func withClaims(ctx context.Context, claims *Claims) context.Context {
+	ctx = context.WithValue(ctx, claimsKey, claims)
+	ctx = logger.WithContext(ctx, logger.FromContext(ctx).With("user_id", claims.UserID))
+	return ctx
+}
+
+// GetClaims returns the claims of the access token the request was
+// authenticated with, false for unauthenticated requests
+func GetClaims(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok
+}
+
+// Helper functions to extract single claims from context
 func GetUserID(ctx context.Context) uuid.UUID {
-	userID, _ := ctx.Value(userIDKey).(uuid.UUID)
+	userID, _ := UserIDFromContext(ctx)
 	return userID
 }
 
+// UserIDFromContext reports whether the request is authenticated,
+// unlike GetUserID which returns uuid.Nil for unauthenticated requests
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	claims, ok := GetClaims(ctx)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return claims.UserID, true
+}
+
 func GetEmail(ctx context.Context) string {
-	email, _ := ctx.Value(userEmailKey).(string)
-	return email
+	if claims, ok := GetClaims(ctx); ok {
+		return claims.Email
+	}
+	return ""
 }
 
 func GetUsername(ctx context.Context) string {
-	username, _ := ctx.Value(userNameKey).(string)
-	return username
+	if claims, ok := GetClaims(ctx); ok {
+		return claims.Username
+	}
+	return ""
+}
+
+// GetRole returns the role from the access token, empty for unauthenticated requests
+func GetRole(ctx context.Context) string {
+	if claims, ok := GetClaims(ctx); ok {
+		return claims.Role
+	}
+	return ""
+}
+
+// IsEmailVerified reports the verification state from the access token
+func IsEmailVerified(ctx context.Context) bool {
+	claims, ok := GetClaims(ctx)
+	return ok && claims.EmailVerified
 }
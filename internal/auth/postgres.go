@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool}
+}
+
+// CreateRefreshToken stores a newly issued refresh token
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, user_id, family_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	token.CreatedAt = time.Now()
+
+	_, err := s.pool.Exec(ctx, query,
+		token.ID,
+		token.UserID,
+		token.FamilyID,
+		token.ExpiresAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("operation cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshToken retrieves a refresh token record by its jti
+func (s *PostgresStore) GetRefreshToken(ctx context.Context, id uuid.UUID) (*RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE id = $1
+	`
+
+	token := &RefreshToken{}
+	err := s.pool.QueryRow(ctx, query, id).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// MarkRefreshTokenUsed atomically flags a token as rotated.
+// Returns false when another request already used it or it was revoked
+func (s *PostgresStore) MarkRefreshTokenUsed(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := s.pool.Exec(ctx, query, id, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+// RevokeRefreshToken revokes a single token. Revoking twice is a no-op
+func (s *PostgresStore) RevokeRefreshToken(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $2
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := s.pool.Exec(ctx, query, id, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every token rotated from the same signin
+func (s *PostgresStore) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $2
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := s.pool.Exec(ctx, query, familyID, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every outstanding token of a user, logging out all sessions
+func (s *PostgresStore) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = $2
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := s.pool.Exec(ctx, query, userID, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	passwordResetTTL      = 15 * time.Minute
+	passwordResetAudience = "password_reset"
+)
+
+// PasswordResetClaims ties a reset token to the password hash it was issued for,
+// so the token stops working once the password has changed (single use)
+type PasswordResetClaims struct {
+	PasswordFingerprint string `json:"pwf"`
+	jwt.RegisteredClaims
+}
+
+// GeneratePasswordResetToken issues a short-lived token for resetting the password
+// of userID, whose current password hash is passwordHash
+func (s *Service) GeneratePasswordResetToken(userID uuid.UUID, passwordHash string) (string, error) {
+	now := time.Now()
+
+	claims := PasswordResetClaims{
+		PasswordFingerprint: passwordFingerprint(passwordHash),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{passwordResetAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(passwordResetTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	return s.signer.sign(claims)
+}
+
+// ValidatePasswordResetToken checks signature, expiry and audience and returns the user ID.
+// The caller must still check MatchesPassword against the stored hash
+func (s *Service) ValidatePasswordResetToken(tokenString string) (*PasswordResetClaims, uuid.UUID, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &PasswordResetClaims{}, s.signer.keyFunc,
+		s.signer.parserOptions(jwt.WithAudience(passwordResetAudience))...)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*PasswordResetClaims)
+	if !ok || !token.Valid {
+		return nil, uuid.Nil, ErrInvalidToken
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+
+	return claims, userID, nil
+}
+
+// MatchesPassword reports whether the token was issued for the given password hash
+func (c *PasswordResetClaims) MatchesPassword(passwordHash string) bool {
+	expected := passwordFingerprint(passwordHash)
+	return subtle.ConstantTimeCompare([]byte(c.PasswordFingerprint), []byte(expected)) == 1
+}
+
+// passwordFingerprint is a short digest of the hash, so the token doesn't carry the hash itself
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
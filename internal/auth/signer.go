@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+// Signer holds the algorithm and keys used to sign and verify tokens.
+// For HS256 both keys are the shared secret, for RS256/ES256 only the
+// public half is needed to verify, so other services don't need the secret
+type Signer struct {
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+	keyID     string // Written as the kid header, empty for HS256
+}
+
+// NewHMACSigner signs tokens with HS256 and a shared secret
+func NewHMACSigner(secret string) *Signer {
+	key := []byte(secret)
+	return &Signer{method: jwt.SigningMethodHS256, signKey: key, verifyKey: key}
+}
+
+// NewRSASigner signs tokens with RS256 using a PEM encoded RSA private key
+func NewRSASigner(privateKeyPEM []byte) (*Signer, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+	}
+	return newAsymmetricSigner(jwt.SigningMethodRS256, key, &key.PublicKey), nil
+}
+
+// NewECDSASigner signs tokens with ES256 using a PEM encoded P-256 private key
+func NewECDSASigner(privateKeyPEM []byte) (*Signer, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ECDSA private key: %w", err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("ES256 requires a P-256 key, got %s", key.Curve.Params().Name)
+	}
+	return newAsymmetricSigner(jwt.SigningMethodES256, key, &key.PublicKey), nil
+}
+
+func newAsymmetricSigner(method jwt.SigningMethod, private, public any) *Signer {
+	s := &Signer{method: method, signKey: private, verifyKey: public}
+	if jwk, ok := publicJWK(public, method.Alg()); ok {
+		s.keyID = jwk.Kid
+	}
+	return s
+}
+
+// LoadSigner builds a signer for the given algorithm. HS256 uses secret,
+// RS256 and ES256 read the private key from privateKeyPath
+func LoadSigner(algorithm, secret, privateKeyPath string) (*Signer, error) {
+	if algorithm == AlgHS256 {
+		return NewHMACSigner(secret), nil
+	}
+
+	pem, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	switch algorithm {
+	case AlgRS256:
+		return NewRSASigner(pem)
+	case AlgES256:
+		return NewECDSASigner(pem)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
+
+// Algorithm returns the JWT alg header value
+func (s *Signer) Algorithm() string {
+	return s.method.Alg()
+}
+
+func (s *Signer) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.keyID != "" {
+		token.Header["kid"] = s.keyID
+	}
+	return token.SignedString(s.signKey)
+}
+
+// keyFunc rejects tokens whose alg doesn't match the configured one,
+// so a public key can never be used as an HMAC secret
+func (s *Signer) keyFunc(t *jwt.Token) (any, error) {
+	if t.Method.Alg() != s.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	return s.verifyKey, nil
+}
+
+// parserOptions pins the accepted algorithm at the parser level as well
+func (s *Signer) parserOptions(opts ...jwt.ParserOption) []jwt.ParserOption {
+	return append([]jwt.ParserOption{jwt.WithValidMethods([]string{s.method.Alg()})}, opts...)
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidToken means the token is malformed or its signature doesn't verify
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrRefreshTokenNotFound means the token's jti was never issued by us
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenRevoked means the token was explicitly invalidated
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+	// ErrRefreshTokenReused means an already rotated token was presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is the server-side record of an issued refresh token.
+// Tokens rotated from the same signin share a FamilyID
+type RefreshToken struct {
+	ID        uuid.UUID // jti claim
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// ReusedTokenError carries the family of a refresh token that was presented
+// after it had already been rotated, so the caller can revoke the whole family
+type ReusedTokenError struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (e *ReusedTokenError) Error() string {
+	return ErrRefreshTokenReused.Error()
+}
+
+func (e *ReusedTokenError) Is(target error) bool {
+	return target == ErrRefreshTokenReused
+}
+
+// RefreshTokenStore persists issued refresh tokens so they can be rotated and revoked
+type RefreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshToken(ctx context.Context, id uuid.UUID) (*RefreshToken, error)
+	// MarkRefreshTokenUsed returns false if the token was already used or revoked
+	MarkRefreshTokenUsed(ctx context.Context, id uuid.UUID) (bool, error)
+	RevokeRefreshToken(ctx context.Context, id uuid.UUID) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	emailVerificationTTL      = 24 * time.Hour
+	emailVerificationAudience = "email_verification"
+)
+
+// EmailVerificationClaims ties a verification token to the address it was sent to,
+// so the token stops working once the user changes their email
+type EmailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// GenerateEmailVerificationToken issues a token proving that userID can read mail sent to email
+func (s *Service) GenerateEmailVerificationToken(userID uuid.UUID, email string) (string, error) {
+	now := time.Now()
+
+	claims := EmailVerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(emailVerificationTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	return s.signer.sign(claims)
+}
+
+// ValidateEmailVerificationToken checks signature, expiry and audience and returns the user ID.
+// The caller must still check claims.Email against the stored email
+func (s *Service) ValidateEmailVerificationToken(tokenString string) (*EmailVerificationClaims, uuid.UUID, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &EmailVerificationClaims{}, s.signer.keyFunc,
+		s.signer.parserOptions(jwt.WithAudience(emailVerificationAudience))...)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := token.Claims.(*EmailVerificationClaims)
+	if !ok || !token.Valid {
+		return nil, uuid.Nil, ErrInvalidToken
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, uuid.Nil, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+
+	return claims, userID, nil
+}
@@ -1,9 +1,20 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/pkg/audio"
 	"github.com/spf13/viper"
 )
 
@@ -12,18 +23,49 @@ type Config struct {
 	HttpServerParams HttpServerParams
 	MainDBParams     MainDBParams
 	S3Params         S3Params
+	VoiceParams      VoiceParams
+	WebsocketParams  WebsocketParams
+	LoginParams      LoginParams
+	MailParams       MailParams
+	PushParams       PushParams
+	RateLimitParams  RateLimitParams
+	RedisParams      RedisParams
+	RoomParams       RoomParams
 }
 
 type GeneralParams struct {
-	Env             string
-	SecretKey       string
-	AccessTokenTTL  int
-	RefreshTokenTTL int
+	Env              string
+	SecretKey        string
+	SigningAlgorithm string // HS256, RS256 or ES256
+	PrivateKeyPath   string // PEM file, required for RS256/ES256
+	AccessTokenTTL   int    // Minutes
+	RefreshTokenTTL  int    // Days
+
+	AdminUserIDs []string // Users allowed on /api/admin
+
+	// RequireVerifiedEmail keeps users from creating rooms and uploading until they verify their email
+	RequireVerifiedEmail bool
+}
+
+// AdminIDs returns the parsed admin allowlist, Validate rejects malformed IDs
+func (g GeneralParams) AdminIDs() []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(g.AdminUserIDs))
+	for _, raw := range g.AdminUserIDs {
+		if id, err := uuid.Parse(raw); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
 
 type HttpServerParams struct {
-	Address string
-	Port    string
+	Address        string
+	Port           string
+	CORSOrigins    []string // Also used to validate websocket Origin headers
+	CORSMethods    []string
+	CORSHeaders    []string
+	MetricsEnabled bool // Serves Prometheus metrics on /metrics
+	RequestTimeout int  // Seconds, 0 disables. WebSocket connections are exempt
 }
 
 type MainDBParams struct {
@@ -33,58 +75,271 @@ type MainDBParams struct {
 	Port     int
 	Host     string
 	Timeout  int
+
+	AutoMigrate bool // Apply pending migrations on startup
 }
 
 type S3Params struct {
-	Endpoint        string
+	Endpoint        string // host[:port], optionally prefixed with http:// or https://
 	AccessKeyID     string
 	SecretAccessKey string
 	UseSSL          bool
 	BucketName      string
 }
 
+type VoiceParams struct {
+	EnabledFormats []string
+	MaxSampleRate  int // Hz, 0 disables the check
+	MaxChannels    int // 0 disables the check
+	MaxBitrateKbps int // 0 disables the check
+
+	MaxUploadBytes     int64 // Largest accepted upload request
+	MaxDurationSeconds int   // Longest accepted message
+	URLExpiry          int   // Seconds presigned playback URLs stay valid
+
+	ReconcileInterval int  // Minutes between orphaned object sweeps, 0 disables
+	ReconcileDryRun   bool // Only log orphaned objects instead of deleting them
+
+	DeleteGracePeriod int // Hours the audio of a deleted message is kept, 0 keeps it until purged
+
+	TranscodeEnabled bool   // Convert uploads to Ogg/Opus with ffmpeg
+	FFmpegPath       string // Looked up in PATH unless absolute
+	TranscodeTimeout int    // Seconds per upload
+
+	STTURL     string // Speech-to-text endpoint, empty disables transcription
+	STTAPIKey  string // Sent as a bearer token when set
+	STTTimeout int    // Seconds per request
+}
+
+type WebsocketParams struct {
+	DropAlertThreshold    float64 // Dropped messages per second, 0 disables alerting
+	DropAlertWindow       int     // Seconds
+	DropAlertWebhookURL   string  // Optional, alerts are logged either way
+	MaxClientsPerRoom     int     // 0 means unlimited
+	MaxConnectionsPerUser int     // 0 means unlimited
+	CompressionEnabled    bool    // Negotiate permessage-deflate with clients
+}
+
+type LoginParams struct {
+	MaxAttempts int // Failed signins before lockout, 0 disables it
+	Window      int // Seconds in which failures are counted
+	Lockout     int // Seconds
+}
+
+type MailParams struct {
+	SMTPHost         string // Emails are only logged when empty
+	SMTPPort         int
+	Username         string
+	Password         string
+	From             string
+	ResetPasswordURL string
+	VerifyEmailURL   string // Frontend page taking ?token=, the raw token is emailed when empty
+}
+
+type RateLimitParams struct {
+	Enabled       bool
+	AuthPerMinute int // Requests per client IP to /api/auth/*
+	AuthBurst     int
+	UserPerSecond float64 // Requests per user to authenticated routes
+	UserBurst     int
+}
+
+type RoomParams struct {
+	MaxParticipants int // Members per room, the owner included. 0 means unlimited
+}
+
+type RedisParams struct {
+	Addr          string // host:port, websocket broadcasts stay on this instance when empty
+	Password      string
+	DB            int
+	ChannelPrefix string
+}
+
+type PushParams struct {
+	Endpoint string // FCM-style HTTP endpoint, notifications are dropped when empty
+	APIKey   string
+}
+
 type ConfigManager struct {
 	v      *viper.Viper
-	config *Config
+	config atomic.Pointer[Config]
 }
 
 // NewConfigManager creates new config manager that handles
-// all viper config options and loads a config from yaml
+// all viper config options and loads a config from yaml.
+// The yaml file is optional, without it (empty path or missing file) every
+// setting comes from APP_ prefixed env vars and the defaults, e.g.
+// main_db_params.db_host is read from APP_MAIN_DB_PARAMS_DB_HOST.
+// Env vars override the file when both are set
 func NewConfigManager(configPath string) (*ConfigManager, error) {
 	v := viper.New()
 
-	v.SetConfigFile(configPath)
-	v.SetConfigType("yaml")
+	setDefaults(v)
 
 	v.AutomaticEnv()
 	v.SetEnvPrefix("APP")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
-	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
+	if configPath != "" {
+		_, err := os.Stat(configPath)
+		switch {
+		case err == nil:
+			v.SetConfigFile(configPath)
+			v.SetConfigType("yaml")
+			if err := v.ReadInConfig(); err != nil {
+				return nil, fmt.Errorf("failed to read config: %w", err)
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
 	}
 
 	cm := &ConfigManager{v: v}
+	cm.config.Store(cm.loadConfig())
+
+	return cm, nil
+}
 
-	if err := cm.loadConfig(); err != nil {
-		return nil, err
+// Watch reloads the config file whenever it changes. A reloaded config that
+// passes Validate replaces the current one and is passed to onChange, an
+// invalid one is passed to onInvalid and never applied.
+//
+// Only the config returned by GetConfig is swapped. The server copies every
+// setting it uses at startup, so for now all of them need a restart to take
+// effect. RestartRequired lists the connection settings that differ, those will
+// need one even once the others are read live
+func (cm *ConfigManager) Watch(onChange func(*Config), onInvalid func(error)) {
+	// Nothing to watch when configured from env only
+	if cm.v.ConfigFileUsed() == "" {
+		return
 	}
 
-	return cm, nil
+	cm.v.OnConfigChange(func(e fsnotify.Event) {
+		next := cm.loadConfig()
+		if err := next.Validate(); err != nil {
+			if onInvalid != nil {
+				onInvalid(fmt.Errorf("reloaded config from %s is invalid: %w", e.Name, err))
+			}
+			return
+		}
+
+		cm.config.Store(next)
+		if onChange != nil {
+			onChange(next)
+		}
+	})
+	cm.v.WatchConfig()
+}
+
+// Default values for optional parameters
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("http_server_params.cors_origins", []string{
+		"http://localhost:3000",
+		"https://localhost:3000",
+	})
+	v.SetDefault("http_server_params.cors_methods", []string{
+		"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS",
+	})
+	v.SetDefault("http_server_params.cors_headers", []string{
+		"Origin",
+		"Content-Type",
+		"Accept",
+		"Authorization",
+		"Upgrade",    // Important for WebSocket handshake
+		"Connection", // Important for WebSocket handshake
+		"Sec-Websocket-Key",
+		"Sec-Websocket-Version",
+		"Sec-Websocket-Protocol",
+	})
+	v.SetDefault("main_db_params.db_port", 5432)
+	v.SetDefault("main_db_params.auto_migrate", false)
+	v.SetDefault("http_server_params.metrics_enabled", true)
+	v.SetDefault("http_server_params.request_timeout", 10)
+	v.SetDefault("rate_limit_params.enabled", true)
+	v.SetDefault("rate_limit_params.auth_per_minute", 20)
+	v.SetDefault("rate_limit_params.auth_burst", 10)
+	v.SetDefault("rate_limit_params.user_per_second", 10)
+	v.SetDefault("rate_limit_params.user_burst", 30)
+	v.SetDefault("redis_params.db", 0)
+	v.SetDefault("room_params.max_participants", 256)
+	v.SetDefault("redis_params.channel_prefix", "laba_zis:ws:room:")
+	v.SetDefault("general_params.signing_algorithm", "HS256")
+	v.SetDefault("general_params.access_token_ttl", 15)
+	v.SetDefault("general_params.refresh_token_ttl", 7)
+	v.SetDefault("general_params.require_verified_email", false)
+	v.SetDefault("voice_params.enabled_formats", audio.FormatNames())
+	v.SetDefault("voice_params.max_sample_rate", 48000)
+	v.SetDefault("voice_params.max_channels", 2)
+	v.SetDefault("voice_params.max_bitrate_kbps", 320)
+	v.SetDefault("voice_params.max_upload_bytes", 5*1024*1024)
+	v.SetDefault("voice_params.max_duration_seconds", 15)
+	v.SetDefault("voice_params.url_expiry", 3600)
+	v.SetDefault("voice_params.reconcile_interval", 0)
+	v.SetDefault("voice_params.reconcile_dry_run", false)
+	v.SetDefault("voice_params.delete_grace_period", 168)
+	v.SetDefault("voice_params.transcode_enabled", false)
+	v.SetDefault("voice_params.ffmpeg_path", "ffmpeg")
+	v.SetDefault("voice_params.transcode_timeout", 15)
+	v.SetDefault("voice_params.stt_url", "")
+	v.SetDefault("voice_params.stt_api_key", "")
+	v.SetDefault("voice_params.stt_timeout", 60)
+	v.SetDefault("mail_params.smtp_port", 587)
+	v.SetDefault("login_params.max_attempts", 5)
+	v.SetDefault("login_params.window", 900)
+	v.SetDefault("login_params.lockout", 900)
+	v.SetDefault("websocket_params.drop_alert_threshold", 0)
+	v.SetDefault("websocket_params.drop_alert_window", 60)
+	v.SetDefault("websocket_params.max_clients_per_room", 100)
+	v.SetDefault("websocket_params.max_connections_per_user", 10)
+	v.SetDefault("websocket_params.compression_enabled", false)
+}
+
+// RestartRequired names the settings that differ from prev and are used to open
+// connections or listeners: the main DB, S3, Redis, the HTTP address and the
+// token signing keys
+func (c *Config) RestartRequired(prev *Config) []string {
+	var changed []string
+	if c.MainDBParams != prev.MainDBParams {
+		changed = append(changed, "main_db_params")
+	}
+	if c.S3Params != prev.S3Params {
+		changed = append(changed, "s3_params")
+	}
+	if c.RedisParams != prev.RedisParams {
+		changed = append(changed, "redis_params")
+	}
+	if c.HttpServerParams.GetAddress() != prev.HttpServerParams.GetAddress() {
+		changed = append(changed, "http_server_params.http_server_address")
+	}
+	if c.GeneralParams.SigningAlgorithm != prev.GeneralParams.SigningAlgorithm ||
+		c.GeneralParams.SecretKey != prev.GeneralParams.SecretKey ||
+		c.GeneralParams.PrivateKeyPath != prev.GeneralParams.PrivateKeyPath {
+		changed = append(changed, "general_params signing keys")
+	}
+	return changed
 }
 
 // Extracting data from yaml file and loading into Config
-func (cm *ConfigManager) loadConfig() error {
-	cm.config = &Config{
+func (cm *ConfigManager) loadConfig() *Config {
+	return &Config{
 		GeneralParams: GeneralParams{
-			Env:             cm.v.GetString("general_params.env"),
-			SecretKey:       cm.v.GetString("general_params.secret_key"),
-			AccessTokenTTL:  cm.v.GetInt("general_params.access_token_ttl"),
-			RefreshTokenTTL: cm.v.GetInt("general_params.refresh_token_ttl"),
+			Env:                  cm.v.GetString("general_params.env"),
+			SecretKey:            cm.v.GetString("general_params.secret_key"),
+			SigningAlgorithm:     cm.v.GetString("general_params.signing_algorithm"),
+			PrivateKeyPath:       cm.v.GetString("general_params.private_key_path"),
+			AccessTokenTTL:       cm.v.GetInt("general_params.access_token_ttl"),
+			RefreshTokenTTL:      cm.v.GetInt("general_params.refresh_token_ttl"),
+			AdminUserIDs:         cm.getStringSlice("general_params.admin_user_ids"),
+			RequireVerifiedEmail: cm.v.GetBool("general_params.require_verified_email"),
 		},
 		HttpServerParams: HttpServerParams{
-			Address: cm.v.GetString("http_server_params.http_server_address"),
-			Port:    cm.v.GetString("http_server_params.http_server_port"),
+			Address:        cm.v.GetString("http_server_params.http_server_address"),
+			Port:           cm.v.GetString("http_server_params.http_server_port"),
+			CORSOrigins:    cm.getStringSlice("http_server_params.cors_origins"),
+			CORSMethods:    cm.getStringSlice("http_server_params.cors_methods"),
+			CORSHeaders:    cm.getStringSlice("http_server_params.cors_headers"),
+			MetricsEnabled: cm.v.GetBool("http_server_params.metrics_enabled"),
+			RequestTimeout: cm.v.GetInt("http_server_params.request_timeout"),
 		},
 		MainDBParams: MainDBParams{
 			Username: cm.v.GetString("main_db_params.db_username"),
@@ -93,6 +348,8 @@ func (cm *ConfigManager) loadConfig() error {
 			Port:     cm.v.GetInt("main_db_params.db_port"),
 			Host:     cm.v.GetString("main_db_params.db_host"),
 			Timeout:  cm.v.GetInt("main_db_params.db_timeout"),
+
+			AutoMigrate: cm.v.GetBool("main_db_params.auto_migrate"),
 		},
 		S3Params: S3Params{
 			Endpoint:        cm.v.GetString("s3_params.endpoint"),
@@ -101,13 +358,90 @@ func (cm *ConfigManager) loadConfig() error {
 			UseSSL:          cm.v.GetBool("s3_params.use_ssl"),
 			BucketName:      cm.v.GetString("s3_params.bucket_name"),
 		},
+		VoiceParams: VoiceParams{
+			EnabledFormats:     cm.getStringSlice("voice_params.enabled_formats"),
+			MaxSampleRate:      cm.v.GetInt("voice_params.max_sample_rate"),
+			MaxChannels:        cm.v.GetInt("voice_params.max_channels"),
+			MaxBitrateKbps:     cm.v.GetInt("voice_params.max_bitrate_kbps"),
+			MaxUploadBytes:     cm.v.GetInt64("voice_params.max_upload_bytes"),
+			MaxDurationSeconds: cm.v.GetInt("voice_params.max_duration_seconds"),
+			URLExpiry:          cm.v.GetInt("voice_params.url_expiry"),
+			ReconcileInterval:  cm.v.GetInt("voice_params.reconcile_interval"),
+			ReconcileDryRun:    cm.v.GetBool("voice_params.reconcile_dry_run"),
+			DeleteGracePeriod:  cm.v.GetInt("voice_params.delete_grace_period"),
+			TranscodeEnabled:   cm.v.GetBool("voice_params.transcode_enabled"),
+			FFmpegPath:         cm.v.GetString("voice_params.ffmpeg_path"),
+			TranscodeTimeout:   cm.v.GetInt("voice_params.transcode_timeout"),
+			STTURL:             cm.v.GetString("voice_params.stt_url"),
+			STTAPIKey:          cm.v.GetString("voice_params.stt_api_key"),
+			STTTimeout:         cm.v.GetInt("voice_params.stt_timeout"),
+		},
+		WebsocketParams: WebsocketParams{
+			DropAlertThreshold:    cm.v.GetFloat64("websocket_params.drop_alert_threshold"),
+			DropAlertWindow:       cm.v.GetInt("websocket_params.drop_alert_window"),
+			DropAlertWebhookURL:   cm.v.GetString("websocket_params.drop_alert_webhook_url"),
+			MaxClientsPerRoom:     cm.v.GetInt("websocket_params.max_clients_per_room"),
+			MaxConnectionsPerUser: cm.v.GetInt("websocket_params.max_connections_per_user"),
+			CompressionEnabled:    cm.v.GetBool("websocket_params.compression_enabled"),
+		},
+		LoginParams: LoginParams{
+			MaxAttempts: cm.v.GetInt("login_params.max_attempts"),
+			Window:      cm.v.GetInt("login_params.window"),
+			Lockout:     cm.v.GetInt("login_params.lockout"),
+		},
+		MailParams: MailParams{
+			SMTPHost:         cm.v.GetString("mail_params.smtp_host"),
+			SMTPPort:         cm.v.GetInt("mail_params.smtp_port"),
+			Username:         cm.v.GetString("mail_params.username"),
+			Password:         cm.v.GetString("mail_params.password"),
+			From:             cm.v.GetString("mail_params.from"),
+			ResetPasswordURL: cm.v.GetString("mail_params.reset_password_url"),
+			VerifyEmailURL:   cm.v.GetString("mail_params.verify_email_url"),
+		},
+		RateLimitParams: RateLimitParams{
+			Enabled:       cm.v.GetBool("rate_limit_params.enabled"),
+			AuthPerMinute: cm.v.GetInt("rate_limit_params.auth_per_minute"),
+			AuthBurst:     cm.v.GetInt("rate_limit_params.auth_burst"),
+			UserPerSecond: cm.v.GetFloat64("rate_limit_params.user_per_second"),
+			UserBurst:     cm.v.GetInt("rate_limit_params.user_burst"),
+		},
+		PushParams: PushParams{
+			Endpoint: cm.v.GetString("push_params.endpoint"),
+			APIKey:   cm.v.GetString("push_params.api_key"),
+		},
+		RedisParams: RedisParams{
+			Addr:          cm.v.GetString("redis_params.addr"),
+			Password:      cm.v.GetString("redis_params.password"),
+			DB:            cm.v.GetInt("redis_params.db"),
+			ChannelPrefix: cm.v.GetString("redis_params.channel_prefix"),
+		},
+		RoomParams: RoomParams{
+			MaxParticipants: cm.v.GetInt("room_params.max_participants"),
+		},
 	}
-	return nil
 }
 
-// Geting config instance
+// getStringSlice also accepts a comma separated string, which is how lists
+// arrive from env vars (APP_VOICE_PARAMS_ENABLED_FORMATS=mp3,ogg)
+func (cm *ConfigManager) getStringSlice(key string) []string {
+	raw, ok := cm.v.Get(key).(string)
+	if !ok {
+		return cm.v.GetStringSlice(key)
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Geting config instance, the latest valid one once Watch has reloaded it.
+// Callers shouldn't modify it
 func (cm *ConfigManager) GetConfig() *Config {
-	return cm.config
+	return cm.config.Load()
 }
 
 // Compiling a string to connect to main_db
@@ -131,16 +465,123 @@ func (h *HttpServerParams) GetAddress() string {
 	)
 }
 
+// bucketNamePattern is the S3 bucket naming rule minus the checks regexp can't express
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// Host returns the endpoint without its scheme, which is what the S3 client expects
+func (p S3Params) Host() string {
+	if i := strings.Index(p.Endpoint, "://"); i >= 0 {
+		return p.Endpoint[i+3:]
+	}
+	return p.Endpoint
+}
+
+// validate checks the endpoint and bucket name, so typos fail at startup
+// instead of on the first EnsureBucket call
+func (p S3Params) validate() error {
+	if scheme, _, ok := strings.Cut(p.Endpoint, "://"); ok {
+		switch scheme {
+		case "https":
+			if !p.UseSSL {
+				return fmt.Errorf("S3 endpoint uses https but use_ssl is false: %s", p.Endpoint)
+			}
+		case "http":
+			if p.UseSSL {
+				return fmt.Errorf("S3 endpoint uses http but use_ssl is true: %s", p.Endpoint)
+			}
+		default:
+			return fmt.Errorf("S3 endpoint scheme is invalid: %s. expected http or https", p.Endpoint)
+		}
+	}
+
+	host := p.Host()
+	if host == "" || strings.ContainsAny(host, "/?#@ ") {
+		return fmt.Errorf("S3 endpoint is invalid: %s. expected [scheme://]host[:port]", p.Endpoint)
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		n, err := strconv.Atoi(port)
+		if h == "" || err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("S3 endpoint is invalid: %s. expected [scheme://]host[:port]", p.Endpoint)
+		}
+	} else if strings.Contains(host, ":") && net.ParseIP(strings.Trim(host, "[]")) == nil {
+		return fmt.Errorf("S3 endpoint is invalid: %s. expected [scheme://]host[:port]", p.Endpoint)
+	}
+
+	name := p.BucketName
+	switch {
+	case !bucketNamePattern.MatchString(name):
+		return fmt.Errorf("S3 bucket name is invalid: %s. expected 3-63 lowercase letters, digits, dots or hyphens, starting and ending with a letter or digit", name)
+	case strings.Contains(name, ".."):
+		return fmt.Errorf("S3 bucket name is invalid: %s. must not contain consecutive dots", name)
+	case net.ParseIP(name) != nil:
+		return fmt.Errorf("S3 bucket name is invalid: %s. must not be formatted as an IP address", name)
+	case strings.HasPrefix(name, "xn--") || strings.HasSuffix(name, "-s3alias"):
+		return fmt.Errorf("S3 bucket name is invalid: %s. uses a reserved prefix or suffix", name)
+	}
+
+	return nil
+}
+
+// validateCORS checks the origin list, which prod must spell out explicitly
+func (h *HttpServerParams) validateCORS(strict bool) error {
+	if len(h.CORSMethods) == 0 {
+		return fmt.Errorf("cors_methods must not be empty")
+	}
+
+	if len(h.CORSOrigins) == 0 {
+		if strict {
+			return fmt.Errorf("cors_origins is required in prod")
+		}
+		return nil
+	}
+
+	for _, origin := range h.CORSOrigins {
+		if origin == "*" {
+			if strict {
+				return fmt.Errorf("cors_origins must not contain * in prod")
+			}
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("cors origin is invalid: %s. expected scheme://host[:port]", origin)
+		}
+		if strict && strings.Contains(u.Host, "*") {
+			return fmt.Errorf("cors origin must not use wildcards in prod: %s", origin)
+		}
+	}
+
+	return nil
+}
+
 func (c *Config) Validate() error {
-	// Checking secret key
-	if c.GeneralParams.SecretKey == "" {
-		return fmt.Errorf("parameter secret_key is required")
+	// Checking token signing
+	switch c.GeneralParams.SigningAlgorithm {
+	case "HS256":
+		if c.GeneralParams.SecretKey == "" {
+			return fmt.Errorf("parameter secret_key is required for HS256")
+		}
+	case "RS256", "ES256":
+		if c.GeneralParams.PrivateKeyPath == "" {
+			return fmt.Errorf("parameter private_key_path is required for %s", c.GeneralParams.SigningAlgorithm)
+		}
+	default:
+		return fmt.Errorf("signing_algorithm is invalid: %s. try HS256/RS256/ES256 instead", c.GeneralParams.SigningAlgorithm)
+	}
+	if c.GeneralParams.AccessTokenTTL <= 0 {
+		return fmt.Errorf("parameter access_token_ttl must be positive")
 	}
-	if c.GeneralParams.AccessTokenTTL == 0 {
-		return fmt.Errorf("parameter access_token_ttl is required")
+	if c.GeneralParams.RefreshTokenTTL <= 0 {
+		return fmt.Errorf("parameter refresh_token_ttl must be positive")
 	}
-	if c.GeneralParams.AccessTokenTTL == 0 {
-		return fmt.Errorf("parameter refresh_token is required")
+	if c.GeneralParams.AccessTokenTTL >= c.GeneralParams.RefreshTokenTTL*24*60 {
+		return fmt.Errorf("access_token_ttl (minutes) must be shorter than refresh_token_ttl (days)")
+	}
+	for _, raw := range c.GeneralParams.AdminUserIDs {
+		if _, err := uuid.Parse(raw); err != nil {
+			return fmt.Errorf("admin_user_ids contains an invalid user ID: %s", raw)
+		}
 	}
 
 	// Checking out enviroment variable
@@ -157,6 +598,9 @@ func (c *Config) Validate() error {
 	if c.HttpServerParams.Port == "" {
 		return fmt.Errorf("%s: http server port is required", c.HttpServerParams.Port)
 	}
+	if err := c.HttpServerParams.validateCORS(c.GeneralParams.Env == "prod"); err != nil {
+		return err
+	}
 
 	// Checking MainDbparams
 	for name, mainDbConf := range map[string]MainDBParams{
@@ -171,8 +615,9 @@ func (c *Config) Validate() error {
 		if mainDbConf.Password == "" {
 			return fmt.Errorf("%s: password is requred", name)
 		}
-		if mainDbConf.Port != 5432 {
-			return fmt.Errorf("%s: port is invalid", name)
+		// Reachability is checked when the pool pings the database at startup
+		if mainDbConf.Port < 1 || mainDbConf.Port > 65535 {
+			return fmt.Errorf("%s: port is invalid: %d. expected 1-65535", name, mainDbConf.Port)
 		}
 	}
 
@@ -189,6 +634,80 @@ func (c *Config) Validate() error {
 	if c.S3Params.BucketName == "" {
 		return fmt.Errorf("S3 bucket name is required")
 	}
+	if err := c.S3Params.validate(); err != nil {
+		return err
+	}
+
+	// Checking voice params
+	if len(c.VoiceParams.EnabledFormats) == 0 {
+		return fmt.Errorf("at least one audio format must be enabled")
+	}
+	for _, name := range c.VoiceParams.EnabledFormats {
+		if _, ok := audio.Lookup(name); !ok {
+			return fmt.Errorf("unknown audio format in enabled_formats: %s", name)
+		}
+	}
+	if c.VoiceParams.MaxSampleRate < 0 || c.VoiceParams.MaxChannels < 0 || c.VoiceParams.MaxBitrateKbps < 0 {
+		return fmt.Errorf("voice quality limits must not be negative")
+	}
+	if c.VoiceParams.MaxUploadBytes <= 0 || c.VoiceParams.MaxDurationSeconds <= 0 || c.VoiceParams.URLExpiry <= 0 {
+		return fmt.Errorf("voice max_upload_bytes, max_duration_seconds and url_expiry must be positive")
+	}
+	if c.VoiceParams.ReconcileInterval < 0 {
+		return fmt.Errorf("voice reconcile_interval must not be negative")
+	}
+	if c.VoiceParams.DeleteGracePeriod < 0 {
+		return fmt.Errorf("voice delete_grace_period must not be negative")
+	}
+	if c.VoiceParams.TranscodeEnabled && c.VoiceParams.TranscodeTimeout <= 0 {
+		return fmt.Errorf("voice transcode_timeout must be positive when transcoding is enabled")
+	}
+	if c.VoiceParams.STTURL != "" && c.VoiceParams.STTTimeout <= 0 {
+		return fmt.Errorf("voice stt_timeout must be positive when stt_url is set")
+	}
+
+	// Checking login lockout params
+	if c.LoginParams.MaxAttempts < 0 {
+		return fmt.Errorf("login max_attempts must not be negative")
+	}
+	if c.LoginParams.MaxAttempts > 0 && (c.LoginParams.Window <= 0 || c.LoginParams.Lockout <= 0) {
+		return fmt.Errorf("login window and lockout must be positive when lockout is enabled")
+	}
+
+	// Checking mail params
+	if c.MailParams.SMTPHost != "" && c.MailParams.From == "" {
+		return fmt.Errorf("mail from address is required when smtp_host is set")
+	}
+
+	if c.HttpServerParams.RequestTimeout < 0 {
+		return fmt.Errorf("http request_timeout must not be negative")
+	}
+
+	// Checking rate limits
+	if c.RateLimitParams.Enabled {
+		if c.RateLimitParams.AuthPerMinute <= 0 || c.RateLimitParams.AuthBurst <= 0 {
+			return fmt.Errorf("rate limit auth_per_minute and auth_burst must be positive")
+		}
+		if c.RateLimitParams.UserPerSecond <= 0 || c.RateLimitParams.UserBurst <= 0 {
+			return fmt.Errorf("rate limit user_per_second and user_burst must be positive")
+		}
+	}
+
+	// Checking room params
+	if c.RoomParams.MaxParticipants < 0 {
+		return fmt.Errorf("room max_participants must not be negative")
+	}
+
+	// Checking websocket params
+	if c.WebsocketParams.DropAlertThreshold < 0 {
+		return fmt.Errorf("websocket drop_alert_threshold must not be negative")
+	}
+	if c.WebsocketParams.DropAlertWindow <= 0 {
+		return fmt.Errorf("websocket drop_alert_window must be positive")
+	}
+	if c.WebsocketParams.MaxClientsPerRoom < 0 || c.WebsocketParams.MaxConnectionsPerUser < 0 {
+		return fmt.Errorf("websocket connection limits must not be negative")
+	}
 
 	return nil
 }
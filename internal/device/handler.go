@@ -0,0 +1,105 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+const maxTokenLen = 4096
+
+type Handler struct {
+	store     Store
+	log       *slog.Logger
+	dbTimeout time.Duration
+}
+
+func NewHandler(store Store, log *slog.Logger, dbTimeout time.Duration) *Handler {
+	if dbTimeout == 0 {
+		dbTimeout = time.Second * 5
+	}
+	return &Handler{store, log, dbTimeout}
+}
+
+func (h *Handler) RegisterRoutes(r chi.Router) {
+	r.Post("/", httputil.Handler(h.HandleRegisterDevice, h.log))
+	r.Delete("/{token}", httputil.Handler(h.HandleUnregisterDevice, h.log))
+}
+
+func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), h.dbTimeout)
+}
+
+// HandleRegisterDevice stores a push token for the authenticated user
+func (h *Handler) HandleRegisterDevice(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+
+	req := new(RegisterDeviceRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if req.Token == "" || len(req.Token) > maxTokenLen {
+		return httputil.BadRequest("token is required")
+	}
+	if !slices.Contains([]string{PlatformAndroid, PlatformIOS, PlatformWeb}, req.Platform) {
+		return httputil.BadRequest("platform must be one of android, ios, web")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	device := &DeviceToken{
+		UserID:   userID,
+		Token:    req.Token,
+		Platform: req.Platform,
+	}
+	if err := h.store.RegisterDevice(ctx, device); err != nil {
+		log.Error("failed to register device",
+			"user_id", userID,
+			"platform", req.Platform,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Info("device registered",
+		"user_id", userID,
+		"platform", device.Platform)
+
+	return httputil.RespondJSON(w, http.StatusCreated, device)
+}
+
+// HandleUnregisterDevice removes one of the authenticated user's push tokens
+func (h *Handler) HandleUnregisterDevice(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	token := chi.URLParam(r, "token")
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	if err := h.store.UnregisterDevice(ctx, userID, token); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Device not found")
+		}
+		log.Error("failed to unregister device",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Info("device unregistered", "user_id", userID)
+
+	return httputil.RespondJSON(w, http.StatusNoContent, map[string]string{
+		"message": "Device unregistered successfully",
+	})
+}
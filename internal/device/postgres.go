@@ -0,0 +1,90 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var _ Store = (*PostgresStore)(nil)
+
+type PostgresStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{pool}
+}
+
+// RegisterDevice upserts the token. A token belongs to one device, so if
+// another account registered it before, it's moved to this user
+func (s *PostgresStore) RegisterDevice(ctx context.Context, device *DeviceToken) error {
+	query := `
+		INSERT INTO device_tokens (id, user_id, token, platform, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (token) DO UPDATE
+		SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform, updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.pool.QueryRow(ctx, query,
+		uuid.New(),
+		device.UserID,
+		device.Token,
+		device.Platform,
+		time.Now(),
+	).Scan(&device.ID, &device.CreatedAt, &device.UpdatedAt)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("operation cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to register device: %w", err)
+	}
+
+	return nil
+}
+
+// UnregisterDevice removes one of the user's tokens
+func (s *PostgresStore) UnregisterDevice(ctx context.Context, userID uuid.UUID, token string) error {
+	query := `DELETE FROM device_tokens WHERE user_id = $1 AND token = $2`
+
+	result, err := s.pool.Exec(ctx, query, userID, token)
+	if err != nil {
+		return fmt.Errorf("failed to unregister device: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to unregister device: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetTokensForUsers returns the push tokens of all the given users
+func (s *PostgresStore) GetTokensForUsers(ctx context.Context, userIDs []uuid.UUID) ([]string, error) {
+	query := `SELECT token FROM device_tokens WHERE user_id = ANY($1)`
+
+	rows, err := s.pool.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []string{}
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, fmt.Errorf("failed to scan device token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating device tokens: %w", err)
+	}
+
+	return tokens, nil
+}
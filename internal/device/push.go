@@ -0,0 +1,50 @@
+package device
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/pkg/push"
+)
+
+// PushService sends notifications to every registered device of a set of users
+type PushService struct {
+	store    Store
+	notifier push.Notifier
+	log      *slog.Logger
+}
+
+func NewPushService(store Store, notifier push.Notifier, log *slog.Logger) *PushService {
+	return &PushService{store, notifier, log}
+}
+
+// NotifyUsers looks up the users' devices and sends them the notification.
+// Errors are logged, a failed push never fails the caller
+func (s *PushService) NotifyUsers(ctx context.Context, userIDs []uuid.UUID, n push.Notification) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	tokens, err := s.store.GetTokensForUsers(ctx, userIDs)
+	if err != nil {
+		s.log.Error("failed to load device tokens for push",
+			"users", len(userIDs),
+			"error", err)
+		return
+	}
+	if len(tokens) == 0 {
+		return
+	}
+
+	if err := s.notifier.Send(ctx, tokens, n); err != nil {
+		s.log.Warn("failed to send push notification",
+			"devices", len(tokens),
+			"error", err)
+		return
+	}
+
+	s.log.Debug("push notification sent",
+		"users", len(userIDs),
+		"devices", len(tokens))
+}
@@ -0,0 +1,19 @@
+package device
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrNotFound means the user has no such device token
+var ErrNotFound = errors.New("device not found")
+
+type Store interface {
+	// RegisterDevice saves the token for the user, moving it over if another user had it
+	RegisterDevice(ctx context.Context, device *DeviceToken) error
+	UnregisterDevice(ctx context.Context, userID uuid.UUID, token string) error
+	// GetTokensForUsers returns the push tokens of all the given users
+	GetTokensForUsers(ctx context.Context, userIDs []uuid.UUID) ([]string, error)
+}
@@ -0,0 +1,29 @@
+package device
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Supported device platforms
+const (
+	PlatformAndroid = "android"
+	PlatformIOS     = "ios"
+	PlatformWeb     = "web"
+)
+
+// DeviceToken is a push token registered by one of the user's devices
+type DeviceToken struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Token     string    `json:"token"`
+	Platform  string    `json:"platform"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RegisterDeviceRequest struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rx3lixir/laba_zis/internal/websocket"
+)
+
+const namespace = "laba_zis"
+
+// Registry holds all application metrics, Handler serves it
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// VoiceUploads counts successfully stored voice messages
+	VoiceUploads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "voice_uploads_total",
+		Help:      "Voice messages uploaded.",
+	})
+
+	// VoiceUploadBytes counts the bytes of successfully stored voice messages
+	VoiceUploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "voice_upload_bytes_total",
+		Help:      "Bytes of uploaded voice messages.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		VoiceUploads,
+		VoiceUploadBytes,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records request counts and latencies. Routes are labelled by
+// their chi pattern (/api/rooms/{roomID}) to keep cardinality bounded
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RegisterWebsocket exposes hub and client gauges read from the manager on every scrape
+func RegisterWebsocket(cm *websocket.ConnectionManager) {
+	Registry.MustRegister(&websocketCollector{cm})
+}
+
+var (
+	wsHubsDesc = prometheus.NewDesc(namespace+"_websocket_hubs",
+		"Active websocket room hubs.", nil, nil)
+	wsClientsDesc = prometheus.NewDesc(namespace+"_websocket_clients",
+		"Connected websocket clients across all hubs.", nil, nil)
+	wsSentDesc = prometheus.NewDesc(namespace+"_websocket_messages_sent",
+		"Messages delivered by the currently active hubs.", nil, nil)
+	wsDroppedDesc = prometheus.NewDesc(namespace+"_websocket_messages_dropped",
+		"Messages dropped by the currently active hubs.", nil, nil)
+	wsPingTimeoutsDesc = prometheus.NewDesc(namespace+"_websocket_ping_timeouts",
+		"Clients of the currently active hubs disconnected for missing pongs.", nil, nil)
+)
+
+// websocketCollector sums HubMetrics at scrape time. Hubs come and go, so the
+// message totals are gauges rather than counters
+type websocketCollector struct {
+	cm *websocket.ConnectionManager
+}
+
+func (c *websocketCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wsHubsDesc
+	ch <- wsClientsDesc
+	ch <- wsSentDesc
+	ch <- wsDroppedDesc
+	ch <- wsPingTimeoutsDesc
+}
+
+func (c *websocketCollector) Collect(ch chan<- prometheus.Metric) {
+	hubs := c.cm.GetMetrics()
+
+	var clients, sent, dropped, pingTimeouts float64
+	for _, m := range hubs {
+		clients += float64(m.ConnectedClients)
+		sent += float64(m.MessagesSent)
+		dropped += float64(m.MessagesDropped)
+		pingTimeouts += float64(m.PingTimeouts)
+	}
+
+	ch <- prometheus.MustNewConstMetric(wsHubsDesc, prometheus.GaugeValue, float64(len(hubs)))
+	ch <- prometheus.MustNewConstMetric(wsClientsDesc, prometheus.GaugeValue, clients)
+	ch <- prometheus.MustNewConstMetric(wsSentDesc, prometheus.GaugeValue, sent)
+	ch <- prometheus.MustNewConstMetric(wsDroppedDesc, prometheus.GaugeValue, dropped)
+	ch <- prometheus.MustNewConstMetric(wsPingTimeoutsDesc, prometheus.GaugeValue, pingTimeouts)
+}
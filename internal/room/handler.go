@@ -2,6 +2,8 @@ package room
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
@@ -10,40 +12,118 @@ import (
 	"github.com/google/uuid"
 	"github.com/rx3lixir/laba_zis/internal/auth"
 	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
 )
 
+// Notifier tells connected clients about membership changes,
+// the websocket connection manager implements it
+type Notifier interface {
+	// KickFromRoom announces the removal and disconnects the user from the room
+	KickFromRoom(roomID, userID, kickedBy uuid.UUID)
+	// AddedToRoom tells the user, wherever they are connected, about a room they joined
+	AddedToRoom(roomID, userID, addedBy uuid.UUID)
+}
+
+// defaultRoomsLimit is the page size of the room overview and admin listing
+const defaultRoomsLimit = 50
+
 type Handler struct {
 	store     Store
+	notifier  Notifier
 	log       *slog.Logger
 	dbTimeout time.Duration
+	cfg       Config
+}
+
+// Config holds the room handler settings
+type Config struct {
+	// MaxParticipants caps room size including the owner, 0 means unlimited
+	MaxParticipants int
+
+	// RequireVerifiedEmail keeps users with an unverified email from creating rooms
+	RequireVerifiedEmail bool
 }
 
-func NewHandler(store Store, log *slog.Logger, dbTimeout time.Duration) *Handler {
+// NewHandler accepts a nil notifier, connected clients then aren't told about membership changes
+func NewHandler(store Store, notifier Notifier, log *slog.Logger, dbTimeout time.Duration, cfg Config) *Handler {
 	if dbTimeout == 0 {
 		dbTimeout = time.Second * 5
 	}
-	return &Handler{store, log, dbTimeout}
+	return &Handler{store, notifier, log, dbTimeout, cfg}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Post("/", httputil.Handler(h.HandleCreateRoom, h.log))
+	r.Group(func(r chi.Router) {
+		r.Use(auth.RequireVerifiedEmail(h.cfg.RequireVerifiedEmail))
+		r.Post("/", httputil.Handler(h.HandleCreateRoom, h.log))
+		r.Post("/dm", httputil.Handler(h.HandleCreateDM, h.log))
+	})
 	r.Get("/", httputil.Handler(h.HandleGetUserRooms, h.log))
+	r.Get("/overview", httputil.Handler(h.HandleGetRoomsOverview, h.log))
 	r.Get("/{roomID}", httputil.Handler(h.HandleGetRoom, h.log))
+	r.Patch("/{roomID}", httputil.Handler(h.HandleUpdateRoom, h.log))
 	r.Delete("/{roomID}", httputil.Handler(h.HandleDeleteRoom, h.log))
 	r.Post("/{roomID}/participants", httputil.Handler(h.HandleAddParticipant, h.log))
 	r.Delete("/{roomID}/participants/{userID}", httputil.Handler(h.HandleRemoveParticipant, h.log))
+	r.Post("/{roomID}/leave", httputil.Handler(h.HandleLeaveRoom, h.log))
 	r.Get("/{roomID}/participants", httputil.Handler(h.HandleGetParticipants, h.log))
+	r.Put("/{roomID}/mute", httputil.Handler(h.HandleMuteRoom, h.log))
+}
+
+// RegisterAdminRoutes adds the routes mounted under /admin
+func (h *Handler) RegisterAdminRoutes(r chi.Router) {
+	r.Get("/rooms", httputil.Handler(h.HandleListAllRooms, h.log))
 }
 
 func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(r.Context(), h.dbTimeout)
 }
 
+// requireRole returns the user's role in the room, or a 403 if they aren't a member
+func (h *Handler) requireRole(ctx context.Context, roomID, userID uuid.UUID, action string) (string, error) {
+	log := logger.FromContext(ctx)
+	role, err := h.store.GetParticipantRole(ctx, roomID, userID)
+	if err != nil {
+		log.Error("failed to verify room membership",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return "", httputil.Internal(err)
+	}
+	if role == "" {
+		log.Warn(action+" blocked - user not in room",
+			"user_id", userID,
+			"room_id", roomID)
+		return "", httputil.Forbidden("You are not a member of this room")
+	}
+
+	return role, nil
+}
+
+// requireOwner returns a 403 unless the user owns the room
+func (h *Handler) requireOwner(ctx context.Context, roomID, userID uuid.UUID, action string) error {
+	log := logger.FromContext(ctx)
+	role, err := h.requireRole(ctx, roomID, userID, action)
+	if err != nil {
+		return err
+	}
+	if role != RoleOwner {
+		log.Warn(action+" blocked - user is not the owner",
+			"user_id", userID,
+			"room_id", roomID,
+			"role", role)
+		return httputil.Forbidden("Only the room owner can do this")
+	}
+
+	return nil
+}
+
 // HandleCreateRoom creates a new room with initial participants
 func (h *Handler) HandleCreateRoom(w http.ResponseWriter, r *http.Request) error {
-	creatorID := auth.GetUserID(r.Context())
-	if creatorID == uuid.Nil {
-		h.log.Debug("room creation attempt without authentication")
+	log := logger.FromContext(r.Context())
+	creatorID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		log.Debug("room creation attempt without authentication")
 		return httputil.Unauthorized("Unauthorized")
 	}
 
@@ -52,74 +132,141 @@ func (h *Handler) HandleCreateRoom(w http.ResponseWriter, r *http.Request) error
 		return err
 	}
 
-	h.log.Debug("room creation request received",
+	name, err := normalizeRoomName(req.Name)
+	if err != nil {
+		return httputil.BadRequest("Validation failed", map[string]string{
+			"validation_error": err.Error(),
+		})
+	}
+
+	log.Debug("room creation request received",
 		"creator_id", creatorID,
 		"participant_count", len(req.ParticipantIDs))
 
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	room := &Room{}
-
-	if err := h.store.CreateRoom(ctx, room); err != nil {
-		h.log.Error("failed to create room in database",
-			"creator_id", creatorID,
-			"error", err)
-		return httputil.Internal(err)
-	}
-
-	// Add creator as participant
-	participants := []*RoomParticipant{
-		{RoomID: room.ID, UserID: creatorID},
-	}
+	room := &Room{Name: name}
 
-	// Add other participants
+	// The creator joins as owner, everyone else once as a member
+	memberIDs := make([]uuid.UUID, 0, len(req.ParticipantIDs))
+	seen := map[uuid.UUID]bool{creatorID: true}
 	for _, userID := range req.ParticipantIDs {
-		if userID != creatorID {
-			participants = append(participants, &RoomParticipant{
-				RoomID: room.ID,
-				UserID: userID,
-			})
+		if !seen[userID] {
+			seen[userID] = true
+			memberIDs = append(memberIDs, userID)
 		}
 	}
 
-	addedParticipants := []RoomParticipant{}
+	if h.cfg.MaxParticipants > 0 && len(memberIDs)+1 > h.cfg.MaxParticipants {
+		return httputil.BadRequest(
+			fmt.Sprintf("A room can have at most %d participants", h.cfg.MaxParticipants),
+			map[string]int{"requested": len(memberIDs) + 1, "max_participants": h.cfg.MaxParticipants},
+		)
+	}
 
-	// Adding all participants into database
-	for _, p := range participants {
-		if err := h.store.AddParticipant(ctx, p); err != nil {
-			h.log.Error("failed to add participant during room creation",
-				"room_id", room.ID,
-				"participant_id", p.UserID,
+	if len(memberIDs) > 0 {
+		missing, err := h.store.MissingUsers(ctx, memberIDs)
+		if err != nil {
+			log.Error("failed to check room participants exist",
 				"creator_id", creatorID,
 				"error", err)
 			return httputil.Internal(err)
 		}
-		addedParticipants = append(addedParticipants, *p)
+		if len(missing) > 0 {
+			return httputil.BadRequest("Unknown participant IDs",
+				map[string][]uuid.UUID{"unknown_user_ids": missing})
+		}
+	}
+
+	participants, err := h.store.CreateRoomWithParticipants(ctx, room, creatorID, memberIDs)
+	if err != nil {
+		log.Error("failed to create room in database",
+			"creator_id", creatorID,
+			"participant_count", len(memberIDs)+1,
+			"error", err)
+		return httputil.Internal(err)
 	}
 
-	h.log.Info("room created successfully",
+	log.Info("room created successfully",
 		"room_id", room.ID,
 		"creator_id", creatorID,
 		"participant_count", len(participants))
 
 	response := CreateRoomResponse{
 		Room:         *room,
-		Participants: addedParticipants,
+		Participants: participants,
 	}
 
 	return httputil.RespondJSON(w, http.StatusCreated, response)
 }
 
+// HandleCreateDM returns the direct-message room with another user, creating it on first use
+func (h *Handler) HandleCreateDM(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+
+	req := new(CreateDMRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if req.UserID == uuid.Nil {
+		return httputil.BadRequest("user_id is required")
+	}
+	if req.UserID == userID {
+		return httputil.BadRequest("Cannot start a direct message with yourself")
+	}
+
+	log.Debug("create dm request",
+		"user_id", userID,
+		"target_id", req.UserID)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	exists, err := h.store.UserExists(ctx, req.UserID)
+	if err != nil {
+		log.Error("failed to check dm target exists",
+			"target_id", req.UserID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !exists {
+		return httputil.NotFound("User not found")
+	}
+
+	dm, created, err := h.store.GetOrCreateDMRoom(ctx, userID, req.UserID)
+	if err != nil {
+		log.Error("failed to get or create dm room",
+			"user_id", userID,
+			"target_id", req.UserID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		log.Info("dm room created",
+			"room_id", dm.Room.ID,
+			"user_id", userID,
+			"target_id", req.UserID)
+	}
+
+	return httputil.RespondJSON(w, status, dm)
+}
+
 // HandleGetRoom gets room details with participants
 func (h *Handler) HandleGetRoom(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	roomID, err := httputil.ParseUUID(r, "roomID")
 	if err != nil {
 		return err
 	}
 
-	h.log.Debug("get room request",
+	log.Debug("get room request",
 		"user_id", userID,
 		"room_id", roomID)
 
@@ -128,7 +275,7 @@ func (h *Handler) HandleGetRoom(w http.ResponseWriter, r *http.Request) error {
 
 	isInRoom, err := h.store.IsUserInRoom(ctx, roomID, userID)
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		log.Error("failed to verify room membership",
 			"user_id", userID,
 			"room_id", roomID,
 			"error", err)
@@ -136,7 +283,7 @@ func (h *Handler) HandleGetRoom(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if !isInRoom {
-		h.log.Warn("get room blocked - user not in room",
+		log.Warn("get room blocked - user not in room",
 			"user_id", userID,
 			"room_id", roomID)
 		return httputil.Forbidden("You are not a member of this room")
@@ -144,15 +291,18 @@ func (h *Handler) HandleGetRoom(w http.ResponseWriter, r *http.Request) error {
 
 	room, err := h.store.GetRoomByID(ctx, roomID)
 	if err != nil {
-		h.log.Error("failed to retrieve room from database",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Room not found")
+		}
+		log.Error("failed to retrieve room from database",
 			"room_id", roomID,
 			"error", err)
-		return httputil.NotFound("Room not found")
+		return httputil.Internal(err)
 	}
 
 	participants, err := h.store.GetRoomParticipants(ctx, roomID)
 	if err != nil {
-		h.log.Error("failed to retrieve room participants",
+		log.Error("failed to retrieve room participants",
 			"room_id", roomID,
 			"error", err)
 		return httputil.Internal(err)
@@ -163,7 +313,7 @@ func (h *Handler) HandleGetRoom(w http.ResponseWriter, r *http.Request) error {
 		participantsList[i] = *p
 	}
 
-	h.log.Debug("room retrieved",
+	log.Debug("room retrieved",
 		"room_id", roomID,
 		"participant_count", len(participants))
 
@@ -177,36 +327,74 @@ func (h *Handler) HandleGetRoom(w http.ResponseWriter, r *http.Request) error {
 
 // HandleGetUserRooms gets all rooms the authenticated user is part of
 func (h *Handler) HandleGetUserRooms(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 
-	h.log.Debug("get user rooms request",
+	log.Debug("get user rooms request",
 		"user_id", userID)
 
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	rooms, err := h.store.GetUserRooms(ctx, userID)
-	if err != nil {
-		h.log.Error("failed to get user rooms from database",
+	var roomResponses []RoomResponse
+	rooms, err := h.store.GetRoomsWithParticipants(ctx, userID)
+	if err == nil {
+		roomResponses = make([]RoomResponse, len(rooms))
+		for i, room := range rooms {
+			roomResponses[i] = RoomResponse{
+				Room:         room.Room,
+				Participants: room.Participants,
+			}
+		}
+	} else {
+		// The join fails as a whole, so fall back to loading room by room
+		// and flag the rooms whose participants still can't be loaded
+		log.Warn("failed to load user rooms with participants, loading per room",
 			"user_id", userID,
 			"error", err)
-		return httputil.Internal(err)
+
+		roomResponses, err = h.loadUserRoomsPerRoom(ctx, userID)
+		if err != nil {
+			log.Error("failed to get user rooms from database",
+				"user_id", userID,
+				"error", err)
+			return httputil.Internal(err)
+		}
 	}
 
-	// TODO: N+1 query problem – replace with batch loading when scaling
-	// Consider adding GetRoomsWithParticipants(ctx, userID)
+	log.Debug("user rooms retrieved",
+		"user_id", userID,
+		"room_count", len(roomResponses))
 
-	roomResponses := make([]RoomResponse, 0, len(rooms))
+	response := GetUserRoomsResponse{
+		Rooms: roomResponses,
+		Count: len(roomResponses),
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, response)
+}
 
-	// Get participants for each room
+// loadUserRoomsPerRoom lists the user's rooms and loads participants one room at
+// a time. A failed load keeps the room in the list with the
+// participants_unavailable flag instead of dropping it
+func (h *Handler) loadUserRoomsPerRoom(ctx context.Context, userID uuid.UUID) ([]RoomResponse, error) {
+	log := logger.FromContext(ctx)
+	rooms, err := h.store.GetUserRooms(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roomResponses := make([]RoomResponse, 0, len(rooms))
 	for _, room := range rooms {
+		unavailable := false
 		participants, err := h.store.GetRoomParticipants(ctx, room.ID)
 		if err != nil {
-			h.log.Warn("failed to load participants for room",
+			log.Warn("failed to load participants for room",
 				"room_id", room.ID,
 				"user_id", userID,
 				"error", err)
 			participants = nil
+			unavailable = true
 		}
 
 		plist := make([]RoomParticipant, len(participants))
@@ -215,64 +403,141 @@ func (h *Handler) HandleGetUserRooms(w http.ResponseWriter, r *http.Request) err
 		}
 
 		roomResponses = append(roomResponses, RoomResponse{
-			Room:         *room,
-			Participants: plist,
+			Room:                    *room,
+			Participants:            plist,
+			ParticipantsUnavailable: unavailable,
 		})
 	}
 
-	h.log.Debug("user rooms retrieved",
+	return roomResponses, nil
+}
+
+// HandleGetRoomsOverview returns the chat list: the user's rooms by last
+// activity, each with its latest message and unread count
+func (h *Handler) HandleGetRoomsOverview(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+
+	page, err := httputil.ParsePagination(r, defaultRoomsLimit)
+	if err != nil {
+		return err
+	}
+	limit, offset := page.Limit, page.Offset
+
+	log.Debug("get rooms overview request",
 		"user_id", userID,
-		"room_count", len(roomResponses))
+		"limit", limit,
+		"offset", offset)
 
-	response := GetUserRoomsResponse{
-		Rooms: roomResponses,
-		Count: len(roomResponses),
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	rooms, err := h.store.GetRoomsOverview(ctx, userID, limit, offset)
+	if err != nil {
+		log.Error("failed to get rooms overview from database",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	response := RoomsOverviewResponse{
+		Rooms:  rooms,
+		Count:  len(rooms),
+		Limit:  limit,
+		Offset: offset,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
-// HandleDeleteRoom deletes a room (only if user is a participant)
-func (h *Handler) HandleDeleteRoom(w http.ResponseWriter, r *http.Request) error {
+// HandleUpdateRoom renames a room, only its owner may
+func (h *Handler) HandleUpdateRoom(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	roomID, err := httputil.ParseUUID(r, "roomID")
 	if err != nil {
 		return err
 	}
 
-	h.log.Debug("delete room request",
+	req := new(UpdateRoomRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if req.Name == nil {
+		return httputil.BadRequest("Validation failed", map[string]string{
+			"validation_error": "name is required",
+		})
+	}
+	name, err := normalizeRoomName(req.Name)
+	if err != nil {
+		return httputil.BadRequest("Validation failed", map[string]string{
+			"validation_error": err.Error(),
+		})
+	}
+
+	log.Debug("update room request",
 		"user_id", userID,
 		"room_id", roomID)
 
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	// Check if user is in the room
-	isInRoom, err := h.store.IsUserInRoom(ctx, roomID, userID)
+	if err := h.requireOwner(ctx, roomID, userID, "update room"); err != nil {
+		return err
+	}
+
+	room, err := h.store.UpdateRoomName(ctx, roomID, *name)
 	if err != nil {
-		h.log.Error("failed to verify room membership",
-			"user_id", userID,
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Room not found")
+		}
+		log.Error("failed to rename room",
 			"room_id", roomID,
+			"user_id", userID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	if !isInRoom {
-		h.log.Warn("delete room blocked - user not in room",
-			"user_id", userID,
-			"room_id", roomID)
-		return httputil.Forbidden("You are not a member of this room")
+	log.Info("room renamed",
+		"room_id", roomID,
+		"renamed_by", userID)
+
+	return httputil.RespondJSON(w, http.StatusOK, room)
+}
+
+// HandleDeleteRoom deletes a room, only its owner may
+func (h *Handler) HandleDeleteRoom(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	roomID, err := httputil.ParseUUID(r, "roomID")
+	if err != nil {
+		return err
+	}
+
+	log.Debug("delete room request",
+		"user_id", userID,
+		"room_id", roomID)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	if err := h.requireOwner(ctx, roomID, userID, "delete room"); err != nil {
+		return err
 	}
 
 	if err := h.store.DeleteRoom(ctx, roomID); err != nil {
-		h.log.Error("failed to delete room from database",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Room not found")
+		}
+		log.Error("failed to delete room from database",
 			"room_id", roomID,
 			"user_id", userID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("room deleted successfully",
+	log.Info("room deleted successfully",
 		"room_id", roomID,
 		"deleted_by", userID)
 
@@ -281,6 +546,7 @@ func (h *Handler) HandleDeleteRoom(w http.ResponseWriter, r *http.Request) error
 
 // HandleAddParticipant adds a user to the room
 func (h *Handler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	roomID, err := httputil.ParseUUID(r, "roomID")
 	if err != nil {
@@ -292,7 +558,7 @@ func (h *Handler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
-	h.log.Debug("add participant request",
+	log.Debug("add participant request",
 		"requester_id", userID,
 		"room_id", roomID,
 		"participant_id", req.UserID)
@@ -300,20 +566,57 @@ func (h *Handler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) e
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	// Check if requester is in the room
-	isInRoom, err := h.store.IsUserInRoom(ctx, roomID, userID)
+	role, err := h.requireRole(ctx, roomID, userID, "add participant")
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		return err
+	}
+
+	// DM rooms have no owner, so check the type before the role
+	room, err := h.store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Room not found")
+		}
+		log.Error("failed to retrieve room from database",
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if room.Type == RoomTypeDM {
+		return httputil.BadRequest("Cannot add participants to a direct message room")
+	}
+
+	if role != RoleOwner {
+		log.Warn("add participant blocked - user is not the owner",
 			"user_id", userID,
 			"room_id", roomID,
+			"role", role)
+		return httputil.Forbidden("Only the room owner can do this")
+	}
+
+	exists, err := h.store.UserExists(ctx, req.UserID)
+	if err != nil {
+		log.Error("failed to check participant exists",
+			"participant_id", req.UserID,
 			"error", err)
 		return httputil.Internal(err)
 	}
-	if !isInRoom {
-		h.log.Warn("add participant blocked - requester not in room",
-			"requester_id", userID,
-			"room_id", roomID)
-		return httputil.Forbidden("You are not a member of this room")
+	if !exists {
+		return httputil.NotFound("User not found")
+	}
+
+	// Best effort, two adds racing for the last slot can both pass
+	if h.cfg.MaxParticipants > 0 {
+		count, err := h.store.CountParticipants(ctx, roomID)
+		if err != nil {
+			log.Error("failed to count participants",
+				"room_id", roomID,
+				"error", err)
+			return httputil.Internal(err)
+		}
+		if count >= h.cfg.MaxParticipants {
+			return httputil.Conflict(fmt.Sprintf("Room is full, it can have at most %d participants", h.cfg.MaxParticipants))
+		}
 	}
 
 	participant := &RoomParticipant{
@@ -322,7 +625,10 @@ func (h *Handler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) e
 	}
 
 	if err := h.store.AddParticipant(ctx, participant); err != nil {
-		h.log.Error("failed to add participant to room",
+		if errors.Is(err, ErrAlreadyParticipant) {
+			return httputil.Conflict("User is already a member of this room")
+		}
+		log.Error("failed to add participant to room",
 			"room_id", roomID,
 			"participant_id", req.UserID,
 			"added_by", userID,
@@ -330,7 +636,11 @@ func (h *Handler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) e
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("participant added successfully",
+	if h.notifier != nil {
+		h.notifier.AddedToRoom(roomID, req.UserID, userID)
+	}
+
+	log.Info("participant added successfully",
 		"room_id", roomID,
 		"participant_id", req.UserID,
 		"added_by", userID)
@@ -340,6 +650,7 @@ func (h *Handler) HandleAddParticipant(w http.ResponseWriter, r *http.Request) e
 
 // HandleRemoveParticipant removes a user from the room
 func (h *Handler) HandleRemoveParticipant(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	requestingUserID := auth.GetUserID(r.Context())
 	roomID, err := httputil.ParseUUID(r, "roomID")
 	if err != nil {
@@ -351,65 +662,106 @@ func (h *Handler) HandleRemoveParticipant(w http.ResponseWriter, r *http.Request
 		return httputil.BadRequest("Invalid user ID")
 	}
 
-	h.log.Debug("remove participant request",
+	log.Debug("remove participant request",
 		"requester_id", requestingUserID,
 		"room_id", roomID,
 		"participant_id", userIDToRemove)
 
+	// Removing yourself is leaving, which hands ownership on and deletes the
+	// room once it's empty
+	if userIDToRemove == requestingUserID {
+		return h.HandleLeaveRoom(w, r)
+	}
+
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	// Check if requester is in the room
-	isInRoom, err := h.store.IsUserInRoom(ctx, roomID, requestingUserID)
+	// Removing others is up to the owner
+	role, err := h.requireRole(ctx, roomID, requestingUserID, "remove participant")
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		return err
+	}
+	if role != RoleOwner {
+		log.Warn("remove participant blocked - user is not the owner",
 			"user_id", requestingUserID,
 			"room_id", roomID,
+			"participant_id", userIDToRemove)
+		return httputil.Forbidden("Only the room owner can remove other participants, members can only remove themselves")
+	}
+
+	if err := h.store.RemoveParticipant(ctx, roomID, userIDToRemove); err != nil {
+		if errors.Is(err, ErrNotParticipant) {
+			return httputil.NotFound("User is not a member of this room")
+		}
+		log.Error("failed to remove participant from room",
+			"room_id", roomID,
+			"participant_id", userIDToRemove,
 			"error", err)
 		return httputil.Internal(err)
 	}
-	if !isInRoom {
-		h.log.Warn("remove participant blocked - requester not in room",
-			"requester_id", requestingUserID,
-			"room_id", roomID)
-		return httputil.Forbidden("You are not a member of this room")
+
+	if h.notifier != nil {
+		h.notifier.KickFromRoom(roomID, userIDToRemove, requestingUserID)
 	}
 
-	// Users can only remove themselves (add admin logic later)
-	if userIDToRemove != requestingUserID {
-		h.log.Warn("remove participant blocked - can only remove self",
-			"requester_id", requestingUserID,
-			"target_id", userIDToRemove,
-			"room_id", roomID)
-		return httputil.Forbidden("You can only remove yourself from room")
+	log.Info("participant removed successfully",
+		"room_id", roomID,
+		"participant_id", userIDToRemove)
+
+	return httputil.RespondJSON(w, http.StatusNoContent, map[string]string{
+		"message": "Participant removed successfully",
+	})
+}
+
+// HandleLeaveRoom removes the authenticated user from the room
+func (h *Handler) HandleLeaveRoom(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	roomID, err := httputil.ParseUUID(r, "roomID")
+	if err != nil {
+		return err
 	}
 
-	if err := h.store.RemoveParticipant(ctx, roomID, userIDToRemove); err != nil {
-		h.log.Error("failed to remove participant from room",
+	log.Debug("leave room request",
+		"user_id", userID,
+		"room_id", roomID)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	result, err := h.store.LeaveRoom(ctx, roomID, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotParticipant) {
+			return httputil.NotFound("You are not a member of this room")
+		}
+		log.Error("failed to leave room",
+			"user_id", userID,
 			"room_id", roomID,
-			"participant_id", userIDToRemove,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("participant removed successfully",
+	log.Info("user left room",
+		"user_id", userID,
 		"room_id", roomID,
-		"participant_id", userIDToRemove)
+		"room_deleted", result.RoomDeleted,
+		"new_owner_id", result.NewOwnerID)
 
 	return httputil.RespondJSON(w, http.StatusNoContent, map[string]string{
-		"message": "Participant removed successfully",
+		"message": "Left room successfully",
 	})
 }
 
 // HandleGetParticipants gets all participants in a room
 func (h *Handler) HandleGetParticipants(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	roomID, err := httputil.ParseUUID(r, "roomID")
 	if err != nil {
 		return err
 	}
 
-	h.log.Debug("get participants request",
+	log.Debug("get participants request",
 		"user_id", userID,
 		"room_id", roomID)
 
@@ -419,14 +771,14 @@ func (h *Handler) HandleGetParticipants(w http.ResponseWriter, r *http.Request)
 	// Check if user is in the room
 	isInRoom, err := h.store.IsUserInRoom(ctx, roomID, userID)
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		log.Error("failed to verify room membership",
 			"user_id", userID,
 			"room_id", roomID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 	if !isInRoom {
-		h.log.Warn("get participants blocked - user not in room",
+		log.Warn("get participants blocked - user not in room",
 			"user_id", userID,
 			"room_id", roomID)
 		return httputil.Forbidden("You are not a member of this room")
@@ -434,7 +786,7 @@ func (h *Handler) HandleGetParticipants(w http.ResponseWriter, r *http.Request)
 
 	participants, err := h.store.GetRoomParticipants(ctx, roomID)
 	if err != nil {
-		h.log.Error("failed to retrieve room participants",
+		log.Error("failed to retrieve room participants",
 			"room_id", roomID,
 			"error", err)
 		return httputil.Internal(err)
@@ -446,7 +798,7 @@ func (h *Handler) HandleGetParticipants(w http.ResponseWriter, r *http.Request)
 		participantsList[i] = *p
 	}
 
-	h.log.Debug("participants retrieved",
+	log.Debug("participants retrieved",
 		"room_id", roomID,
 		"participant_count", len(participantsList))
 
@@ -457,3 +809,106 @@ func (h *Handler) HandleGetParticipants(w http.ResponseWriter, r *http.Request)
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
+
+// HandleMuteRoom sets the authenticated user's mute preference for a room
+func (h *Handler) HandleMuteRoom(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	roomID, err := httputil.ParseUUID(r, "roomID")
+	if err != nil {
+		return err
+	}
+
+	req := new(MuteRoomRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if req.MutedUntil != nil && !req.MutedUntil.After(time.Now()) {
+		return httputil.BadRequest("muted_until must be in the future")
+	}
+
+	log.Debug("mute room request",
+		"user_id", userID,
+		"room_id", roomID,
+		"muted", req.Muted)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	isInRoom, err := h.store.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		log.Error("failed to verify room membership",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !isInRoom {
+		log.Warn("mute room blocked - user not in room",
+			"user_id", userID,
+			"room_id", roomID)
+		return httputil.Forbidden("You are not a member of this room")
+	}
+
+	participant, err := h.store.SetParticipantMute(ctx, roomID, userID, req.Muted, req.MutedUntil)
+	if err != nil {
+		if errors.Is(err, ErrNotParticipant) {
+			return httputil.Forbidden("You are not a member of this room")
+		}
+		log.Error("failed to update mute preference",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Info("room mute preference updated",
+		"user_id", userID,
+		"room_id", roomID,
+		"muted", participant.Muted)
+
+	return httputil.RespondJSON(w, http.StatusOK, participant)
+}
+
+// HandleListAllRooms lists every room in the system for admins
+func (h *Handler) HandleListAllRooms(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	page, err := httputil.ParsePagination(r, defaultRoomsLimit)
+	if err != nil {
+		return err
+	}
+	limit, offset := page.Limit, page.Offset
+
+	log.Debug("list all rooms request",
+		"user_id", auth.GetUserID(r.Context()),
+		"limit", limit,
+		"offset", offset)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	rooms, err := h.store.ListRooms(ctx, limit, offset)
+	if err != nil {
+		log.Error("failed to list rooms",
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	total, err := h.store.CountRooms(ctx)
+	if err != nil {
+		log.Error("failed to count rooms",
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	response := ListRoomsResponse{
+		Rooms:      rooms,
+		TotalCount: total,
+		Limit:      limit,
+		Offset:     offset,
+		HasMore:    offset+len(rooms) < total,
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,90 @@
+package room
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// flakyParticipantsStore fails the joined room query and the participant load of one room
+type flakyParticipantsStore struct {
+	Store
+
+	rooms      []*Room
+	failRoomID uuid.UUID
+}
+
+func (s *flakyParticipantsStore) GetRoomsWithParticipants(ctx context.Context, userID uuid.UUID) ([]RoomWithParticipants, error) {
+	return nil, errors.New("join failed")
+}
+
+func (s *flakyParticipantsStore) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]*Room, error) {
+	return s.rooms, nil
+}
+
+func (s *flakyParticipantsStore) GetRoomParticipants(ctx context.Context, roomID uuid.UUID) ([]*RoomParticipant, error) {
+	if roomID == s.failRoomID {
+		return nil, errors.New("participants unavailable")
+	}
+	return []*RoomParticipant{{ID: uuid.New(), RoomID: roomID, UserID: uuid.New(), Role: RoleOwner}}, nil
+}
+
+func TestGetUserRoomsFlagsRoomsWithoutParticipants(t *testing.T) {
+	ok := &Room{ID: uuid.New(), Type: RoomTypeGroup}
+	broken := &Room{ID: uuid.New(), Type: RoomTypeGroup}
+	store := &flakyParticipantsStore{rooms: []*Room{ok, broken}, failRoomID: broken.ID}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewHandler(store, nil, log, time.Second, Config{})
+
+	authService := auth.NewService(auth.NewHMACSigner("test-secret"), time.Minute, time.Hour, nil)
+	token, err := authService.GenerateAccessToken(uuid.New(), "user@example.com", "user", auth.RoleUser, true)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	auth.Middleware(authService)(httputil.Handler(h.HandleGetUserRooms, log)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var response GetUserRoomsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.Count != 2 {
+		t.Fatalf("count = %d, want 2", response.Count)
+	}
+
+	for _, room := range response.Rooms {
+		switch room.Room.ID {
+		case ok.ID:
+			if room.ParticipantsUnavailable || len(room.Participants) != 1 {
+				t.Errorf("room %s: unavailable = %v, participants = %d, want false and 1",
+					room.Room.ID, room.ParticipantsUnavailable, len(room.Participants))
+			}
+		case broken.ID:
+			if !room.ParticipantsUnavailable || len(room.Participants) != 0 {
+				t.Errorf("room %s: unavailable = %v, participants = %d, want true and 0",
+					room.Room.ID, room.ParticipantsUnavailable, len(room.Participants))
+			}
+		default:
+			t.Errorf("unexpected room %s", room.Room.ID)
+		}
+	}
+}
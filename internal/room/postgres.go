@@ -8,9 +8,14 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rx3lixir/laba_zis/internal/storage/postgres"
 )
 
+// Postgres error code for unique_violation
+const uniqueViolationCode = "23505"
+
 type PostgresStore struct {
 	pool *pgxpool.Pool
 }
@@ -21,17 +26,56 @@ func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
 
 // CreateRoom creates a new room
 func (s *PostgresStore) CreateRoom(ctx context.Context, room *Room) error {
+	return insertRoom(ctx, s.pool, room)
+}
+
+// CreateRoomWithParticipants creates a room with ownerID as owner and userIDs
+// as members in one transaction, so a failed insert leaves nothing behind
+func (s *PostgresStore) CreateRoomWithParticipants(ctx context.Context, room *Room, ownerID uuid.UUID, userIDs []uuid.UUID) ([]RoomParticipant, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertRoom(ctx, tx, room); err != nil {
+		return nil, err
+	}
+
+	participants := make([]RoomParticipant, 0, len(userIDs)+1)
+	participants = append(participants, RoomParticipant{RoomID: room.ID, UserID: ownerID, Role: RoleOwner})
+	for _, userID := range userIDs {
+		participants = append(participants, RoomParticipant{RoomID: room.ID, UserID: userID})
+	}
+
+	for i := range participants {
+		if err := insertParticipant(ctx, tx, &participants[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit room: %w", err)
+	}
+
+	return participants, nil
+}
+
+func insertRoom(ctx context.Context, q querier, room *Room) error {
 	query := `
-		INSERT INTO rooms (id, created_at, updated_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO rooms (id, name, type, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
 	`
 
 	room.ID = uuid.New()
 	now := time.Now()
 	room.CreatedAt = now
 	room.UpdatedAt = now
+	if room.Type == "" {
+		room.Type = RoomTypeGroup
+	}
 
-	_, err := s.pool.Exec(ctx, query, room.ID, room.CreatedAt, room.UpdatedAt)
+	_, err := q.Exec(ctx, query, room.ID, room.Name, room.Type, room.CreatedAt, room.UpdatedAt)
 	if err != nil {
 		if ctx.Err() != nil {
 			return fmt.Errorf("operation cancelled: %w", ctx.Err())
@@ -45,22 +89,53 @@ func (s *PostgresStore) CreateRoom(ctx context.Context, room *Room) error {
 // GetRoomByID retrieves a room by its ID
 func (s *PostgresStore) GetRoomByID(ctx context.Context, roomID uuid.UUID) (*Room, error) {
 	query := `
-		SELECT id, created_at, updated_at
+		SELECT id, name, type, created_at, updated_at
 		FROM rooms
 		WHERE id = $1
 	`
 
 	room := &Room{}
-	err := s.pool.QueryRow(ctx, query, roomID).Scan(
+	err := postgres.Retry(ctx, postgres.ReadRetry, func() error {
+		return s.pool.QueryRow(ctx, query, roomID).Scan(
+			&room.ID,
+			&room.Name,
+			&room.Type,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+		)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get room: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get room: %w", err)
+	}
+
+	return room, nil
+}
+
+// UpdateRoomName renames a room and returns the updated row
+func (s *PostgresStore) UpdateRoomName(ctx context.Context, roomID uuid.UUID, name string) (*Room, error) {
+	query := `
+		UPDATE rooms
+		SET name = $2, updated_at = $3
+		WHERE id = $1
+		RETURNING id, name, type, created_at, updated_at
+	`
+
+	room := &Room{}
+	err := s.pool.QueryRow(ctx, query, roomID, name, time.Now()).Scan(
 		&room.ID,
+		&room.Name,
+		&room.Type,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("room not found")
+			return nil, fmt.Errorf("failed to update room name: %w", ErrNotFound)
 		}
-		return nil, fmt.Errorf("failed to get room: %w", err)
+		return nil, fmt.Errorf("failed to update room name: %w", err)
 	}
 
 	return room, nil
@@ -76,7 +151,7 @@ func (s *PostgresStore) DeleteRoom(ctx context.Context, roomID uuid.UUID) error
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("room not found")
+		return fmt.Errorf("failed to delete room: %w", ErrNotFound)
 	}
 
 	return nil
@@ -84,24 +159,36 @@ func (s *PostgresStore) DeleteRoom(ctx context.Context, roomID uuid.UUID) error
 
 // AddParticipant adds a user to a room
 func (s *PostgresStore) AddParticipant(ctx context.Context, participant *RoomParticipant) error {
+	return insertParticipant(ctx, s.pool, participant)
+}
+
+func insertParticipant(ctx context.Context, q querier, participant *RoomParticipant) error {
 	query := `
-		INSERT INTO room_participants (id, room_id, user_id, joined_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO room_participants (id, room_id, user_id, role, joined_at)
+		VALUES ($1, $2, $3, $4, $5)
 	`
 
 	participant.ID = uuid.New()
 	participant.JoinedAt = time.Now()
+	if participant.Role == "" {
+		participant.Role = RoleMember
+	}
 
-	_, err := s.pool.Exec(ctx, query,
+	_, err := q.Exec(ctx, query,
 		participant.ID,
 		participant.RoomID,
 		participant.UserID,
+		participant.Role,
 		participant.JoinedAt,
 	)
 	if err != nil {
 		if ctx.Err() != nil {
 			return fmt.Errorf("operation cancelled: %w", ctx.Err())
 		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			return ErrAlreadyParticipant
+		}
 		return fmt.Errorf("failed to add participant: %w", err)
 	}
 
@@ -121,16 +208,94 @@ func (s *PostgresStore) RemoveParticipant(ctx context.Context, roomID, userID uu
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("participant not found in room")
+		return fmt.Errorf("failed to remove participant: %w", ErrNotParticipant)
 	}
 
 	return nil
 }
 
+// LeaveRoom removes the user from the room in one transaction. The room row is
+// locked first so concurrent leaves can't both see members that are about to go
+func (s *PostgresStore) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) (*LeaveResult, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT id FROM rooms WHERE id = $1 FOR UPDATE`, roomID); err != nil {
+		return nil, fmt.Errorf("failed to lock room: %w", err)
+	}
+
+	var role string
+	err = tx.QueryRow(ctx, `
+		DELETE FROM room_participants
+		WHERE room_id = $1 AND user_id = $2
+		RETURNING role
+	`, roomID, userID).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotParticipant
+		}
+		return nil, fmt.Errorf("failed to remove participant: %w", err)
+	}
+
+	result := &LeaveResult{}
+
+	// Earliest-joined remaining member, they inherit ownership if the owner left
+	var nextID uuid.UUID
+	err = tx.QueryRow(ctx, `
+		SELECT id FROM room_participants
+		WHERE room_id = $1
+		ORDER BY joined_at ASC
+		LIMIT 1
+	`, roomID).Scan(&nextID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		if _, err := tx.Exec(ctx, `DELETE FROM rooms WHERE id = $1`, roomID); err != nil {
+			return nil, fmt.Errorf("failed to delete empty room: %w", err)
+		}
+		result.RoomDeleted = true
+
+	case err != nil:
+		return nil, fmt.Errorf("failed to find remaining participant: %w", err)
+
+	case role == RoleOwner:
+		var newOwnerID uuid.UUID
+		err := tx.QueryRow(ctx, `
+			UPDATE room_participants SET role = $2
+			WHERE id = $1
+			RETURNING user_id
+		`, nextID, RoleOwner).Scan(&newOwnerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transfer ownership: %w", err)
+		}
+		result.NewOwnerID = &newOwnerID
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit leave: %w", err)
+	}
+
+	return result, nil
+}
+
+// CountParticipants counts a room's members without loading them
+func (s *PostgresStore) CountParticipants(ctx context.Context, roomID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM room_participants WHERE room_id = $1`
+
+	var count int
+	if err := s.pool.QueryRow(ctx, query, roomID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count participants: %w", err)
+	}
+
+	return count, nil
+}
+
 // GetRoomParticipants gets all participants in a room
 func (s *PostgresStore) GetRoomParticipants(ctx context.Context, roomID uuid.UUID) ([]*RoomParticipant, error) {
 	query := `
-		SELECT id, room_id, user_id, joined_at
+		SELECT id, room_id, user_id, role, joined_at, muted, muted_until
 		FROM room_participants
 		WHERE room_id = $1
 		ORDER BY joined_at ASC
@@ -145,7 +310,7 @@ func (s *PostgresStore) GetRoomParticipants(ctx context.Context, roomID uuid.UUI
 	participants := []*RoomParticipant{}
 	for rows.Next() {
 		p := &RoomParticipant{}
-		err := rows.Scan(&p.ID, &p.RoomID, &p.UserID, &p.JoinedAt)
+		err := rows.Scan(&p.ID, &p.RoomID, &p.UserID, &p.Role, &p.JoinedAt, &p.Muted, &p.MutedUntil)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan participant: %w", err)
 		}
@@ -159,6 +324,44 @@ func (s *PostgresStore) GetRoomParticipants(ctx context.Context, roomID uuid.UUI
 	return participants, nil
 }
 
+// SetParticipantMute updates the mute preference of a participant and returns the updated row
+func (s *PostgresStore) SetParticipantMute(
+	ctx context.Context,
+	roomID, userID uuid.UUID,
+	muted bool,
+	mutedUntil *time.Time,
+) (*RoomParticipant, error) {
+	query := `
+		UPDATE room_participants
+		SET muted = $3, muted_until = $4
+		WHERE room_id = $1 AND user_id = $2
+		RETURNING id, room_id, user_id, role, joined_at, muted, muted_until
+	`
+
+	if !muted {
+		mutedUntil = nil
+	}
+
+	p := &RoomParticipant{}
+	err := s.pool.QueryRow(ctx, query, roomID, userID, muted, mutedUntil).Scan(
+		&p.ID,
+		&p.RoomID,
+		&p.UserID,
+		&p.Role,
+		&p.JoinedAt,
+		&p.Muted,
+		&p.MutedUntil,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotParticipant
+		}
+		return nil, fmt.Errorf("failed to update participant mute: %w", err)
+	}
+
+	return p, nil
+}
+
 // IsUserInRoom checks if a user is a participant in a room
 func (s *PostgresStore) IsUserInRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
 	query := `
@@ -169,7 +372,9 @@ func (s *PostgresStore) IsUserInRoom(ctx context.Context, roomID, userID uuid.UU
 	`
 
 	var exists bool
-	err := s.pool.QueryRow(ctx, query, roomID, userID).Scan(&exists)
+	err := postgres.Retry(ctx, postgres.ReadRetry, func() error {
+		return s.pool.QueryRow(ctx, query, roomID, userID).Scan(&exists)
+	})
 	if err != nil {
 		return false, fmt.Errorf("failed to check user in room: %w", err)
 	}
@@ -177,10 +382,31 @@ func (s *PostgresStore) IsUserInRoom(ctx context.Context, roomID, userID uuid.UU
 	return exists, nil
 }
 
+// GetParticipantRole returns the user's role in the room, or "" if they aren't a member
+func (s *PostgresStore) GetParticipantRole(ctx context.Context, roomID, userID uuid.UUID) (string, error) {
+	query := `
+		SELECT role FROM room_participants
+		WHERE room_id = $1 AND user_id = $2
+	`
+
+	var role string
+	err := postgres.Retry(ctx, postgres.ReadRetry, func() error {
+		return s.pool.QueryRow(ctx, query, roomID, userID).Scan(&role)
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get participant role: %w", err)
+	}
+
+	return role, nil
+}
+
 // GetUserRooms gets all rooms a user is participating in
 func (s *PostgresStore) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]*Room, error) {
 	query := `
-		SELECT r.id, r.created_at, r.updated_at
+		SELECT r.id, r.name, r.type, r.created_at, r.updated_at
 		FROM rooms r
 		INNER JOIN room_participants rp ON r.id = rp.room_id
 		WHERE rp.user_id = $1
@@ -196,7 +422,128 @@ func (s *PostgresStore) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]*
 	rooms := []*Room{}
 	for rows.Next() {
 		room := &Room{}
-		err := rows.Scan(&room.ID, &room.CreatedAt, &room.UpdatedAt)
+		err := rows.Scan(&room.ID, &room.Name, &room.Type, &room.CreatedAt, &room.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room: %w", err)
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rooms: %w", err)
+	}
+
+	return rooms, nil
+}
+
+// GetRoomsOverview joins each room with its latest live message and its unread
+// count laterally, so a page costs one round trip whatever its size
+func (s *PostgresStore) GetRoomsOverview(ctx context.Context, userID uuid.UUID, limit, offset int) ([]RoomOverview, error) {
+	query := `
+		SELECT r.id, r.name, r.type, r.created_at, r.updated_at,
+		       lm.id, lm.sender_id, lm.duration_seconds, lm.created_at,
+		       unread.count,
+		       GREATEST(r.updated_at, COALESCE(lm.created_at, r.created_at)) AS last_activity_at
+		FROM room_participants me
+		INNER JOIN rooms r ON r.id = me.room_id
+		LEFT JOIN LATERAL (
+			SELECT vm.id, vm.sender_id, vm.duration_seconds, vm.created_at
+			FROM voice_messages vm
+			WHERE vm.room_id = r.id AND vm.deleted_at IS NULL
+			ORDER BY vm.created_at DESC
+			LIMIT 1
+		) lm ON TRUE
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS count
+			FROM voice_messages vm
+			WHERE vm.room_id = r.id
+			  AND vm.deleted_at IS NULL
+			  AND vm.sender_id IS DISTINCT FROM $1
+			  AND NOT EXISTS (SELECT 1 FROM message_plays mp WHERE mp.message_id = vm.id AND mp.user_id = $1)
+			  AND NOT EXISTS (SELECT 1 FROM message_reads mr WHERE mr.message_id = vm.id AND mr.user_id = $1)
+		) unread
+		WHERE me.user_id = $1
+		ORDER BY last_activity_at DESC, r.id
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := s.pool.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rooms overview: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []RoomOverview{}
+	for rows.Next() {
+		var (
+			room        RoomOverview
+			lastID      *uuid.UUID
+			lastSender  *uuid.UUID
+			lastSeconds *int
+			lastAt      *time.Time
+		)
+		err := rows.Scan(
+			&room.ID,
+			&room.Name,
+			&room.Type,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&lastID,
+			&lastSender,
+			&lastSeconds,
+			&lastAt,
+			&room.UnreadCount,
+			&room.LastActivityAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room overview: %w", err)
+		}
+
+		if lastID != nil {
+			room.LastMessage = &MessagePreview{
+				ID:              *lastID,
+				SenderID:        lastSender,
+				DurationSeconds: *lastSeconds,
+				CreatedAt:       *lastAt,
+			}
+		}
+		rooms = append(rooms, room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rooms overview: %w", err)
+	}
+
+	return rooms, nil
+}
+
+// ListRooms gets a page of all rooms, counting participants in the same query
+func (s *PostgresStore) ListRooms(ctx context.Context, limit, offset int) ([]RoomSummary, error) {
+	query := `
+		SELECT r.id, r.name, r.type, r.created_at, r.updated_at,
+		       (SELECT COUNT(*) FROM room_participants rp WHERE rp.room_id = r.id)
+		FROM rooms r
+		ORDER BY r.created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rooms: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []RoomSummary{}
+	for rows.Next() {
+		var room RoomSummary
+		err := rows.Scan(
+			&room.ID,
+			&room.Name,
+			&room.Type,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&room.ParticipantCount,
+		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan room: %w", err)
 		}
@@ -209,3 +556,231 @@ func (s *PostgresStore) GetUserRooms(ctx context.Context, userID uuid.UUID) ([]*
 
 	return rooms, nil
 }
+
+// CountRooms returns the total number of rooms
+func (s *PostgresStore) CountRooms(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM rooms`
+
+	var count int
+	if err := s.pool.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rooms: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetRoomsWithParticipants gets the user's rooms and all their participants with a single
+// join, rows come grouped by room so they're assembled in one pass
+func (s *PostgresStore) GetRoomsWithParticipants(ctx context.Context, userID uuid.UUID) ([]RoomWithParticipants, error) {
+	query := `
+		SELECT r.id, r.name, r.type, r.created_at, r.updated_at,
+		       p.id, p.room_id, p.user_id, p.role, p.joined_at, p.muted, p.muted_until
+		FROM rooms r
+		INNER JOIN room_participants me ON me.room_id = r.id AND me.user_id = $1
+		INNER JOIN room_participants p ON p.room_id = r.id
+		ORDER BY r.updated_at DESC, r.id, p.joined_at ASC
+	`
+
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user rooms with participants: %w", err)
+	}
+	defer rows.Close()
+
+	rooms := []RoomWithParticipants{}
+	for rows.Next() {
+		var room Room
+		var p RoomParticipant
+		err := rows.Scan(
+			&room.ID,
+			&room.Name,
+			&room.Type,
+			&room.CreatedAt,
+			&room.UpdatedAt,
+			&p.ID,
+			&p.RoomID,
+			&p.UserID,
+			&p.Role,
+			&p.JoinedAt,
+			&p.Muted,
+			&p.MutedUntil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan room participant: %w", err)
+		}
+
+		if n := len(rooms); n == 0 || rooms[n-1].Room.ID != room.ID {
+			rooms = append(rooms, RoomWithParticipants{Room: room, Participants: []RoomParticipant{}})
+		}
+		last := &rooms[len(rooms)-1]
+		last.Participants = append(last.Participants, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rooms: %w", err)
+	}
+
+	return rooms, nil
+}
+
+// UserExists reports whether a user account with the ID exists
+func (s *PostgresStore) UserExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`
+
+	var exists bool
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check user exists: %w", err)
+	}
+
+	return exists, nil
+}
+
+// MissingUsers returns the IDs in userIDs without a user account, in the given order
+func (s *PostgresStore) MissingUsers(ctx context.Context, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	query := `
+		SELECT ids.id
+		FROM unnest($1::uuid[]) WITH ORDINALITY AS ids(id, position)
+		WHERE NOT EXISTS (SELECT 1 FROM users WHERE users.id = ids.id)
+		ORDER BY ids.position
+	`
+
+	rows, err := s.pool.Query(ctx, query, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check users exist: %w", err)
+	}
+	defer rows.Close()
+
+	missing := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		missing = append(missing, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating user ids: %w", err)
+	}
+
+	return missing, nil
+}
+
+// FindDMRoom returns the direct-message room between the two users in either order,
+// or nil if they don't have one yet
+func (s *PostgresStore) FindDMRoom(ctx context.Context, userA, userB uuid.UUID) (*Room, error) {
+	return findDMRoom(ctx, s.pool, userA, userB)
+}
+
+// GetOrCreateDMRoom returns the DM room between the two users, creating it if needed.
+// A transaction-scoped advisory lock on the user pair keeps concurrent calls
+// from creating two rooms
+func (s *PostgresStore) GetOrCreateDMRoom(ctx context.Context, userA, userB uuid.UUID) (*RoomResponse, bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, dmLockKey(userA, userB)); err != nil {
+		return nil, false, fmt.Errorf("failed to lock dm pair: %w", err)
+	}
+
+	room, err := findDMRoom(ctx, tx, userA, userB)
+	if err != nil {
+		return nil, false, err
+	}
+
+	created := false
+	if room == nil {
+		now := time.Now()
+		room = &Room{ID: uuid.New(), Type: RoomTypeDM, CreatedAt: now, UpdatedAt: now}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO rooms (id, type, created_at, updated_at)
+			VALUES ($1, $2, $3, $4)
+		`, room.ID, room.Type, room.CreatedAt, room.UpdatedAt)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to create dm room: %w", err)
+		}
+
+		for _, userID := range []uuid.UUID{userA, userB} {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO room_participants (id, room_id, user_id, role, joined_at)
+				VALUES ($1, $2, $3, $4, $5)
+			`, uuid.New(), room.ID, userID, RoleMember, now)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to add dm participant: %w", err)
+			}
+		}
+		created = true
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, room_id, user_id, role, joined_at, muted, muted_until
+		FROM room_participants
+		WHERE room_id = $1
+		ORDER BY joined_at ASC
+	`, room.ID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get dm participants: %w", err)
+	}
+	participants, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (RoomParticipant, error) {
+		var p RoomParticipant
+		err := row.Scan(&p.ID, &p.RoomID, &p.UserID, &p.Role, &p.JoinedAt, &p.Muted, &p.MutedUntil)
+		return p, err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to scan dm participants: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to commit dm room: %w", err)
+	}
+
+	return &RoomResponse{Room: *room, Participants: participants}, created, nil
+}
+
+// querier is satisfied by both the pool and a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func findDMRoom(ctx context.Context, q querier, userA, userB uuid.UUID) (*Room, error) {
+	query := `
+		SELECT r.id, r.name, r.type, r.created_at, r.updated_at
+		FROM rooms r
+		WHERE r.type = $1
+		  AND EXISTS(SELECT 1 FROM room_participants WHERE room_id = r.id AND user_id = $2)
+		  AND EXISTS(SELECT 1 FROM room_participants WHERE room_id = r.id AND user_id = $3)
+		ORDER BY r.created_at ASC
+		LIMIT 1
+	`
+
+	room := &Room{}
+	err := q.QueryRow(ctx, query, RoomTypeDM, userA, userB).Scan(
+		&room.ID,
+		&room.Name,
+		&room.Type,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to find dm room: %w", err)
+	}
+
+	return room, nil
+}
+
+// dmLockKey is the same for both orders of the pair
+func dmLockKey(userA, userB uuid.UUID) string {
+	a, b := userA.String(), userB.String()
+	if a > b {
+		a, b = b, a
+	}
+	return "dm:" + a + ":" + b
+}
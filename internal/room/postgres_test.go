@@ -0,0 +1,189 @@
+package room
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rx3lixir/laba_zis/internal/storage/postgres"
+)
+
+// queryCounter counts the queries sent to the database
+type queryCounter struct {
+	queries atomic.Int64
+}
+
+func (c *queryCounter) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	c.queries.Add(1)
+	return ctx
+}
+
+func (c *queryCounter) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+}
+
+// newTestStore connects to TEST_DATABASE_URL and migrates it, the test is
+// skipped when the variable isn't set
+func newTestStore(t *testing.T) (*PostgresStore, *pgxpool.Pool, *queryCounter) {
+	t.Helper()
+
+	dburl := os.Getenv("TEST_DATABASE_URL")
+	if dburl == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	config, err := pgxpool.ParseConfig(dburl)
+	if err != nil {
+		t.Fatalf("parse database url: %v", err)
+	}
+	counter := &queryCounter{}
+	config.ConnConfig.Tracer = counter
+
+	ctx := context.Background()
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if _, err := postgres.Migrate(ctx, pool); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return NewPostgresStore(pool), pool, counter
+}
+
+// createTestUser inserts a user and removes it, with its rooms, once the test is done
+func createTestUser(t *testing.T, pool *pgxpool.Pool) uuid.UUID {
+	t.Helper()
+
+	id := uuid.New()
+	ctx := context.Background()
+	_, err := pool.Exec(ctx,
+		`INSERT INTO users (id, username, email, password) VALUES ($1, $2, $3, 'x')`,
+		id, "u"+id.String()[:8], id.String()+"@example.com")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(ctx, `DELETE FROM rooms WHERE id IN (SELECT room_id FROM room_participants WHERE user_id = $1)`, id)
+		pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
+	})
+
+	return id
+}
+
+func TestGetRoomsWithParticipantsSingleRoundTrip(t *testing.T) {
+	store, pool, counter := newTestStore(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, pool)
+	for range 5 {
+		member := createTestUser(t, pool)
+		if _, err := store.CreateRoomWithParticipants(ctx, &Room{}, owner, []uuid.UUID{member}); err != nil {
+			t.Fatalf("create room: %v", err)
+		}
+	}
+
+	counter.queries.Store(0)
+	rooms, err := store.GetRoomsWithParticipants(ctx, owner)
+	if err != nil {
+		t.Fatalf("get rooms: %v", err)
+	}
+
+	if got := counter.queries.Load(); got != 1 {
+		t.Errorf("queries = %d, want 1", got)
+	}
+	if len(rooms) != 5 {
+		t.Fatalf("rooms = %d, want 5", len(rooms))
+	}
+	for _, room := range rooms {
+		if len(room.Participants) != 2 {
+			t.Errorf("room %s has %d participants, want 2", room.Room.ID, len(room.Participants))
+		}
+	}
+}
+
+func TestCreateRoomWithParticipantsRollsBackOnFailedParticipant(t *testing.T) {
+	store, pool, _ := newTestStore(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, pool)
+	member := createTestUser(t, pool)
+	missing := uuid.New()
+
+	room := &Room{}
+	_, err := store.CreateRoomWithParticipants(ctx, room, owner, []uuid.UUID{member, missing})
+	if err == nil {
+		t.Fatal("expected an error for a participant without a user account")
+	}
+
+	var rooms, participants int
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM rooms WHERE id = $1`, room.ID).Scan(&rooms); err != nil {
+		t.Fatalf("count rooms: %v", err)
+	}
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM room_participants WHERE room_id = $1`, room.ID).Scan(&participants); err != nil {
+		t.Fatalf("count participants: %v", err)
+	}
+	if rooms != 0 || participants != 0 {
+		t.Errorf("rooms = %d, participants = %d after a failed create, want nothing committed", rooms, participants)
+	}
+}
+
+func TestGetOrCreateDMRoomConcurrentCreatesOneRoom(t *testing.T) {
+	store, pool, _ := newTestStore(t)
+	ctx := context.Background()
+
+	a := createTestUser(t, pool)
+	b := createTestUser(t, pool)
+
+	const callers = 16
+	ids := make([]uuid.UUID, callers)
+	errs := make([]error, callers)
+
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Half the callers pass the pair in the other order
+			userA, userB := a, b
+			if i%2 == 1 {
+				userA, userB = b, a
+			}
+			room, _, err := store.GetOrCreateDMRoom(ctx, userA, userB)
+			if err == nil {
+				ids[i] = room.Room.ID
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("caller %d: %v", i, err)
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("caller %d got room %s, caller 0 got %s", i, ids[i], ids[0])
+		}
+	}
+
+	var dmRooms int
+	query := `
+		SELECT COUNT(*) FROM rooms r
+		WHERE r.type = 'dm'
+		  AND EXISTS (SELECT 1 FROM room_participants WHERE room_id = r.id AND user_id = $1)
+		  AND EXISTS (SELECT 1 FROM room_participants WHERE room_id = r.id AND user_id = $2)
+	`
+	if err := pool.QueryRow(ctx, query, a, b).Scan(&dmRooms); err != nil {
+		t.Fatalf("count dm rooms: %v", err)
+	}
+	if dmRooms != 1 {
+		t.Errorf("dm rooms = %d, want 1", dmRooms)
+	}
+}
@@ -2,19 +2,60 @@ package room
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrNotFound means the room doesn't exist
+	ErrNotFound = errors.New("room not found")
+	// ErrNotParticipant means the user is not a member of the room
+	ErrNotParticipant = errors.New("participant not found in room")
+	// ErrAlreadyParticipant means the user is already a member of the room
+	ErrAlreadyParticipant = errors.New("user is already a participant")
+)
+
 type Store interface {
 	CreateRoom(ctx context.Context, room *Room) error
+	// CreateRoomWithParticipants creates the room with ownerID as owner and userIDs
+	// as members atomically, nothing is stored if any insert fails
+	CreateRoomWithParticipants(ctx context.Context, room *Room, ownerID uuid.UUID, userIDs []uuid.UUID) ([]RoomParticipant, error)
 	GetRoomByID(ctx context.Context, roomID uuid.UUID) (*Room, error)
+	UpdateRoomName(ctx context.Context, roomID uuid.UUID, name string) (*Room, error)
 	DeleteRoom(ctx context.Context, roomID uuid.UUID) error
 
 	AddParticipant(ctx context.Context, participant *RoomParticipant) error
 	RemoveParticipant(ctx context.Context, roomID, userID uuid.UUID) error
+	// LeaveRoom removes the user, hands ownership on if needed and deletes the room
+	// once nobody is left. Returns ErrNotParticipant if the user isn't a member
+	LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) (*LeaveResult, error)
 	GetRoomParticipants(ctx context.Context, roomID uuid.UUID) ([]*RoomParticipant, error)
+	CountParticipants(ctx context.Context, roomID uuid.UUID) (int, error)
 	IsUserInRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	// GetParticipantRole returns the user's role in the room, or "" if they aren't a member
+	GetParticipantRole(ctx context.Context, roomID, userID uuid.UUID) (string, error)
+	SetParticipantMute(ctx context.Context, roomID, userID uuid.UUID, muted bool, mutedUntil *time.Time) (*RoomParticipant, error)
 
 	GetUserRooms(ctx context.Context, userID uuid.UUID) ([]*Room, error)
+	// ListRooms pages through every room, newest first, with participant counts
+	ListRooms(ctx context.Context, limit, offset int) ([]RoomSummary, error)
+	CountRooms(ctx context.Context) (int, error)
+
+	// FindDMRoom returns the DM room between two users in either order, or nil if none exists
+	FindDMRoom(ctx context.Context, userA, userB uuid.UUID) (*Room, error)
+	// GetOrCreateDMRoom returns the DM room between two users, creating it if needed.
+	// The bool reports whether the room was created
+	GetOrCreateDMRoom(ctx context.Context, userA, userB uuid.UUID) (*RoomResponse, bool, error)
+
+	// UserExists reports whether a user account with the ID exists
+	UserExists(ctx context.Context, userID uuid.UUID) (bool, error)
+	// MissingUsers returns the IDs in userIDs that don't belong to any user account
+	MissingUsers(ctx context.Context, userIDs []uuid.UUID) ([]uuid.UUID, error)
+	// GetRoomsOverview pages through the user's rooms by last activity, with each
+	// room's latest message and unread count, in one query
+	GetRoomsOverview(ctx context.Context, userID uuid.UUID, limit, offset int) ([]RoomOverview, error)
+	// GetRoomsWithParticipants loads the user's rooms along with all their participants in one query
+	GetRoomsWithParticipants(ctx context.Context, userID uuid.UUID) ([]RoomWithParticipants, error)
 }
@@ -6,38 +6,137 @@ import (
 	"github.com/google/uuid"
 )
 
+// Room types, DM rooms always hold exactly two users
+const (
+	RoomTypeGroup = "group"
+	RoomTypeDM    = "dm"
+)
+
 type Room struct {
 	ID        uuid.UUID `json:"id"`
+	Name      *string   `json:"name"`
+	Type      string    `json:"type"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Participant roles, the owner manages the room and its members
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
 type RoomParticipant struct {
-	ID       uuid.UUID `json:"id"`
-	RoomID   uuid.UUID `json:"room_id"`
-	UserID   uuid.UUID `json:"user_id"`
-	JoinedAt time.Time `json:"joined_at"`
+	ID         uuid.UUID  `json:"id"`
+	RoomID     uuid.UUID  `json:"room_id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	Role       string     `json:"role"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	Muted      bool       `json:"muted"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
+// IsMuted reports whether notifications for this participant are currently muted
+func (p *RoomParticipant) IsMuted(now time.Time) bool {
+	if !p.Muted {
+		return false
+	}
+	return p.MutedUntil == nil || p.MutedUntil.After(now)
 }
 
 type CreateRoomRequest struct {
+	Name           *string     `json:"name,omitempty"`
 	ParticipantIDs []uuid.UUID `json:"participants_ids"`
 }
 
+// UpdateRoomRequest renames a room
+type UpdateRoomRequest struct {
+	Name *string `json:"name"`
+}
+
 type CreateRoomResponse struct {
 	Room         Room              `json:"room"`
 	Participants []RoomParticipant `json:"participants"`
 }
 
+// CreateDMRequest opens a direct-message room with another user
+type CreateDMRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
 type AddParticipantRequest struct {
 	UserID uuid.UUID `json:"user_id"`
 }
 
+// MuteRoomRequest mutes or unmutes a room for the authenticated user.
+// MutedUntil is optional, without it the room stays muted until unmuted
+type MuteRoomRequest struct {
+	Muted      bool       `json:"muted"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
 type RoomResponse struct {
 	Room         Room              `json:"room"`
 	Participants []RoomParticipant `json:"participants"`
+	// ParticipantsUnavailable is set when participants couldn't be loaded,
+	// the room is still listed with an empty participant list
+	ParticipantsUnavailable bool `json:"participants_unavailable,omitempty"`
 }
 
 type GetUserRoomsResponse struct {
 	Rooms []RoomResponse `json:"rooms"`
 	Count int            `json:"count"`
 }
+
+// RoomWithParticipants is a room together with all of its participants
+type RoomWithParticipants struct {
+	Room         Room
+	Participants []RoomParticipant
+}
+
+// MessagePreview is the latest message of a room as shown in the chat list
+type MessagePreview struct {
+	ID              uuid.UUID  `json:"id"`
+	SenderID        *uuid.UUID `json:"sender_id"` // nil once the sender's account was deleted with anonymize
+	DurationSeconds int        `json:"duration_seconds"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// RoomOverview is one chat list entry. UnreadCount counts messages from
+// others the user has neither played nor read
+type RoomOverview struct {
+	Room
+	LastMessage    *MessagePreview `json:"last_message"` // nil for rooms without messages
+	UnreadCount    int             `json:"unread_count"`
+	LastActivityAt time.Time       `json:"last_activity_at"`
+}
+
+// RoomsOverviewResponse is a page of the user's rooms, most recently active first
+type RoomsOverviewResponse struct {
+	Rooms  []RoomOverview `json:"rooms"`
+	Count  int            `json:"count"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// RoomSummary is a room with its member count, as listed to admins
+type RoomSummary struct {
+	Room
+	ParticipantCount int `json:"participant_count"`
+}
+
+// ListRoomsResponse is a page of every room in the system
+type ListRoomsResponse struct {
+	Rooms      []RoomSummary `json:"rooms"`
+	TotalCount int           `json:"total_count"`
+	Limit      int           `json:"limit"`
+	Offset     int           `json:"offset"`
+	HasMore    bool          `json:"has_more"`
+}
+
+// LeaveResult describes what happened to the room after a member left
+type LeaveResult struct {
+	RoomDeleted bool
+	// NewOwnerID is set when the owner left and ownership moved to someone else
+	NewOwnerID *uuid.UUID
+}
@@ -0,0 +1,26 @@
+package room
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxRoomNameLen = 64
+
+// normalizeRoomName trims the name and checks its length, nil stays nil
+func normalizeRoomName(name *string) (*string, error) {
+	if name == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*name)
+	if trimmed == "" {
+		return nil, fmt.Errorf("room name must not be empty")
+	}
+	if utf8.RuneCountInString(trimmed) > maxRoomNameLen {
+		return nil, fmt.Errorf("room name must be at most %d characters", maxRoomNameLen)
+	}
+
+	return &trimmed, nil
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/rx3lixir/laba_zis/internal/voice"
+	"github.com/rx3lixir/laba_zis/pkg/audio"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// ClientConfig is the public configuration advertised to clients at GET /api/config
+type ClientConfig struct {
+	AudioFormats       []audio.Format `json:"audio_formats"`
+	AudioLimits        voice.Limits   `json:"audio_limits"`
+	MaxUploadBytes     int64          `json:"max_upload_bytes"`
+	MaxDurationSeconds int            `json:"max_duration_seconds"`
+	// RequireVerifiedEmail tells clients that room creation and uploads need a verified email
+	RequireVerifiedEmail bool `json:"require_verified_email"`
+}
+
+func handleClientConfig(cfg ClientConfig) httputil.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		return httputil.RespondJSON(w, http.StatusOK, cfg)
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the hand-written OpenAPI 3 description of the REST API.
+// Keep it in sync with the *Request/*Response types when changing handlers
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUI renders the spec with Swagger UI loaded from a CDN
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>laba_zis API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
+
+func handleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUI))
+}
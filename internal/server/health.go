@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/minio/minio-go/v7"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// readyTimeout bounds each dependency check so a hung dependency can't stall the probe
+const readyTimeout = 2 * time.Second
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// ReadinessResponse reports the overall status and the status of each dependency
+type ReadinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// readinessCheck returns nil if the dependency is usable
+type readinessCheck func(ctx context.Context) error
+
+func postgresCheck(pool *pgxpool.Pool) readinessCheck {
+	return func(ctx context.Context) error {
+		return pool.Ping(ctx)
+	}
+}
+
+func s3Check(client *minio.Client, bucket string) readinessCheck {
+	return func(ctx context.Context) error {
+		exists, err := client.BucketExists(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("bucket %s does not exist", bucket)
+		}
+		return nil
+	}
+}
+
+// handleHealth is the liveness probe, it only tells the process is serving
+func handleHealth(w http.ResponseWriter, r *http.Request) error {
+	return httputil.RespondJSON(w, http.StatusOK, map[string]string{"status": statusOK})
+}
+
+// handleReady runs every dependency check and answers 503 if any fails
+func handleReady(checks map[string]readinessCheck) httputil.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		resp := ReadinessResponse{Status: statusOK, Checks: make(map[string]string, len(checks))}
+
+		for name, check := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+			err := check(ctx)
+			cancel()
+
+			if err != nil {
+				resp.Status = statusUnavailable
+				resp.Checks[name] = statusUnavailable + ": " + err.Error()
+				continue
+			}
+			resp.Checks[name] = statusOK
+		}
+
+		status := http.StatusOK
+		if resp.Status != statusOK {
+			status = http.StatusServiceUnavailable
+		}
+		return httputil.RespondJSON(w, status, resp)
+	}
+}
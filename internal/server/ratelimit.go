@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/rx3lixir/laba_zis/internal/auth"
+)
+
+// ipKey limits by client address, RealIP has already replaced RemoteAddr
+// with the forwarded address when there is one
+func ipKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// userKey limits by authenticated user, so it must run after auth.Middleware
+func userKey(r *http.Request) string {
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		return ipKey(r)
+	}
+	return "user:" + userID.String()
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+// RequestLogger puts a logger tagged with the request ID in the request
+// context, auth adds user_id to it. Handlers and httputil.RespondError get it
+// with logger.FromContext.
+// Must run after middleware.RequestID
+func RequestLogger(log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := log.With("request_id", middleware.GetReqID(r.Context()))
+			next.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context(), l)))
+		})
+	}
+}
@@ -2,24 +2,59 @@ package server
 
 import (
 	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/minio/minio-go/v7"
 	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/device"
+	"github.com/rx3lixir/laba_zis/internal/metrics"
 	"github.com/rx3lixir/laba_zis/internal/room"
 	"github.com/rx3lixir/laba_zis/internal/user"
 	"github.com/rx3lixir/laba_zis/internal/voice"
 	"github.com/rx3lixir/laba_zis/internal/websocket"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/ratelimit"
 )
 
 type RouterConfig struct {
-	UserHandler  *user.Handler
-	RoomHandler  *room.Handler
-	VoiceHandler *voice.Handler
-	WsHandler    *websocket.Handler
-	Log          *slog.Logger
-	AuthService  *auth.Service
+	UserHandler   *user.Handler
+	RoomHandler   *room.Handler
+	VoiceHandler  *voice.Handler
+	DeviceHandler *device.Handler
+	WsHandler     *websocket.Handler
+	Log           *slog.Logger
+	AuthService   *auth.Service
+	ClientConfig  ClientConfig
+	CORSOrigins   []string
+	CORSMethods   []string
+	CORSHeaders   []string
+	// Dependencies checked by GET /ready
+	DB         *pgxpool.Pool
+	S3         *minio.Client
+	BucketName string
+
+	// Rate limiters, nil disables limiting for that group. Auth routes are
+	// limited per client IP, authenticated routes per user
+	AuthRateLimit ratelimit.Limiter
+	UserRateLimit ratelimit.Limiter
+
+	// RequestTimeout is the deadline of every non-WebSocket request, zero disables it
+	RequestTimeout time.Duration
+	// UploadTimeout replaces RequestTimeout for voice uploads when longer,
+	// leaving room for transcoding
+	UploadTimeout time.Duration
+
+	// AdminUserIDs may use the /api/admin routes
+	AdminUserIDs []uuid.UUID
+
+	// MetricsEnabled serves Prometheus metrics on /metrics, outside the API and without auth
+	MetricsEnabled bool
 }
 
 func NewRouter(config RouterConfig) *chi.Mux {
@@ -27,55 +62,94 @@ func NewRouter(config RouterConfig) *chi.Mux {
 
 	// Global middleware
 	r.Use(middleware.RequestID)
+	r.Use(RequestLogger(config.Log))
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
+	if config.MetricsEnabled {
+		r.Use(metrics.Middleware)
+	}
+	r.Use(TimeoutMiddleware(config.RequestTimeout, config.UploadTimeout, config.Log))
 
 	// CORS middleware
 	r.Use(cors.Handler(
 		cors.Options{
-			AllowedOrigins: []string{
-				"http://localhost:3000",
-				"https://localhost:3000",
-			},
-			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-			AllowedHeaders: []string{
-				"Origin",
-				"Content-Type",
-				"Accept",
-				"Upgrade",    // Important for WebSocket handshake
-				"Connection", // Important for WebSocket handshake
-				"Sec-Websocket-Key",
-				"Sec-Websocket-Version",
-				"Sec-Websocket-Protocol", // If you use subprotocols
-			},
+			AllowedOrigins:   config.CORSOrigins,
+			AllowedMethods:   config.CORSMethods,
+			AllowedHeaders:   config.CORSHeaders,
 			ExposedHeaders:   []string{"Link"},
 			AllowCredentials: true,
 			MaxAge:           300,
 		}))
 
+	if config.MetricsEnabled {
+		r.Handle("/metrics", metrics.Handler())
+	}
+
+	// Liveness and readiness probes
+	r.Get("/health", httputil.Handler(handleHealth, config.Log))
+	r.Get("/ready", httputil.Handler(handleReady(map[string]readinessCheck{
+		"postgres": postgresCheck(config.DB),
+		"s3":       s3Check(config.S3, config.BucketName),
+	}), config.Log))
+
 	r.Route("/api", func(r chi.Router) {
+		// Public client configuration
+		r.Get("/config", httputil.Handler(handleClientConfig(config.ClientConfig), config.Log))
+
+		// API description and its interactive docs
+		r.Get("/openapi.json", handleOpenAPISpec)
+		r.Get("/docs", handleDocs)
+
 		// Public auth routes
 		r.Route("/auth", func(r chi.Router) {
+			r.Use(rateLimit(config.AuthRateLimit, ipKey, config.Log))
 			config.UserHandler.RegisterAuthRoutes(r)
 		})
 
 		// Chat rooms logic routes
 		r.Route("/rooms", func(r chi.Router) {
 			r.Use(auth.Middleware(config.AuthService))
+			r.Use(rateLimit(config.UserRateLimit, userKey, config.Log))
 			config.RoomHandler.RegisterRoutes(r)
+			config.VoiceHandler.RegisterRoomRoutes(r)
 		})
 
 		// Voice messages logic routes
 		r.Route("/messages", func(r chi.Router) {
 			r.Use(auth.Middleware(config.AuthService))
+			r.Use(rateLimit(config.UserRateLimit, userKey, config.Log))
 			config.VoiceHandler.RegisterRoutes(r)
 		})
 
+		// Push notification device tokens
+		r.Route("/devices", func(r chi.Router) {
+			r.Use(auth.Middleware(config.AuthService))
+			r.Use(rateLimit(config.UserRateLimit, userKey, config.Log))
+			config.DeviceHandler.RegisterRoutes(r)
+		})
+
 		// User logic routes
 		r.Route("/user", func(r chi.Router) {
-			r.Use(auth.Middleware(config.AuthService))
-			config.UserHandler.RegisterUserRoutes(r)
+			// Used before signing in, e.g. by the signup form
+			r.Group(func(r chi.Router) {
+				r.Use(rateLimit(config.AuthRateLimit, ipKey, config.Log))
+				config.UserHandler.RegisterPublicUserRoutes(r)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(auth.Middleware(config.AuthService))
+				r.Use(rateLimit(config.UserRateLimit, userKey, config.Log))
+				config.UserHandler.RegisterUserRoutes(r)
+			})
+		})
+
+		// Operational routes for admins
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(auth.RequireAdmin(config.AuthService, config.AdminUserIDs))
+			r.Use(rateLimit(config.UserRateLimit, userKey, config.Log))
+			config.RoomHandler.RegisterAdminRoutes(r)
+			config.WsHandler.RegisterAdminRoutes(r)
 		})
 
 		// Websocket connections
@@ -86,3 +160,11 @@ func NewRouter(config RouterConfig) *chi.Mux {
 
 	return r
 }
+
+// rateLimit returns the limiting middleware, or a no-op one when l is nil
+func rateLimit(l ratelimit.Limiter, key ratelimit.KeyFunc, log *slog.Logger) func(http.Handler) http.Handler {
+	if l == nil {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return ratelimit.Middleware(l, key, log)
+}
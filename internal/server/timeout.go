@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// uploadPath is the voice message upload route, which may transcode and
+// so gets its own deadline
+const uploadPath = "/api/messages"
+
+// TimeoutMiddleware puts a deadline of d on every request context. Handlers
+// that notice it fail with 504 (see httputil.RespondError), and if a handler
+// returns after the deadline without writing anything a 504 is sent for it.
+// Voice uploads get uploadTimeout instead, since a context deadline can only be
+// shortened further down the chain. WebSocket upgrades are long-lived and skip
+// the deadline. d <= 0 disables it
+func TimeoutMiddleware(d, uploadTimeout time.Duration, log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			timeout := d
+			if uploadTimeout > d && isUpload(r) {
+				timeout = uploadTimeout
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && ww.Status() == 0 {
+				httputil.RespondError(ww, r, httputil.GatewayTimeout(ctx.Err()), log)
+			}
+		})
+	}
+}
+
+func isUpload(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.TrimSuffix(r.URL.Path, "/") == uploadPath
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
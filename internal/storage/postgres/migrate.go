@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// MigrationState is one migration as reported by MigrationStatus
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // Zero when pending
+}
+
+// newProvider builds a goose provider over the embedded migrations.
+// The sql.DB borrows connections from pool, closing it leaves the pool open
+func newProvider(pool *pgxpool.Pool) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedded migrations: %w", err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, stdlib.OpenDBFromPool(pool), fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration provider: %w", err)
+	}
+
+	return provider, nil
+}
+
+// Migrate applies every pending migration and returns how many ran
+func Migrate(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	provider, err := newProvider(pool)
+	if err != nil {
+		return 0, err
+	}
+	defer provider.Close()
+
+	results, err := provider.Up(ctx)
+	if err != nil {
+		return len(results), fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	return len(results), nil
+}
+
+// Rollback reverts the most recently applied migration
+func Rollback(ctx context.Context, pool *pgxpool.Pool) (*MigrationState, error) {
+	provider, err := newProvider(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	result, err := provider.Down(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back migration: %w", err)
+	}
+
+	return &MigrationState{
+		Version: result.Source.Version,
+		Name:    filepath.Base(result.Source.Path),
+	}, nil
+}
+
+// MigrationStatus lists every embedded migration in version order
+func MigrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]MigrationState, error) {
+	provider, err := newProvider(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer provider.Close()
+
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration status: %w", err)
+	}
+
+	states := make([]MigrationState, 0, len(statuses))
+	for _, st := range statuses {
+		states = append(states, MigrationState{
+			Version:   st.Source.Version,
+			Name:      filepath.Base(st.Source.Path),
+			Applied:   st.State == goose.StateApplied,
+			AppliedAt: st.AppliedAt,
+		})
+	}
+
+	return states, nil
+}
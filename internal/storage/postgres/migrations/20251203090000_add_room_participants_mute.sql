@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE room_participants
+  ADD COLUMN muted BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN muted_until TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE room_participants
+  DROP COLUMN IF EXISTS muted_until,
+  DROP COLUMN IF EXISTS muted;
+-- +goose StatementEnd
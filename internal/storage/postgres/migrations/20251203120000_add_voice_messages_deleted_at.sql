@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE voice_messages ADD COLUMN deleted_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE voice_messages DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE pending_deletions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  s3_key VARCHAR(512) NOT NULL UNIQUE,
+  reason VARCHAR(64) NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+  not_before TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_pending_deletions_not_before ON pending_deletions(not_before);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_pending_deletions_not_before;
+DROP TABLE IF EXISTS pending_deletions;
+-- +goose StatementEnd
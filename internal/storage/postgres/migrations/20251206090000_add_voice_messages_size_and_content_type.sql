@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE voice_messages
+  ADD COLUMN size_bytes BIGINT,
+  ADD COLUMN content_type VARCHAR(100);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE voice_messages
+  DROP COLUMN IF EXISTS content_type,
+  DROP COLUMN IF EXISTS size_bytes;
+-- +goose StatementEnd
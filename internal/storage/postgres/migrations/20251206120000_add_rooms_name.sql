@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE rooms
+  ADD COLUMN name VARCHAR(64);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS name;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE room_participants
+  ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member'
+  CHECK (role IN ('owner', 'member'));
+
+-- Existing rooms have no recorded creator, the earliest member becomes the owner
+UPDATE room_participants rp
+SET role = 'owner'
+FROM (
+  SELECT DISTINCT ON (room_id) id
+  FROM room_participants
+  ORDER BY room_id, joined_at ASC
+) first
+WHERE rp.id = first.id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE room_participants
+  DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE rooms
+  ADD COLUMN type VARCHAR(8) NOT NULL DEFAULT 'group'
+  CHECK (type IN ('group', 'dm'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE rooms
+  DROP COLUMN IF EXISTS type;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+  ADD COLUMN last_seen_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+  DROP COLUMN IF EXISTS last_seen_at;
+-- +goose StatementEnd
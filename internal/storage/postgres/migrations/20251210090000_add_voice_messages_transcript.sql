@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE voice_messages
+  ADD COLUMN transcript TEXT,
+  ADD COLUMN transcript_tsv TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(transcript, ''))) STORED;
+
+CREATE INDEX idx_voice_messages_transcript_tsv ON voice_messages USING GIN (transcript_tsv);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_voice_messages_transcript_tsv;
+
+ALTER TABLE voice_messages
+  DROP COLUMN IF EXISTS transcript_tsv,
+  DROP COLUMN IF EXISTS transcript;
+-- +goose StatementEnd
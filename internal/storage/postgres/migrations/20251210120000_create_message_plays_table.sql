@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE message_plays (
+  message_id UUID NOT NULL REFERENCES voice_messages(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  play_count INTEGER NOT NULL DEFAULT 1,
+  played_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_played_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (message_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS message_plays;
+-- +goose StatementEnd
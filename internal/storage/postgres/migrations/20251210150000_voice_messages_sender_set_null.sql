@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Anonymized messages outlive their sender with a NULL sender_id
+ALTER TABLE voice_messages ALTER COLUMN sender_id DROP NOT NULL;
+ALTER TABLE voice_messages DROP CONSTRAINT voice_messages_sender_id_fkey;
+ALTER TABLE voice_messages
+  ADD CONSTRAINT voice_messages_sender_id_fkey
+  FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM voice_messages WHERE sender_id IS NULL;
+ALTER TABLE voice_messages DROP CONSTRAINT voice_messages_sender_id_fkey;
+ALTER TABLE voice_messages
+  ADD CONSTRAINT voice_messages_sender_id_fkey
+  FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE voice_messages ALTER COLUMN sender_id SET NOT NULL;
+-- +goose StatementEnd
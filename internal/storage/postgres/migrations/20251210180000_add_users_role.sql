@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'user';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
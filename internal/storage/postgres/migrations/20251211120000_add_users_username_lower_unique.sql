@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Usernames differing only in case were allowed before, the later accounts
+-- get a suffix from their ID so the index can be built
+UPDATE users
+SET username = users.username || '_' || LEFT(users.id::text, 8)
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY LOWER(username) ORDER BY created_at, id) AS n
+  FROM users
+) dup
+WHERE dup.id = users.id AND dup.n > 1;
+
+CREATE UNIQUE INDEX users_username_lower_key ON users (LOWER(username));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS users_username_lower_key;
+-- +goose StatementEnd
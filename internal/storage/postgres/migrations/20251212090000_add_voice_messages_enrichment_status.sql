@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE voice_messages
+  ADD COLUMN enrichment_status VARCHAR(16),
+  ADD COLUMN enrichment_attempts INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN enrichment_retry_at TIMESTAMP;
+
+UPDATE voice_messages SET enrichment_status = 'done' WHERE transcript IS NOT NULL;
+
+CREATE INDEX idx_voice_messages_enrichment_retry ON voice_messages(enrichment_retry_at)
+  WHERE enrichment_status = 'failed';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_voice_messages_enrichment_retry;
+
+ALTER TABLE voice_messages
+  DROP COLUMN IF EXISTS enrichment_retry_at,
+  DROP COLUMN IF EXISTS enrichment_attempts,
+  DROP COLUMN IF EXISTS enrichment_status;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The longest message is voice_params.max_duration_seconds now, the handler enforces it
+ALTER TABLE voice_messages DROP CONSTRAINT IF EXISTS voice_messages_duration_seconds_check;
+ALTER TABLE voice_messages
+  ADD CONSTRAINT voice_messages_duration_seconds_check CHECK (duration_seconds > 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE voice_messages DROP CONSTRAINT IF EXISTS voice_messages_duration_seconds_check;
+ALTER TABLE voice_messages
+  ADD CONSTRAINT voice_messages_duration_seconds_check CHECK (duration_seconds > 0 AND duration_seconds <= 15);
+-- +goose StatementEnd
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// RetryPolicy bounds how a query class is retried on transient errors
+type RetryPolicy struct {
+	Attempts  int           // Total tries, including the first
+	BaseDelay time.Duration // Doubled after every failed try
+	MaxDelay  time.Duration
+}
+
+// ReadRetry is for reads and other statements that are safe to run twice.
+// Writes are not retried unless the caller knows they are idempotent
+var ReadRetry = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 50 * time.Millisecond,
+	MaxDelay:  time.Second,
+}
+
+// Postgres error codes worth retrying
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+	adminShutdownCode        = "57P01"
+	crashShutdownCode        = "57P02"
+	cannotConnectNowCode     = "57P03"
+)
+
+// Retry runs fn until it succeeds, fails with an error that isn't transient,
+// or runs out of attempts. It never sleeps past the context deadline, the
+// last error is returned instead
+func Retry(ctx context.Context, p RetryPolicy, fn func() error) error {
+	delay := p.BaseDelay
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= p.Attempts || !IsRetryable(err) {
+			return err
+		}
+
+		// Full jitter so retrying clients don't hit a recovering server in step
+		wait := time.Duration(rand.Int64N(int64(delay) + 1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay = min(delay*2, p.MaxDelay)
+	}
+}
+
+// IsRetryable reports whether err is a transient failure: a dropped
+// connection, a server shutting down or failing over, or a serialization
+// conflict. Constraint violations, missing rows and cancellations are not
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case serializationFailureCode, deadlockDetectedCode,
+			adminShutdownCode, crashShutdownCode, cannotConnectNowCode:
+			return true
+		}
+		// Class 08 is connection exceptions
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	// The query never reached the server, so running it again is safe
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
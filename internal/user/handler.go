@@ -2,45 +2,118 @@ package user
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/rx3lixir/laba_zis/internal/auth"
 	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+	"github.com/rx3lixir/laba_zis/pkg/mail"
 	"github.com/rx3lixir/laba_zis/pkg/password"
+	"github.com/rx3lixir/laba_zis/pkg/ratelimit"
+)
+
+const (
+	defaultUsersLimit = 10
+
+	// Username search needs a short prefix at least and returns a small page
+	minSearchQueryLen  = 2
+	defaultSearchLimit = 10
+	maxSearchLimit     = 25
+
+	// Account deletion leaves every room and deletes messages in bulk, so it
+	// gets longer than a single query. S3 cleanup is queued, not waited on
+	accountCleanupTimeout = 30 * time.Second
+
+	// Verification emails can be resent a few times in a row, then one per 10 minutes
+	resendVerificationBurst    = 3
+	resendVerificationInterval = 10 * time.Minute
 )
 
 type Handler struct {
-	store       Store
-	authService *auth.Service
-	log         *slog.Logger
-	dbTimeout   time.Duration
+	store        Store
+	authService  *auth.Service
+	loginLimiter *LoginLimiter
+	mailer       mail.Mailer
+	presence     Presence
+	cleaner      AccountCleaner
+	cfg          Config
+	// resendLimiter limits verification emails per address
+	resendLimiter ratelimit.Limiter
+	log           *slog.Logger
+	dbTimeout     time.Duration
+}
+
+// Config holds user-facing settings of the user handler
+type Config struct {
+	// ResetPasswordURL is the frontend page that takes a reset token as ?token=.
+	// When empty the raw token is emailed instead
+	ResetPasswordURL string
+	// VerifyEmailURL is the frontend page that takes a verification token as ?token=.
+	// When empty the raw token is emailed instead
+	VerifyEmailURL string
+	// AdminUserIDs may delete other users' accounts, like users with auth.RoleAdmin
+	AdminUserIDs []uuid.UUID
 }
 
-func NewHandler(store Store, authService *auth.Service, log *slog.Logger, dbTimeout time.Duration) *Handler {
+func NewHandler(
+	store Store,
+	authService *auth.Service,
+	loginLimiter *LoginLimiter,
+	mailer mail.Mailer,
+	presence Presence,
+	cleaner AccountCleaner,
+	cfg Config,
+	log *slog.Logger,
+	dbTimeout time.Duration,
+) *Handler {
 	if dbTimeout == 0 {
 		dbTimeout = 5 * time.Second
 	}
-	return &Handler{store, authService, log, dbTimeout}
+	resendLimiter := ratelimit.NewMemoryLimiter(ratelimit.Rate{
+		PerSecond: 1 / resendVerificationInterval.Seconds(),
+		Burst:     resendVerificationBurst,
+	})
+	return &Handler{store, authService, loginLimiter, mailer, presence, cleaner, cfg, resendLimiter, log, dbTimeout}
 }
 
 func (h *Handler) RegisterUserRoutes(r chi.Router) {
 	r.Get("/", httputil.Handler(h.HandleGetAllUsers, h.log))
+	r.Get("/search", httputil.Handler(h.HandleSearchUsers, h.log))
 	r.Get("/{id}", httputil.Handler(h.HandleGetUserByID, h.log))
+	r.Get("/{id}/presence", httputil.Handler(h.HandleGetPresence, h.log))
 	r.Get("/email/{email}", httputil.Handler(h.HandleGetUserByEmail, h.log))
 	r.Delete("/{id}", httputil.Handler(h.HandleDeleteUser, h.log))
 	r.Get("/me", httputil.Handler(h.HandleMe, h.log))
+	r.Patch("/me", httputil.Handler(h.HandleUpdateMe, h.log))
+	r.Post("/me/password", httputil.Handler(h.HandleChangePassword, h.log))
+}
+
+// RegisterPublicUserRoutes adds the /user routes that work without signing in
+func (h *Handler) RegisterPublicUserRoutes(r chi.Router) {
+	r.Get("/username-available", httputil.Handler(h.HandleUsernameAvailable, h.log))
 }
 
 func (h *Handler) RegisterAuthRoutes(r chi.Router) {
 	r.Post("/signup", httputil.Handler(h.HandleSignup, h.log))
 	r.Post("/signin", httputil.Handler(h.HandleSignin, h.log))
 	r.Post("/refresh", httputil.Handler(h.HandleRefreshToken, h.log))
+	r.Post("/logout", httputil.Handler(h.HandleLogout, h.log))
+	r.Post("/forgot-password", httputil.Handler(h.HandleForgotPassword, h.log))
+	r.Post("/reset-password", httputil.Handler(h.HandleResetPassword, h.log))
+	r.Get("/verify-email", httputil.Handler(h.HandleVerifyEmail, h.log))
+	r.Post("/verify-email", httputil.Handler(h.HandleVerifyEmail, h.log))
+	r.Post("/verify-email/resend", httputil.Handler(h.HandleResendVerification, h.log))
+	r.Get("/.well-known/jwks.json", httputil.Handler(h.HandleJWKS, h.log))
 }
 
 func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
@@ -49,13 +122,14 @@ func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
 
 // HandleMe returns the currently authenticated user's profile.
 func (h *Handler) HandleMe(w http.ResponseWriter, r *http.Request) error {
-	userID := auth.GetUserID(r.Context())
-	if userID == uuid.Nil {
-		h.log.Debug("me endpoint accessed without authentication")
+	log := logger.FromContext(r.Context())
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		log.Debug("me endpoint accessed without authentication")
 		return httputil.Unauthorized("User ID is invalid")
 	}
 
-	h.log.Debug("get current user request",
+	log.Debug("get current user request",
 		"user_id", userID)
 
 	ctx, cancel := h.dbCtx(r)
@@ -63,44 +137,217 @@ func (h *Handler) HandleMe(w http.ResponseWriter, r *http.Request) error {
 
 	user, err := h.store.GetUserByID(ctx, userID)
 	if err != nil {
-		h.log.Error("failed to retrieve current user from database",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to retrieve current user from database",
 			"user_id", userID,
 			"error", err)
-		return httputil.NotFound("User not found")
+		return httputil.Internal(err)
 	}
 
 	response := map[string]any{
-		"id":       user.ID,
-		"username": user.Username,
-		"email":    user.Email,
+		"id":             user.ID,
+		"username":       user.Username,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
+// HandleUpdateMe changes the current user's username and/or email
+func (h *Handler) HandleUpdateMe(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		return httputil.Unauthorized("User ID is invalid")
+	}
+
+	req := new(UpdateProfileRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if req.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*req.Email))
+		req.Email = &email
+	}
+
+	log.Debug("update profile request",
+		"user_id", userID)
+
+	if err := validateUpdateProfileRequest(req); err != nil {
+		return validationFailed(err)
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to retrieve user for update",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if req.Username != nil {
+		user.Username = *req.Username
+	}
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if emailChanged {
+		user.Email = *req.Email
+		user.EmailVerified = false
+	}
+
+	if err := h.store.UpdateUser(ctx, user); err != nil {
+		if conflict := userConflict(err); conflict != nil {
+			return conflict
+		}
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to update user",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Info("user profile updated",
+		"user_id", userID,
+		"email_changed", emailChanged)
+
+	if emailChanged {
+		go h.sendVerification(user.ID, user.Email)
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, UserResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	})
+}
+
+// HandleChangePassword replaces the current user's password and logs out every
+// other session. The caller gets a fresh token pair so it stays signed in
+func (h *Handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID, ok := auth.UserIDFromContext(r.Context())
+	if !ok {
+		return httputil.Unauthorized("User ID is invalid")
+	}
+
+	req := new(ChangePasswordRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	log.Debug("change password request",
+		"user_id", userID)
+
+	if err := validateChangePasswordRequest(req); err != nil {
+		return validationFailed(err)
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to retrieve user for password change",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if !password.Verify(req.CurrentPassword, user.Password) {
+		log.Warn("password change failed - invalid current password",
+			"user_id", userID)
+		return httputil.Unauthorized("Current password is incorrect")
+	}
+
+	hashedPassword, err := password.Hash(req.NewPassword)
+	if err != nil {
+		log.Error("failed to hash password",
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if err := h.store.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to update password",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if err := h.authService.RevokeUserSessions(ctx, userID); err != nil {
+		log.Error("failed to revoke sessions after password change",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	accessToken, err := h.authService.GenerateAccessToken(user.ID, user.Email, user.Username, user.Role, user.EmailVerified)
+	if err != nil {
+		log.Error("failed to generate access token",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	refreshToken, err := h.authService.GenerateRefreshToken(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to generate refresh token",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Info("user password changed",
+		"user_id", userID)
+
+	return httputil.RespondJSON(w, http.StatusOK, RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+	})
+}
+
 // HandleCreateUser - creates a new user
 func (h *Handler) HandleCreateUser(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	req := new(CreateUserRequest)
 	if err := httputil.DecodeJSON(r, req); err != nil {
 		return err
 	}
 
-	h.log.Debug("create user request received",
+	log.Debug("create user request received",
 		"email", req.Email,
 		"username", req.Username)
 
 	if err := validateCreateUserRequest(req); err != nil {
-		h.log.Debug("user validation failed",
+		log.Debug("user validation failed",
 			"email", req.Email,
 			"error", err)
-		return httputil.BadRequest("Validation failed", map[string]string{
-			"validation_error": err.Error(),
-		})
+		return validationFailed(err)
 	}
 
 	hashedPassword, err := password.Hash(req.Password)
 	if err != nil {
-		h.log.Error("failed to hash password",
+		log.Error("failed to hash password",
 			"error", err)
 		return httputil.Internal(err)
 	}
@@ -114,14 +361,21 @@ func (h *Handler) HandleCreateUser(w http.ResponseWriter, r *http.Request) error
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
+	if err := h.checkUsernameAvailable(ctx, newUser.Username); err != nil {
+		return err
+	}
+
 	if err := h.store.CreateUser(ctx, newUser); err != nil {
-		h.log.Error("failed to create user in database",
+		if conflict := userConflict(err); conflict != nil {
+			return conflict
+		}
+		log.Error("failed to create user in database",
 			"email", newUser.Email,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("user created successfully",
+	log.Info("user created successfully",
 		"user_id", newUser.ID,
 		"email", newUser.Email,
 		"username", newUser.Username)
@@ -136,14 +390,94 @@ func (h *Handler) HandleCreateUser(w http.ResponseWriter, r *http.Request) error
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
+// HandleSearchUsers finds users by username prefix
+func (h *Handler) HandleSearchUsers(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(q) < minSearchQueryLen {
+		return httputil.BadRequest(fmt.Sprintf("q must be at least %d characters", minSearchQueryLen))
+	}
+
+	limit := defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return httputil.BadRequest(fmt.Sprintf("limit must be an integer between 1 and %d", maxSearchLimit))
+		}
+		limit = n
+	}
+
+	log.Debug("search users request",
+		"query", q,
+		"limit", limit)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	users, err := h.store.SearchUsersByUsername(ctx, q, limit)
+	if err != nil {
+		log.Error("failed to search users",
+			"query", q,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	userResponses := make([]UserResponse, 0, len(users))
+	for _, user := range users {
+		userResponses = append(userResponses, UserResponse{
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
+		})
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, SearchUsersResponse{
+		Users: userResponses,
+		Count: len(userResponses),
+	})
+}
+
+// HandleGetPresence returns whether a user is online and when they were last seen
+func (h *Handler) HandleGetPresence(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	id, err := httputil.ParseUUID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	lastSeen, err := h.store.GetLastSeen(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to get user last seen",
+			"user_id", id,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, PresenceResponse{
+		UserID:     id,
+		Online:     h.presence.IsUserOnline(id),
+		LastSeenAt: lastSeen,
+	})
+}
+
 // HandleGetUserByID retrieves a user by their UUID.
 func (h *Handler) HandleGetUserByID(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID, err := httputil.ParseUUID(r, "id")
 	if err != nil {
 		return err
 	}
 
-	h.log.Debug("get user by ID request",
+	log.Debug("get user by ID request",
 		"user_id", userID)
 
 	ctx, cancel := h.dbCtx(r)
@@ -151,44 +485,38 @@ func (h *Handler) HandleGetUserByID(w http.ResponseWriter, r *http.Request) erro
 
 	user, err := h.store.GetUserByID(ctx, userID)
 	if err != nil {
-		h.log.Debug("user not found",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to get user",
 			"user_id", userID,
 			"error", err)
-		return httputil.NotFound("User not found")
+		return httputil.Internal(err)
 	}
 
 	response := UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
 // HandleGetAllUsers returns a paginated list of users.
+// limit defaults to 10 and is capped at httputil.MaxPageLimit
 func (h *Handler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request) error {
-	limit := 10
-	offset := 0
-
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-			if limit > 100 {
-				limit = 100
-			}
-		}
-	}
-
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	log := logger.FromContext(r.Context())
+	page, err := httputil.ParsePagination(r, defaultUsersLimit)
+	if err != nil {
+		return err
 	}
+	limit, offset := page.Limit, page.Offset
 
-	h.log.Debug("get all users request",
+	log.Debug("get all users request",
 		"limit", limit,
 		"offset", offset)
 
@@ -197,7 +525,14 @@ func (h *Handler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request) erro
 
 	users, err := h.store.GetAllUsers(ctx, limit, offset)
 	if err != nil {
-		h.log.Error("failed to retrieve users from database",
+		log.Error("failed to retrieve users from database",
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	total, err := h.store.CountUsers(ctx)
+	if err != nil {
+		log.Error("failed to count users",
 			"error", err)
 		return httputil.Internal(err)
 	}
@@ -206,22 +541,25 @@ func (h *Handler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request) erro
 	userResponses := make([]UserResponse, 0, len(users))
 	for _, user := range users {
 		userResponses = append(userResponses, UserResponse{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
 		})
 	}
 
-	h.log.Debug("users retrieved",
-		"count", len(users))
+	log.Debug("users retrieved",
+		"count", len(users),
+		"total", total)
 
 	response := GetAllUsersResponse{
 		Users:      userResponses,
-		TotalCount: len(userResponses),
+		TotalCount: total,
 		Limit:      limit,
 		Offset:     offset,
+		HasMore:    offset+len(userResponses) < total,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
@@ -229,12 +567,13 @@ func (h *Handler) HandleGetAllUsers(w http.ResponseWriter, r *http.Request) erro
 
 // HandleGetUserByEmail retrieves a user by their email address (case-insensitive).
 func (h *Handler) HandleGetUserByEmail(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	email := chi.URLParam(r, "email")
 	if email == "" {
 		return httputil.BadRequest("email is required")
 	}
 
-	h.log.Debug("get user by email request",
+	log.Debug("get user by email request",
 		"email", email)
 
 	ctx, cancel := h.dbCtx(r)
@@ -242,49 +581,97 @@ func (h *Handler) HandleGetUserByEmail(w http.ResponseWriter, r *http.Request) e
 
 	user, err := h.store.GetUserByEmail(ctx, email)
 	if err != nil {
-		h.log.Debug("user not found by email",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to get user by email",
 			"email", email,
 			"error", err)
-		return httputil.NotFound("User not found")
+		return httputil.Internal(err)
 	}
 
 	response := UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
-// HandleDeleteUser permanently removes a user by their UUID.
+// HandleDeleteUser permanently removes a user by their UUID, along with their
+// room memberships and messages. With ?anonymize=true the messages are kept
+// without a sender instead, for audit and compliance. Only the account owner
+// or an admin may delete it.
 func (h *Handler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID, err := httputil.ParseUUID(r, "id")
 	if err != nil {
 		return err
 	}
 
-	h.log.Debug("delete user request",
-		"user_id", userID)
+	anonymize := false
+	if raw := r.URL.Query().Get("anonymize"); raw != "" {
+		anonymize, err = strconv.ParseBool(raw)
+		if err != nil {
+			return httputil.BadRequest("Invalid anonymize parameter")
+		}
+	}
 
-	ctx, cancel := h.dbCtx(r)
+	// Cleanup wipes the account's rooms and messages, so only the owner or an admin may start it
+	callerID := auth.GetUserID(r.Context())
+	if userID != callerID && !auth.HasRole(r.Context(), auth.RoleAdmin, h.cfg.AdminUserIDs...) {
+		log.Warn("delete user blocked - not the account owner",
+			"user_id", userID,
+			"caller_id", callerID)
+		return httputil.Forbidden("You can only delete your own account")
+	}
+
+	log.Debug("delete user request",
+		"user_id", userID,
+		"anonymize", anonymize)
+
+	ctx, cancel := context.WithTimeout(r.Context(), accountCleanupTimeout)
 	defer cancel()
 
+	if _, err := h.store.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to retrieve user for deletion",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if err := h.cleaner.CleanupAccount(ctx, userID, anonymize); err != nil {
+		log.Error("failed to clean up account before deletion",
+			"user_id", userID,
+			"anonymize", anonymize,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
 	if err := h.store.DeleteUser(ctx, userID); err != nil {
-		h.log.Error("failed to delete user from database",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("failed to delete user from database",
 			"user_id", userID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("user deleted successfully",
+	log.Info("user deleted successfully",
 		"user_id", userID)
 
 	response := DeleteUserResponse{
-		Message: "User deleted successfully",
-		ID:      userID,
+		Message:    "User deleted successfully",
+		ID:         userID,
+		Anonymized: anonymize,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
@@ -292,12 +679,13 @@ func (h *Handler) HandleDeleteUser(w http.ResponseWriter, r *http.Request) error
 
 // HandleSignup creates a new user account and immediately returns access + refresh JWT tokens.
 func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	req := new(SignupRequest)
 	if err := httputil.DecodeJSON(r, req); err != nil {
 		return err
 	}
 
-	h.log.Debug("signup request received",
+	log.Debug("signup request received",
 		"email", req.Email,
 		"username", req.Username)
 
@@ -310,12 +698,10 @@ func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) error {
 		},
 	)
 	if err != nil {
-		h.log.Debug("signup validation failed",
+		log.Debug("signup validation failed",
 			"email", req.Email,
 			"error", err)
-		return httputil.BadRequest("Validation failed", map[string]string{
-			"validation_error": err.Error(),
-		})
+		return validationFailed(err)
 	}
 
 	ctx, cancel := h.dbCtx(r)
@@ -326,21 +712,25 @@ func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) error {
 
 	userExists, err := h.store.ExistsByEmail(ctx, email)
 	if err != nil {
-		h.log.Error("failed to check existing user",
+		log.Error("failed to check existing user",
 			"email", email,
 			"error", err)
 		return httputil.Internal(err)
 	}
 	if userExists {
-		h.log.Warn("signup blocked - email already exists",
+		log.Warn("signup blocked - email already exists",
 			"email", email)
-		return httputil.BadRequest("User with this email already exists")
+		return httputil.Conflict("User with this email already exists")
+	}
+
+	if err := h.checkUsernameAvailable(ctx, req.Username); err != nil {
+		return err
 	}
 
 	// Hash password
 	hashedPassword, err := password.Hash(req.Password)
 	if err != nil {
-		h.log.Error("failed to hash password during signup",
+		log.Error("failed to hash password during signup",
 			"error", err)
 		return httputil.Internal(err)
 	}
@@ -349,44 +739,54 @@ func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) error {
 		Username: req.Username,
 		Email:    email,
 		Password: string(hashedPassword),
+		Role:     auth.RoleUser,
 	}
 
 	if err := h.store.CreateUser(ctx, newUser); err != nil {
-		h.log.Error("failed to create user during signup",
+		if conflict := userConflict(err); conflict != nil {
+			log.Warn("signup blocked - account already exists",
+				"email", email,
+				"error", err)
+			return conflict
+		}
+		log.Error("failed to create user during signup",
 			"email", email,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
 	// Generate tokens
-	accessToken, err := h.authService.GenerateAccessToken(newUser.ID, newUser.Email, newUser.Username)
+	accessToken, err := h.authService.GenerateAccessToken(newUser.ID, newUser.Email, newUser.Username, newUser.Role, newUser.EmailVerified)
 	if err != nil {
-		h.log.Error("failed to generate access token",
+		log.Error("failed to generate access token",
 			"user_id", newUser.ID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	refreshToken, err := h.authService.GenerateRefreshToken(newUser.ID)
+	refreshToken, err := h.authService.GenerateRefreshToken(ctx, newUser.ID)
 	if err != nil {
-		h.log.Error("failed to generate refresh token",
+		log.Error("failed to generate refresh token",
 			"user_id", newUser.ID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("user signed up successfully",
+	log.Info("user signed up successfully",
 		"user_id", newUser.ID,
 		"email", newUser.Email,
 		"username", newUser.Username)
 
+	go h.sendVerification(newUser.ID, newUser.Email)
+
 	response := SignupResponse{
 		User: UserResponse{
-			ID:        newUser.ID,
-			Username:  newUser.Username,
-			Email:     newUser.Email,
-			CreatedAt: newUser.CreatedAt,
-			UpdatedAt: newUser.UpdatedAt,
+			ID:            newUser.ID,
+			Username:      newUser.Username,
+			Email:         newUser.Email,
+			EmailVerified: newUser.EmailVerified,
+			CreatedAt:     newUser.CreatedAt,
+			UpdatedAt:     newUser.UpdatedAt,
 		},
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -398,12 +798,13 @@ func (h *Handler) HandleSignup(w http.ResponseWriter, r *http.Request) error {
 
 // HandleSignin authenticates a user and returns JWT pair of tokens
 func (h *Handler) HandleSignin(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	req := new(SigninRequest)
 	if err := httputil.DecodeJSON(r, req); err != nil {
 		return err
 	}
 
-	h.log.Debug("signin request received",
+	log.Debug("signin request received",
 		"email", req.Email)
 
 	if req.Email == "" {
@@ -413,52 +814,68 @@ func (h *Handler) HandleSignin(w http.ResponseWriter, r *http.Request) error {
 		return httputil.BadRequest("Password is required")
 	}
 
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	if retryAfter, locked := h.loginLimiter.Locked(email); locked {
+		log.Warn("signin rejected - account locked",
+			"email", email,
+			"retry_after", retryAfter)
+		return httputil.TooManyRequests("Too many failed signin attempts, try again later", retryAfter)
+	}
+
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	email := strings.ToLower(strings.TrimSpace(req.Email))
 	user, err := h.store.GetUserByEmail(ctx, email)
-	if err != nil {
-		h.log.Warn("signin failed - user not found",
+	if errors.Is(err, ErrNotFound) {
+		log.Warn("signin failed - user not found",
 			"email", email)
-		return httputil.Unauthorized("Invalid email or password")
+		return h.signinFailed(email)
+	}
+	if err != nil {
+		log.Error("signin failed - could not load user",
+			"error", err)
+		return httputil.Internal(err)
 	}
 
 	if !password.Verify(req.Password, user.Password) {
-		h.log.Warn("signin failed - invalid password",
+		log.Warn("signin failed - invalid password",
 			"email", email,
 			"user_id", user.ID)
-		return httputil.Unauthorized("Invalid email or password")
+		return h.signinFailed(email)
 	}
 
+	h.loginLimiter.Reset(email)
+
 	// Generate tokens
-	accessToken, err := h.authService.GenerateAccessToken(user.ID, user.Email, user.Username)
+	accessToken, err := h.authService.GenerateAccessToken(user.ID, user.Email, user.Username, user.Role, user.EmailVerified)
 	if err != nil {
-		h.log.Error("failed to generate access token",
+		log.Error("failed to generate access token",
 			"user_id", user.ID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	refreshToken, err := h.authService.GenerateRefreshToken(user.ID)
+	refreshToken, err := h.authService.GenerateRefreshToken(ctx, user.ID)
 	if err != nil {
-		h.log.Error("failed to generate refresh token",
+		log.Error("failed to generate refresh token",
 			"user_id", user.ID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("user signed in successfully",
+	log.Info("user signed in successfully",
 		"user_id", user.ID,
 		"email", user.Email)
 
 	response := SigninResponse{
 		User: UserResponse{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
 		},
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -468,63 +885,136 @@ func (h *Handler) HandleSignin(w http.ResponseWriter, r *http.Request) error {
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
+// userConflict translates unique constraint errors from the store into 409s
+func userConflict(err error) error {
+	switch {
+	case errors.Is(err, ErrEmailExists):
+		return httputil.Conflict("User with this email already exists")
+	case errors.Is(err, ErrUsernameExists):
+		return httputil.Conflict("User with this username already exists")
+	default:
+		return nil
+	}
+}
+
+// checkUsernameAvailable returns a 409 when the username is taken in any case.
+// The unique index still catches a concurrent signup, this gives the common case a clean error
+func (h *Handler) checkUsernameAvailable(ctx context.Context, username string) error {
+	log := logger.FromContext(ctx)
+	taken, err := h.store.ExistsByUsername(ctx, username)
+	if err != nil {
+		log.Error("failed to check username availability",
+			"username", username,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if taken {
+		log.Debug("username already taken",
+			"username", username)
+		return httputil.Conflict("User with this username already exists")
+	}
+	return nil
+}
+
+// HandleUsernameAvailable tells clients whether a username can be used, so
+// forms can check before submitting. The answer isn't a reservation
+func (h *Handler) HandleUsernameAvailable(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	username := r.URL.Query().Get("username")
+	if err := validateUsername(username); err != nil {
+		return httputil.BadRequest("Validation failed", map[string]string{
+			"username": err.Error(),
+		})
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	taken, err := h.store.ExistsByUsername(ctx, username)
+	if err != nil {
+		log.Error("failed to check username availability",
+			"username", username,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, UsernameAvailableResponse{
+		Username:  username,
+		Available: !taken,
+	})
+}
+
+// signinFailed counts the failure against email. Unknown emails are counted
+// too so the lockout doesn't reveal which accounts exist
+func (h *Handler) signinFailed(email string) error {
+	if lockout, locked := h.loginLimiter.RecordFailure(email); locked {
+		h.log.Warn("account locked after repeated signin failures",
+			"email", email,
+			"lockout", lockout)
+		return httputil.TooManyRequests("Too many failed signin attempts, try again later", lockout)
+	}
+	return httputil.Unauthorized("Invalid email or password")
+}
+
 // HandleRefreshToken generates new tokens using a refresh token
 func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	req := new(RefreshTokenRequest)
 	if err := httputil.DecodeJSON(r, req); err != nil {
 		return err
 	}
 
-	h.log.Debug("token refresh request received")
+	log.Debug("token refresh request received")
 
 	if req.RefreshToken == "" {
 		return httputil.BadRequest("Refresh token is required")
 	}
 
-	userID, err := h.authService.ValidateRefreshToken(req.RefreshToken)
-	if err != nil {
-		h.log.Warn("token refresh failed - invalid token",
-			"error", err)
-		return httputil.Unauthorized("Invalid or expired refresh token")
-	}
-
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	user, err := h.store.GetUserByID(ctx, userID)
+	current, err := h.authService.ValidateRefreshToken(ctx, req.RefreshToken)
 	if err != nil {
-		h.log.Error("token refresh failed - user not found",
-			"user_id", userID,
-			"error", err)
-		return httputil.NotFound("User not found")
+		return h.refreshTokenError(ctx, err)
 	}
+	userID := current.UserID
 
-	newAccessToken, err := h.authService.GenerateAccessToken(userID, user.Email, user.Username)
+	user, err := h.store.GetUserByID(ctx, userID)
 	if err != nil {
-		h.log.Error("failed to generate new access token",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("User not found")
+		}
+		log.Error("token refresh failed - could not load user",
 			"user_id", userID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	newRefreshToken, err := h.authService.GenerateRefreshToken(userID)
+	// Rotate first so a failed rotation never hands out a new access token
+	newRefreshToken, err := h.authService.RotateRefreshToken(ctx, current)
 	if err != nil {
-		h.log.Error("failed to generate new refresh token",
+		return h.refreshTokenError(ctx, err)
+	}
+
+	newAccessToken, err := h.authService.GenerateAccessToken(userID, user.Email, user.Username, user.Role, user.EmailVerified)
+	if err != nil {
+		log.Error("failed to generate new access token",
 			"user_id", userID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("tokens refreshed successfully",
+	log.Info("tokens refreshed successfully",
 		"user_id", user.ID)
 
 	response := SigninResponse{
 		User: UserResponse{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
+			ID:            user.ID,
+			Username:      user.Username,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt,
+			UpdatedAt:     user.UpdatedAt,
 		},
 		AccessToken:  newAccessToken,
 		RefreshToken: newRefreshToken,
@@ -533,3 +1023,214 @@ func (h *Handler) HandleRefreshToken(w http.ResponseWriter, r *http.Request) err
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
+
+// HandleLogout revokes the given refresh token. It is idempotent and accepts
+// expired tokens, so clients can call it unconditionally on exit
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	req := new(LogoutRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if req.RefreshToken == "" {
+		return httputil.BadRequest("Refresh token is required")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	if err := h.authService.RevokeRefreshToken(ctx, req.RefreshToken); err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			log.Warn("logout failed - invalid refresh token",
+				"error", err)
+			return httputil.Unauthorized("Invalid refresh token")
+		}
+		log.Error("failed to revoke refresh token on logout",
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Debug("refresh token revoked on logout")
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// refreshTokenError maps refresh token validation/rotation failures to a 401.
+// On reuse of an already rotated token the whole token family is revoked,
+// since one of the holders is not the legitimate client
+func (h *Handler) refreshTokenError(ctx context.Context, err error) error {
+	log := logger.FromContext(ctx)
+	var reused *auth.ReusedTokenError
+	if !errors.As(err, &reused) {
+		log.Warn("token refresh failed - invalid token",
+			"error", err)
+		return httputil.Unauthorized("Invalid or expired refresh token")
+	}
+
+	log.Warn("refresh token reuse detected, revoking token family",
+		"user_id", reused.UserID,
+		"family_id", reused.FamilyID)
+
+	if revokeErr := h.authService.RevokeTokenFamily(ctx, reused.FamilyID); revokeErr != nil {
+		log.Error("failed to revoke refresh token family",
+			"user_id", reused.UserID,
+			"family_id", reused.FamilyID,
+			"error", revokeErr)
+		return httputil.Internal(revokeErr)
+	}
+
+	return httputil.Unauthorized("Invalid or expired refresh token")
+}
+
+// HandleJWKS publishes the public key used to sign access tokens.
+// There is nothing to publish when tokens are signed with a shared secret
+func (h *Handler) HandleJWKS(w http.ResponseWriter, r *http.Request) error {
+	jwks, ok := h.authService.JWKS()
+	if !ok {
+		return httputil.NotFound("No public signing keys available")
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, jwks)
+}
+
+// HandleForgotPassword emails a password reset token. It always answers 200
+// and sends the email in the background, so the response doesn't reveal
+// whether an account exists
+func (h *Handler) HandleForgotPassword(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	req := new(ForgotPasswordRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return httputil.BadRequest("Email is required")
+	}
+
+	log.Debug("forgot password request received",
+		"email", email)
+
+	go h.sendPasswordReset(email)
+
+	return httputil.RespondJSON(w, http.StatusOK, MessageResponse{
+		Message: "If an account with this email exists, a reset link has been sent",
+	})
+}
+
+func (h *Handler) sendPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.dbTimeout)
+	defer cancel()
+
+	user, err := h.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		h.log.Debug("password reset requested for unknown email",
+			"email", email)
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to load user for password reset",
+			"error", err)
+		return
+	}
+
+	token, err := h.authService.GeneratePasswordResetToken(user.ID, user.Password)
+	if err != nil {
+		h.log.Error("failed to generate password reset token",
+			"user_id", user.ID,
+			"error", err)
+		return
+	}
+
+	body := "Use this token to reset your password: " + token
+	if h.cfg.ResetPasswordURL != "" {
+		body = "Follow this link to reset your password: " + h.cfg.ResetPasswordURL + "?token=" + url.QueryEscape(token)
+	}
+	body += "\n\nThe link expires in 15 minutes. If you didn't ask for a reset, ignore this email."
+
+	if err := h.mailer.Send(ctx, user.Email, "Reset your password", body); err != nil {
+		h.log.Error("failed to send password reset email",
+			"user_id", user.ID,
+			"error", err)
+		return
+	}
+
+	h.log.Info("password reset email sent",
+		"user_id", user.ID)
+}
+
+// HandleResetPassword sets a new password using a token from HandleForgotPassword.
+// The token is bound to the old password hash, so it can only be used once
+func (h *Handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	req := new(ResetPasswordRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	if err := validateResetPasswordRequest(req); err != nil {
+		return validationFailed(err)
+	}
+
+	claims, userID, err := h.authService.ValidatePasswordResetToken(req.Token)
+	if err != nil {
+		log.Debug("invalid password reset token",
+			"error", err)
+		return httputil.BadRequest("Invalid or expired reset token")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		log.Error("failed to load user for password reset",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if err != nil || !claims.MatchesPassword(user.Password) {
+		log.Warn("password reset token already used or user gone",
+			"user_id", userID)
+		return httputil.BadRequest("Invalid or expired reset token")
+	}
+
+	hashedPassword, err := password.Hash(req.NewPassword)
+	if err != nil {
+		log.Error("failed to hash password",
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	// Conditional on the hash the token was checked against, a concurrent reset
+	// with the same token that got there first leaves nothing to update
+	if err := h.store.ReplacePassword(ctx, userID, user.Password, hashedPassword); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			log.Warn("password reset token used concurrently or user gone",
+				"user_id", userID)
+			return httputil.BadRequest("Invalid or expired reset token")
+		}
+		log.Error("failed to reset password",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if err := h.authService.RevokeUserSessions(ctx, userID); err != nil {
+		log.Error("failed to revoke sessions after password reset",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	h.loginLimiter.Reset(user.Email)
+
+	log.Info("user password reset",
+		"user_id", userID)
+
+	return httputil.RespondJSON(w, http.StatusOK, MessageResponse{
+		Message: "Password has been reset",
+	})
+}
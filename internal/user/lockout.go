@@ -0,0 +1,117 @@
+package user
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginLimiter locks an email out of signin after too many failed attempts
+// within a sliding window. State is kept in memory, so each instance counts
+// attempts on its own
+type LoginLimiter struct {
+	mu sync.Mutex
+
+	maxAttempts int
+	window      time.Duration
+	lockout     time.Duration
+
+	attempts  map[string]*loginAttempts
+	lastPrune time.Time
+}
+
+type loginAttempts struct {
+	failures    []time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter locks an email for lockout after maxAttempts failures within window.
+// A maxAttempts of zero disables the limiter
+func NewLoginLimiter(maxAttempts int, window, lockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxAttempts: maxAttempts,
+		window:      window,
+		lockout:     lockout,
+		attempts:    make(map[string]*loginAttempts),
+	}
+}
+
+// Locked reports whether email is locked and for how much longer
+func (l *LoginLimiter) Locked(email string) (time.Duration, bool) {
+	if l.maxAttempts <= 0 {
+		return 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[email]
+	if !ok {
+		return 0, false
+	}
+
+	remaining := time.Until(a.lockedUntil)
+	return remaining, remaining > 0
+}
+
+// RecordFailure counts a failed signin and returns the lockout duration
+// if this failure tripped the limit
+func (l *LoginLimiter) RecordFailure(email string) (time.Duration, bool) {
+	if l.maxAttempts <= 0 {
+		return 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	a, ok := l.attempts[email]
+	if !ok {
+		a = &loginAttempts{}
+		l.attempts[email] = a
+	}
+
+	a.failures = append(recent(a.failures, now.Add(-l.window)), now)
+	if len(a.failures) < l.maxAttempts {
+		return 0, false
+	}
+
+	a.failures = nil
+	a.lockedUntil = now.Add(l.lockout)
+	return l.lockout, true
+}
+
+// Reset clears the failure count after a successful signin
+func (l *LoginLimiter) Reset(email string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.attempts, email)
+}
+
+// prune drops entries with no recent failures and no active lock, at most once per window
+func (l *LoginLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.window {
+		return
+	}
+	l.lastPrune = now
+
+	cutoff := now.Add(-l.window)
+	for email, a := range l.attempts {
+		a.failures = recent(a.failures, cutoff)
+		if len(a.failures) == 0 && now.After(a.lockedUntil) {
+			delete(l.attempts, email)
+		}
+	}
+}
+
+// recent returns the failures after cutoff, failures are in chronological order
+func recent(failures []time.Time, cutoff time.Time) []time.Time {
+	for i, t := range failures {
+		if t.After(cutoff) {
+			return failures[i:]
+		}
+	}
+	return failures[:0]
+}
@@ -4,13 +4,21 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Postgres error code for unique_violation
+const uniqueViolationCode = "23505"
+
+// likeEscaper makes user input match literally inside a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type PostgresStore struct {
 	pool *pgxpool.Pool
 }
@@ -22,8 +30,8 @@ func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
 // CreateUser creates a new user in Postgres
 func (s *PostgresStore) CreateUser(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO users (id, username, email, password, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (id, username, email, password, role, email_verified, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	`
 	user.ID = uuid.New()
 	now := time.Now()
@@ -36,6 +44,8 @@ func (s *PostgresStore) CreateUser(ctx context.Context, user *User) error {
 		user.Username,
 		user.Email,
 		user.Password,
+		user.Role,
+		user.EmailVerified,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -43,16 +53,36 @@ func (s *PostgresStore) CreateUser(ctx context.Context, user *User) error {
 		if ctx.Err() != nil {
 			return fmt.Errorf("operation cancelled: %w", ctx.Err())
 		}
+		if uniqueErr := uniqueViolation(err); uniqueErr != nil {
+			return uniqueErr
+		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return nil
 }
 
+// uniqueViolation maps a unique constraint error on users to a typed error
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationCode {
+		return nil
+	}
+
+	switch pgErr.ConstraintName {
+	case "users_email_key":
+		return ErrEmailExists
+	case "users_username_key", "users_username_lower_key":
+		return ErrUsernameExists
+	default:
+		return fmt.Errorf("unique constraint %s violated: %w", pgErr.ConstraintName, err)
+	}
+}
+
 // GetUserByID retrieves a user with passed ID from Postgres
 func (s *PostgresStore) GetUserByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at, updated_at
+		SELECT id, username, email, password, role, email_verified, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -62,12 +92,14 @@ func (s *PostgresStore) GetUserByID(ctx context.Context, id uuid.UUID) (*User, e
 		&user.Username,
 		&user.Email,
 		&user.Password,
+		&user.Role,
+		&user.EmailVerified,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("failed to get user: %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -78,7 +110,7 @@ func (s *PostgresStore) GetUserByID(ctx context.Context, id uuid.UUID) (*User, e
 // GetUserByEmail retrieves a user by passed email from Postgres
 func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at, updated_at
+		SELECT id, username, email, password, role, email_verified, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -88,12 +120,14 @@ func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*User
 		&user.Username,
 		&user.Email,
 		&user.Password,
+		&user.Role,
+		&user.EmailVerified,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("failed to get user: %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -112,10 +146,21 @@ func (s *PostgresStore) ExistsByEmail(ctx context.Context, email string) (bool,
 	return exists, nil
 }
 
+// ExistsByUsername checks whether the username is taken, ignoring case like the unique index
+func (s *PostgresStore) ExistsByUsername(ctx context.Context, username string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))`
+	err := s.pool.QueryRow(ctx, query, username).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if username exists: %w", err)
+	}
+	return exists, nil
+}
+
 // GetAllUsers retrieves all users with pagination from Postgres
 func (s *PostgresStore) GetAllUsers(ctx context.Context, limit, offset int) ([]*User, error) {
 	query := `
-		SELECT id, username, email, created_at, updated_at
+		SELECT id, username, email, email_verified, created_at, updated_at
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2
@@ -134,6 +179,59 @@ func (s *PostgresStore) GetAllUsers(ctx context.Context, limit, offset int) ([]*
 			&user.ID,
 			&user.Username,
 			&user.Email,
+			&user.EmailVerified,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountUsers returns the total number of users
+func (s *PostgresStore) CountUsers(ctx context.Context) (int, error) {
+	query := `SELECT COUNT(*) FROM users`
+
+	var count int
+	if err := s.pool.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return count, nil
+}
+
+// SearchUsersByUsername returns users whose username starts with prefix, case-insensitive
+func (s *PostgresStore) SearchUsersByUsername(ctx context.Context, prefix string, limit int) ([]*User, error) {
+	query := `
+		SELECT id, username, email, email_verified, created_at, updated_at
+		FROM users
+		WHERE username ILIKE $1
+		ORDER BY username ASC
+		LIMIT $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, likeEscaper.Replace(prefix)+"%", limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.EmailVerified,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -154,7 +252,7 @@ func (s *PostgresStore) GetAllUsers(ctx context.Context, limit, offset int) ([]*
 func (s *PostgresStore) UpdateUser(ctx context.Context, user *User) error {
 	query := `
 		UPDATE users
-		SET username = $2, email = $3, updated_at = $4
+		SET username = $2, email = $3, email_verified = $4, updated_at = $5
 		WHERE id = $1
 	`
 	user.UpdatedAt = time.Now()
@@ -163,14 +261,80 @@ func (s *PostgresStore) UpdateUser(ctx context.Context, user *User) error {
 		user.ID,
 		user.Username,
 		user.Email,
+		user.EmailVerified,
 		user.UpdatedAt,
 	)
 	if err != nil {
+		if uniqueErr := uniqueViolation(err); uniqueErr != nil {
+			return uniqueErr
+		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("user not found")
+		return fmt.Errorf("failed to update user: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// UpdatePassword replaces the stored password hash of a user
+func (s *PostgresStore) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password = $2, updated_at = $3
+		WHERE id = $1
+	`
+
+	result, err := s.pool.Exec(ctx, query, id, passwordHash, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to update password: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// ReplacePassword swaps the password hash only while it still equals oldHash, so of
+// two concurrent resets with the same token only one gets through
+func (s *PostgresStore) ReplacePassword(ctx context.Context, id uuid.UUID, oldHash, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password = $2, updated_at = $4
+		WHERE id = $1 AND password = $3
+	`
+
+	result, err := s.pool.Exec(ctx, query, id, passwordHash, oldHash, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to replace password: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to replace password: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// SetEmailVerified marks the email verified. The email is matched too, so a
+// token issued before an email change can't verify the new address
+func (s *PostgresStore) SetEmailVerified(ctx context.Context, id uuid.UUID, email string) error {
+	query := `
+		UPDATE users
+		SET email_verified = TRUE, updated_at = $3
+		WHERE id = $1 AND email = $2
+	`
+
+	result, err := s.pool.Exec(ctx, query, id, email, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to verify email: %w", ErrNotFound)
 	}
 
 	return nil
@@ -186,8 +350,35 @@ func (s *PostgresStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("user not found")
+		return fmt.Errorf("failed to delete user: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// UpdateLastSeen records when the user's last connection closed
+func (s *PostgresStore) UpdateLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `UPDATE users SET last_seen_at = $2 WHERE id = $1`
+
+	if _, err := s.pool.Exec(ctx, query, id, at); err != nil {
+		return fmt.Errorf("failed to update last seen: %w", err)
 	}
 
 	return nil
 }
+
+// GetLastSeen returns when the user was last connected, nil if never
+func (s *PostgresStore) GetLastSeen(ctx context.Context, id uuid.UUID) (*time.Time, error) {
+	query := `SELECT last_seen_at FROM users WHERE id = $1`
+
+	var lastSeen *time.Time
+	err := s.pool.QueryRow(ctx, query, id).Scan(&lastSeen)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to get last seen: %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get last seen: %w", err)
+	}
+
+	return lastSeen, nil
+}
@@ -2,17 +2,56 @@ package user
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrNotFound means no user matches the lookup
+	ErrNotFound = errors.New("user not found")
+	// ErrEmailExists means another account already uses the email
+	ErrEmailExists = errors.New("email already exists")
+	// ErrUsernameExists means another account already uses the username, in any case
+	ErrUsernameExists = errors.New("username already exists")
+)
+
+// Presence reports whether a user currently has a live connection
+type Presence interface {
+	IsUserOnline(userID uuid.UUID) bool
+}
+
+// AccountCleaner removes what a user leaves behind elsewhere, rooms and
+// messages, before their row is deleted
+type AccountCleaner interface {
+	// CleanupAccount deletes the user's messages, or keeps them without a sender when anonymize is set
+	CleanupAccount(ctx context.Context, userID uuid.UUID, anonymize bool) error
+}
+
 // Store defines what storage operations user entity have
 type Store interface {
 	CreateUser(ctx context.Context, user *User) error
 	GetUserByID(ctx context.Context, id uuid.UUID) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	ExistsByEmail(ctx context.Context, email string) (bool, error)
+	// ExistsByUsername reports whether the username is taken, case-insensitive
+	ExistsByUsername(ctx context.Context, username string) (bool, error)
 	GetAllUsers(ctx context.Context, limit, offset int) ([]*User, error)
+	CountUsers(ctx context.Context) (int, error)
+	// SearchUsersByUsername returns users whose username starts with prefix, case-insensitive
+	SearchUsersByUsername(ctx context.Context, prefix string, limit int) ([]*User, error)
 	UpdateUser(ctx context.Context, user *User) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error
+	// ReplacePassword sets passwordHash only if the stored hash still equals oldHash,
+	// ErrNotFound means the user is gone or the password changed in the meantime
+	ReplacePassword(ctx context.Context, id uuid.UUID, oldHash, passwordHash string) error
+	// SetEmailVerified marks the user's email verified if it still equals email
+	SetEmailVerified(ctx context.Context, id uuid.UUID, email string) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
+
+	// UpdateLastSeen records when the user's last connection closed
+	UpdateLastSeen(ctx context.Context, id uuid.UUID, at time.Time) error
+	// GetLastSeen returns when the user was last connected, nil if never
+	GetLastSeen(ctx context.Context, id uuid.UUID) (*time.Time, error)
 }
@@ -7,12 +7,15 @@ import (
 )
 
 type User struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       uuid.UUID `json:"id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Password string    `json:"password"`
+	Role     string    `json:"role"` // auth.RoleUser or auth.RoleAdmin
+	// EmailVerified is set once the user follows the link sent to Email
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type CreateUserRequest struct {
@@ -29,11 +32,50 @@ type CreateUserResponse struct {
 }
 
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// UpdateProfileRequest is a partial update, omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	Username *string `json:"username,omitempty"`
+	Email    *string `json:"email,omitempty"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// VerifyEmailRequest carries the token from the verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type UsernameAvailableResponse struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
 }
 
 type GetAllUsersResponse struct {
@@ -41,11 +83,25 @@ type GetAllUsersResponse struct {
 	TotalCount int            `json:"total_count"`
 	Limit      int            `json:"limit"`
 	Offset     int            `json:"offset"`
+	HasMore    bool           `json:"has_more"`
+}
+
+type SearchUsersResponse struct {
+	Users []UserResponse `json:"users"`
+	Count int            `json:"count"`
+}
+
+// PresenceResponse tells whether a user is connected and when they were last seen
+type PresenceResponse struct {
+	UserID     uuid.UUID  `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
 }
 
 type DeleteUserResponse struct {
-	Message string    `json:"message"`
-	ID      uuid.UUID `json:"id"`
+	Message    string    `json:"message"`
+	ID         uuid.UUID `json:"id"`
+	Anonymized bool      `json:"anonymized"` // Messages were kept without a sender instead of deleted
 }
 
 type SignupRequest struct {
@@ -77,6 +133,10 @@ type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type RefreshTokenResponse struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
@@ -1,8 +1,13 @@
 package user
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
+
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
 )
 
 const (
@@ -12,26 +17,122 @@ const (
 	specialChars   = "!@#$%^&*"
 )
 
-func validateCreateUserRequest(req *CreateUserRequest) error {
-	if req.Username == "" {
-		return fmt.Errorf("username is required")
+// ValidationError holds one message per invalid request field
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range slices.Sorted(maps.Keys(e.Fields)) {
+		parts = append(parts, field+": "+e.Fields[field])
 	}
-	if len(req.Username) < minUsernameLen {
-		return fmt.Errorf("username must be at least %d characters long, got %d", minUsernameLen, len(req.Username))
+	return strings.Join(parts, "; ")
+}
+
+// check records err against field, keeping the first failure per field
+func (e *ValidationError) check(field string, err error) {
+	if err == nil {
+		return
+	}
+	if e.Fields == nil {
+		e.Fields = make(map[string]string)
+	}
+	if _, exists := e.Fields[field]; !exists {
+		e.Fields[field] = err.Error()
+	}
+}
+
+// err returns nil when no field failed, so callers avoid a typed nil error
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
 	}
-	if len(req.Username) > maxUsernameLen {
-		return fmt.Errorf("username must be no more than %d characters long, got %d", maxUsernameLen, len(req.Username))
+	return e
+}
+
+// validationFailed turns a validation error into a 400 carrying the field map
+func validationFailed(err error) error {
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		return httputil.BadRequest("Validation failed", verr.Fields)
 	}
+	return httputil.BadRequest("Validation failed", map[string]string{
+		"validation_error": err.Error(),
+	})
+}
+
+// validateCreateUserRequest checks every field and reports all failures at once
+func validateCreateUserRequest(req *CreateUserRequest) error {
+	verr := new(ValidationError)
+
+	verr.check("username", validateUsername(req.Username))
 
 	if req.Email == "" {
-		return fmt.Errorf("email is required")
+		verr.check("email", fmt.Errorf("email is required"))
 	}
-	if err := validateEmail(req.Email); err != nil {
-		return fmt.Errorf("invalid email: %w", err)
+	verr.check("email", validateEmail(req.Email))
+
+	verr.check("password", validatePassword(req.Password))
+
+	return verr.err()
+}
+
+// validateUpdateProfileRequest checks only the fields present in the request
+func validateUpdateProfileRequest(req *UpdateProfileRequest) error {
+	if req.Username == nil && req.Email == nil {
+		return fmt.Errorf("at least one of username or email is required")
 	}
 
-	if err := validatePassword(req.Password); err != nil {
-		return fmt.Errorf("invalid password: %w", err)
+	verr := new(ValidationError)
+
+	if req.Username != nil {
+		verr.check("username", validateUsername(*req.Username))
+	}
+
+	if req.Email != nil {
+		if *req.Email == "" {
+			verr.check("email", fmt.Errorf("email must not be empty"))
+		}
+		verr.check("email", validateEmail(*req.Email))
+	}
+
+	return verr.err()
+}
+
+// validateChangePasswordRequest reports a missing current password and an invalid new one together
+func validateChangePasswordRequest(req *ChangePasswordRequest) error {
+	verr := new(ValidationError)
+
+	if req.CurrentPassword == "" {
+		verr.check("current_password", fmt.Errorf("current password is required"))
+	}
+	verr.check("new_password", validatePassword(req.NewPassword))
+
+	return verr.err()
+}
+
+// validateResetPasswordRequest reports a missing token and an invalid new password together
+func validateResetPasswordRequest(req *ResetPasswordRequest) error {
+	verr := new(ValidationError)
+
+	if req.Token == "" {
+		verr.check("token", fmt.Errorf("token is required"))
+	}
+	verr.check("new_password", validatePassword(req.NewPassword))
+
+	return verr.err()
+}
+
+func validateUsername(username string) error {
+	if username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if len(username) < minUsernameLen {
+		return fmt.Errorf("username must be at least %d characters long, got %d", minUsernameLen, len(username))
+	}
+	if len(username) > maxUsernameLen {
+		return fmt.Errorf("username must be no more than %d characters long, got %d", maxUsernameLen, len(username))
 	}
 
 	return nil
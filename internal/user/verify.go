@@ -0,0 +1,156 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+// HandleVerifyEmail marks the email verified using a token from the verification
+// email. GET takes the token as ?token= so the emailed link works as is, POST takes
+// it in the body. Clients should refresh their access token afterwards, since the
+// verification state is carried in it
+func (h *Handler) HandleVerifyEmail(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		req := new(VerifyEmailRequest)
+		if err := httputil.DecodeJSON(r, req); err != nil {
+			return err
+		}
+		token = req.Token
+	}
+
+	if token == "" {
+		return httputil.BadRequest("Token is required")
+	}
+
+	claims, userID, err := h.authService.ValidateEmailVerificationToken(token)
+	if err != nil {
+		log.Debug("invalid email verification token",
+			"error", err)
+		return httputil.BadRequest("Invalid or expired verification token")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	if err := h.store.SetEmailVerified(ctx, userID, claims.Email); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			log.Warn("email verification token for changed email or deleted user",
+				"user_id", userID)
+			return httputil.BadRequest("Invalid or expired verification token")
+		}
+		log.Error("failed to verify email",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	log.Info("user email verified",
+		"user_id", userID)
+
+	return httputil.RespondJSON(w, http.StatusOK, MessageResponse{
+		Message: "Email has been verified",
+	})
+}
+
+// HandleResendVerification emails a new verification token. Like HandleForgotPassword
+// it always answers the same way, so the response doesn't reveal whether an account
+// exists or is already verified
+func (h *Handler) HandleResendVerification(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	req := new(ResendVerificationRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		return httputil.BadRequest("Email is required")
+	}
+
+	allowed, retryAfter, err := h.resendLimiter.Allow(r.Context(), email)
+	if err != nil {
+		log.Error("failed to check verification resend limit",
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !allowed {
+		log.Warn("verification resend rate limited",
+			"email", email,
+			"retry_after", retryAfter)
+		return httputil.TooManyRequests("Too many verification emails requested, try again later", retryAfter)
+	}
+
+	log.Debug("verification resend request received",
+		"email", email)
+
+	go h.resendVerification(email)
+
+	return httputil.RespondJSON(w, http.StatusOK, MessageResponse{
+		Message: "If an unverified account with this email exists, a verification link has been sent",
+	})
+}
+
+func (h *Handler) resendVerification(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.dbTimeout)
+	defer cancel()
+
+	user, err := h.store.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrNotFound) {
+		h.log.Debug("verification resend requested for unknown email",
+			"email", email)
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to load user for verification resend",
+			"error", err)
+		return
+	}
+
+	if user.EmailVerified {
+		h.log.Debug("verification resend requested for verified email",
+			"user_id", user.ID)
+		return
+	}
+
+	h.sendVerification(user.ID, user.Email)
+}
+
+// sendVerification emails a token that verifies email for userID. It runs in
+// the background, so failures are only logged
+func (h *Handler) sendVerification(userID uuid.UUID, email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.dbTimeout)
+	defer cancel()
+
+	token, err := h.authService.GenerateEmailVerificationToken(userID, email)
+	if err != nil {
+		h.log.Error("failed to generate email verification token",
+			"user_id", userID,
+			"error", err)
+		return
+	}
+
+	body := "Use this token to verify your email: " + token
+	if h.cfg.VerifyEmailURL != "" {
+		body = "Follow this link to verify your email: " + h.cfg.VerifyEmailURL + "?token=" + url.QueryEscape(token)
+	}
+	body += "\n\nThe link expires in 24 hours. If you didn't create an account, ignore this email."
+
+	if err := h.mailer.Send(ctx, email, "Verify your email", body); err != nil {
+		h.log.Error("failed to send verification email",
+			"user_id", userID,
+			"error", err)
+		return
+	}
+
+	h.log.Info("verification email sent",
+		"user_id", userID)
+}
@@ -0,0 +1,54 @@
+package voice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/room"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+// CleanupAccount removes a user from their rooms and then deletes or
+// anonymizes everything they sent. It runs before the user row is deleted.
+// Audio of deleted messages is queued for the sweeper rather than removed
+// inline, so the call stays bounded however much the user uploaded
+func (h *Handler) CleanupAccount(ctx context.Context, userID uuid.UUID, anonymize bool) error {
+	log := logger.FromContext(ctx)
+	rooms, err := h.roomStore.GetUserRooms(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list user rooms: %w", err)
+	}
+
+	// Leaving hands ownership over and deletes rooms left empty, which the
+	// foreign key cascade alone would not
+	for _, rm := range rooms {
+		if _, err := h.roomStore.LeaveRoom(ctx, rm.ID, userID); err != nil && !errors.Is(err, room.ErrNotParticipant) {
+			return fmt.Errorf("failed to leave room %s: %w", rm.ID, err)
+		}
+		h.wsManager.KickFromRoom(rm.ID, userID, userID)
+	}
+
+	if anonymize {
+		count, err := h.dbStore.AnonymizeMessagesBySender(ctx, userID)
+		if err != nil {
+			return err
+		}
+		log.Info("anonymized messages of deleted account",
+			"user_id", userID,
+			"count", count)
+		return nil
+	}
+
+	count, err := h.dbStore.DeleteMessagesBySender(ctx, userID, DeletionReasonAccountDeleted)
+	if err != nil {
+		return err
+	}
+	log.Info("deleted messages of deleted account",
+		"user_id", userID,
+		"count", count,
+		"rooms_left", len(rooms))
+
+	return nil
+}
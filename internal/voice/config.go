@@ -0,0 +1,100 @@
+package voice
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rx3lixir/laba_zis/pkg/audio"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// Defaults used by NewHandler for zero Config values
+const (
+	DefaultMaxUploadBytes     = 5 * 1024 * 1024
+	DefaultMaxDurationSeconds = 15
+	DefaultURLExpiry          = time.Hour
+)
+
+// Config holds operator-tunable upload settings
+type Config struct {
+	// EnabledFormats is the subset of the audio registry accepted for upload
+	EnabledFormats []string
+
+	// MaxUploadBytes caps the upload request body, larger uploads get a 413
+	MaxUploadBytes int64
+
+	// MaxDurationSeconds is the longest accepted message
+	MaxDurationSeconds int
+
+	// URLExpiry is how long presigned playback URLs stay valid
+	URLExpiry time.Duration
+
+	// RequireVerifiedEmail keeps users with an unverified email from uploading
+	RequireVerifiedEmail bool
+
+	// Limits caps the quality of accepted uploads
+	Limits Limits
+
+	// DeleteGracePeriod is how long the audio of a deleted message is kept
+	// before the sweeper removes it. Zero keeps it until the message is purged
+	DeleteGracePeriod time.Duration
+
+	// Transcoder converts uploads to Ogg/Opus before storing, nil stores them as received
+	Transcoder Transcoder
+
+	// Transcriber fills in transcripts after upload, nil means NopTranscriber
+	Transcriber Transcriber
+}
+
+// Limits caps accepted audio quality, a zero value disables that check
+type Limits struct {
+	MaxSampleRate  int `json:"max_sample_rate,omitempty"`
+	MaxChannels    int `json:"max_channels,omitempty"`
+	MaxBitrateKbps int `json:"max_bitrate_kbps,omitempty"`
+}
+
+// check validates probed stream parameters and the average bitrate against the limits.
+// info may be nil when the header couldn't be parsed, then only the bitrate is checked
+func (l Limits) check(info *audio.Info, bitrateKbps int) error {
+	if info != nil {
+		if l.MaxSampleRate > 0 && info.SampleRate > l.MaxSampleRate {
+			return httputil.BadRequest(
+				fmt.Sprintf("Sample rate %d Hz exceeds the maximum of %d Hz", info.SampleRate, l.MaxSampleRate),
+				map[string]int{"sample_rate": info.SampleRate, "max_sample_rate": l.MaxSampleRate},
+			)
+		}
+		if l.MaxChannels > 0 && info.Channels > l.MaxChannels {
+			return httputil.BadRequest(
+				fmt.Sprintf("Audio has %d channels, the maximum is %d", info.Channels, l.MaxChannels),
+				map[string]int{"channels": info.Channels, "max_channels": l.MaxChannels},
+			)
+		}
+	}
+
+	if l.MaxBitrateKbps > 0 && bitrateKbps > l.MaxBitrateKbps {
+		return httputil.BadRequest(
+			fmt.Sprintf("Bitrate %d kbps exceeds the maximum of %d kbps", bitrateKbps, l.MaxBitrateKbps),
+			map[string]int{"bitrate_kbps": bitrateKbps, "max_bitrate_kbps": l.MaxBitrateKbps},
+		)
+	}
+
+	return nil
+}
+
+// Formats returns the registry entries for the enabled formats,
+// this is what clients see in GET /api/config
+func (c Config) Formats() []audio.Format {
+	formats := make([]audio.Format, 0, len(c.EnabledFormats))
+	for _, name := range c.EnabledFormats {
+		if f, ok := audio.Lookup(name); ok {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// isEnabled reports whether uploads in the given format are accepted
+func (c Config) isEnabled(format string) bool {
+	return slices.Contains(c.EnabledFormats, format)
+}
@@ -2,6 +2,9 @@ package voice
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
@@ -10,52 +13,116 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/device"
+	"github.com/rx3lixir/laba_zis/internal/metrics"
 	"github.com/rx3lixir/laba_zis/internal/room"
 	"github.com/rx3lixir/laba_zis/internal/websocket"
 	"github.com/rx3lixir/laba_zis/pkg/audio"
 	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+	"github.com/rx3lixir/laba_zis/pkg/push"
 )
 
 const (
-	maxUploadSize = 5 * 1024 * 1024 // 5MB max file size
-	maxDuration   = 15              // 15 seconds max
-	urlExpiryTime = 1 * time.Hour   // Presigned URLs expire after 1 hour
-	defaultLimit  = 50
-	defaultOffset = 0
+	defaultLimit = 50
+
+	// Form fields fit in memory, file parts above this spill to a temp file
+	// so the audio is never held in RAM while it streams to S3
+	multipartMemory = 32 << 10
+
+	// Encoders pad the last frame, so allow a little over the maximum duration
+	durationTolerance = 500 * time.Millisecond
+
+	// pushTimeout bounds the background lookup and delivery of push notifications
+	pushTimeout = 10 * time.Second
+
+	// uploadCleanupTimeout bounds removing the audio of an upload that failed to save
+	uploadCleanupTimeout = 3 * time.Second
+
+	// transcribeTimeout bounds reading the audio back and transcribing it
+	transcribeTimeout = 2 * time.Minute
 )
 
 type Handler struct {
-	dbStore   VoiceMessageDBStore
-	fileStore VoiceMessageStore
-	roomStore room.Store
-	wsManager *websocket.ConnectionManager
-	log       *slog.Logger
-	dbTimeout time.Duration
+	dbStore         VoiceMessageDBStore
+	fileStore       VoiceMessageStore
+	pendingStore    PendingDeletionStore
+	reactionStore   ReactionStore
+	readStore       ReadStore
+	playStore       PlayStore
+	transcriptStore TranscriptStore
+	roomStore       room.Store
+	wsManager       *websocket.ConnectionManager
+	push            *device.PushService
+	log             *slog.Logger
+	dbTimeout       time.Duration
+	cfg             Config
 }
 
 func NewHandler(
 	dbStore VoiceMessageDBStore,
 	fileStore VoiceMessageStore,
+	pendingStore PendingDeletionStore,
+	reactionStore ReactionStore,
+	readStore ReadStore,
+	playStore PlayStore,
+	transcriptStore TranscriptStore,
 	roomStore room.Store,
 	wsManager *websocket.ConnectionManager,
+	push *device.PushService,
 	log *slog.Logger,
 	dbTimeout time.Duration,
+	cfg Config,
 ) *Handler {
+	if cfg.Transcriber == nil {
+		cfg.Transcriber = NopTranscriber{}
+	}
+	if cfg.MaxUploadBytes <= 0 {
+		cfg.MaxUploadBytes = DefaultMaxUploadBytes
+	}
+	if cfg.MaxDurationSeconds <= 0 {
+		cfg.MaxDurationSeconds = DefaultMaxDurationSeconds
+	}
+	if cfg.URLExpiry <= 0 {
+		cfg.URLExpiry = DefaultURLExpiry
+	}
+
 	return &Handler{
 		dbStore,
 		fileStore,
+		pendingStore,
+		reactionStore,
+		readStore,
+		playStore,
+		transcriptStore,
 		roomStore,
 		wsManager,
+		push,
 		log,
 		dbTimeout,
+		cfg,
 	}
 }
 
 func (h *Handler) RegisterRoutes(r chi.Router) {
-	r.Post("/", httputil.Handler(h.HandleUploadVoiceMessage, h.log))
+	r.With(auth.RequireVerifiedEmail(h.cfg.RequireVerifiedEmail)).
+		Post("/", httputil.Handler(h.HandleUploadVoiceMessage, h.log))
 	r.Get("/room/{roomID}", httputil.Handler(h.HandleGetRoomMessages, h.log))
+	r.Get("/mine", httputil.Handler(h.HandleGetMyMessages, h.log))
 	r.Get("/{messageID}", httputil.Handler(h.HandleGetVoiceMessage, h.log))
+	r.Get("/{messageID}/audio", httputil.Handler(h.HandleStreamVoiceMessage, h.log))
 	r.Delete("/{messageID}", httputil.Handler(h.HandleDeleteVoiceMessage, h.log))
+	r.Delete("/{messageID}/purge", httputil.Handler(h.HandlePurgeVoiceMessage, h.log))
+	r.Post("/{messageID}/reactions", httputil.Handler(h.HandleAddReaction, h.log))
+	r.Delete("/{messageID}/reactions/{emoji}", httputil.Handler(h.HandleRemoveReaction, h.log))
+	r.Get("/{messageID}/reads", httputil.Handler(h.HandleGetReads, h.log))
+	r.Post("/{messageID}/played", httputil.Handler(h.HandleMarkPlayed, h.log))
+}
+
+// RegisterRoomRoutes adds the message routes nested under /rooms
+func (h *Handler) RegisterRoomRoutes(r chi.Router) {
+	r.Get("/{roomID}/messages/search", httputil.Handler(h.HandleSearchRoomMessages, h.log))
+	r.Post("/{roomID}/read", httputil.Handler(h.HandleMarkRoomRead, h.log))
 }
 
 func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
@@ -64,30 +131,35 @@ func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
 
 // HandleUploadVoiceMessage uploads a voice message to S3 and creates a DB record
 func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	// Extract user from context
-	senderID := auth.GetUserID(r.Context())
-	if senderID == uuid.Nil {
-		h.log.Debug("voice message upload attempt without authentication")
+	claims, ok := auth.GetClaims(r.Context())
+	if !ok {
+		log.Debug("voice message upload attempt without authentication")
 		return httputil.Unauthorized("Unauthorized")
 	}
+	senderID := claims.UserID
 
 	// Parse multipart form
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxUploadBytes)
 
-	// Parse multipart form with a reasonable memory limit
-	// Only 10MB kept in memory, rest spills to temp files
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		h.log.Debug("failed to parse multipart form",
+	// Parse multipart form, the audio part goes to a temp file that
+	// net/http removes once the request is done
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		log.Debug("failed to parse multipart form",
 			"sender_id", senderID,
 			"error", err)
-		return httputil.BadRequest("Invalid multipart form data or file too big")
+		if tooLarge := httputil.TooLarge(err); tooLarge != nil {
+			return tooLarge
+		}
+		return httputil.BadRequest("Invalid multipart form data")
 	}
 
 	// Extract and validate parameters
 	roomIDStr := r.FormValue("room_id")
 	durationStr := r.FormValue("duration_seconds")
 
-	h.log.Debug("voice message upload request received",
+	log.Debug("voice message upload request received",
 		"sender_id", senderID,
 		"room_id", roomIDStr,
 		"duration", durationStr)
@@ -101,9 +173,9 @@ func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Reques
 		return httputil.BadRequest("Invalid room_id format")
 	}
 
-	duration, err := strconv.Atoi(durationStr)
-	if err != nil || duration <= 0 || duration > maxDuration {
-		return httputil.BadRequest("duration_seconds must be between 1 and 15")
+	duration, err := parseDuration(durationStr, h.cfg.MaxDurationSeconds)
+	if err != nil {
+		return err
 	}
 
 	ctx, cancel := h.dbCtx(r)
@@ -112,14 +184,14 @@ func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Reques
 	// Verify user is in the room
 	isInRoom, err := h.roomStore.IsUserInRoom(ctx, roomID, senderID)
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		log.Error("failed to verify room membership",
 			"sender_id", senderID,
 			"room_id", roomID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 	if !isInRoom {
-		h.log.Warn("voice message upload blocked - user not in room",
+		log.Warn("voice message upload blocked - user not in room",
 			"sender_id", senderID,
 			"room_id", roomID)
 		return httputil.Forbidden("You are not a member of this room")
@@ -137,40 +209,132 @@ func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Reques
 	if fileSize == 0 {
 		return httputil.BadRequest("Empty audio file")
 	}
-	if fileSize > maxUploadSize {
-		return httputil.BadRequest("File too large (max 5 MB)")
+	if fileSize > h.cfg.MaxUploadBytes {
+		return httputil.PayloadTooLarge(
+			fmt.Sprintf("File too large (max %d bytes)", h.cfg.MaxUploadBytes),
+			map[string]int64{"size_bytes": fileSize, "max_upload_bytes": h.cfg.MaxUploadBytes},
+		)
 	}
 
 	// Detect audio format
 	contentType := fileHeader.Header.Get("Content-Type")
 	filename := fileHeader.Filename
 	audioFormat := audio.DetectAudioFormat(contentType, filename)
+	if !h.cfg.isEnabled(audioFormat) {
+		log.Debug("voice message upload rejected - format not enabled",
+			"sender_id", senderID,
+			"format", audioFormat,
+			"content_type", contentType,
+			"filename", filename)
+		return httputil.BadRequest("Unsupported audio format", map[string]any{
+			"accepted_formats": h.cfg.EnabledFormats,
+		})
+	}
 
-	h.log.Debug("audio file parsed",
+	// Don't trust the declared type, the bytes must match it
+	head := make([]byte, audio.SniffHeaderSize)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Error("failed to read audio header",
+			"sender_id", senderID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if sniffed := audio.SniffFormat(head[:n]); sniffed != audioFormat {
+		log.Debug("voice message upload rejected - content does not match declared format",
+			"sender_id", senderID,
+			"declared_format", audioFormat,
+			"sniffed_format", sniffed)
+		return httputil.BadRequest("File content does not match its audio format", map[string]any{
+			"declared_format": audioFormat,
+		})
+	}
+
+	// The declared duration is only a fallback for files we can't measure
+	duration, err = h.measureDuration(file, fileSize, audioFormat, duration)
+	if err != nil {
+		log.Debug("voice message upload rejected - measured duration too long",
+			"sender_id", senderID,
+			"format", audioFormat,
+			"error", err)
+		return err
+	}
+
+	// Enforce quality limits using the stream header and the average bitrate
+	info, err := audio.Probe(file, fileSize, audioFormat)
+	if err != nil {
+		log.Debug("failed to probe audio header, checking bitrate only",
+			"sender_id", senderID,
+			"format", audioFormat,
+			"error", err)
+		info = nil
+	}
+	bitrate := audio.BitrateKbps(fileSize, float64(duration))
+	if err := h.cfg.Limits.check(info, bitrate); err != nil {
+		log.Debug("voice message upload rejected - quality limit exceeded",
+			"sender_id", senderID,
+			"format", audioFormat,
+			"bitrate_kbps", bitrate,
+			"error", err)
+		return err
+	}
+
+	log.Debug("audio file parsed",
 		"sender_id", senderID,
 		"room_id", roomID,
 		"size_bytes", fileSize,
 		"format", audioFormat,
 		"filename", filename)
 
+	// Normalize to Ogg/Opus when configured, the original is stored if that fails
+	var body io.Reader = file
+	if h.cfg.Transcoder != nil && audioFormat != TranscodedFormat {
+		transcoded, err := h.cfg.Transcoder.ToOpus(r.Context(), file, fileSize, audioFormat)
+		if err != nil {
+			log.Warn("transcoding failed, storing original audio",
+				"sender_id", senderID,
+				"format", audioFormat,
+				"error", err)
+		} else {
+			defer transcoded.Close()
+
+			log.Debug("audio transcoded",
+				"sender_id", senderID,
+				"from_format", audioFormat,
+				"size_bytes", fileSize,
+				"transcoded_bytes", transcoded.Size)
+
+			body = transcoded.File
+			fileSize = transcoded.Size
+			audioFormat = TranscodedFormat
+		}
+	}
+
 	// Create message record
+	storedContentType := audio.ContentType(audioFormat)
 	message := &VoiceMessage{
 		ID:              uuid.New(),
 		RoomID:          roomID,
 		SenderID:        senderID,
 		DurationSeconds: duration,
+		SizeBytes:       &fileSize,
+		ContentType:     &storedContentType,
+	}
+	if h.transcribes() {
+		status := EnrichmentPending
+		message.EnrichmentStatus = &status
 	}
 
 	// Streaming upload to S3. File reader streams directly to S3
 	s3Key, err := h.fileStore.UploadVoiceMessage(
 		ctx,
 		message.ID,
-		file,
+		body,
 		fileSize,
 		audioFormat,
 	)
 	if err != nil {
-		h.log.Error("failed to upload voice message to S3",
+		log.Error("failed to upload voice message to S3",
 			"message_id", message.ID,
 			"sender_id", senderID,
 			"room_id", roomID,
@@ -182,29 +346,22 @@ func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Reques
 
 	// Save to database
 	if err := h.dbStore.CreateVoiceMessage(ctx, message); err != nil {
-		h.log.Error("failed to create voice message in database",
+		log.Error("failed to create voice message in database",
 			"message_id", message.ID,
 			"sender_id", senderID,
 			"room_id", roomID,
 			"s3_key", s3Key,
 			"error", err)
 
-		// Cleanup S3 file
-		cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cleanupCancel()
-		if cleanupErr := h.fileStore.DeleteVoiceMessage(cleanupCtx, s3Key); cleanupErr != nil {
-			h.log.Error("failed to cleanup S3 after database error",
-				"s3_key", s3Key,
-				"error", cleanupErr)
-		}
-
+		h.rollbackUpload(s3Key)
 		return httputil.Internal(err)
 	}
 
 	// Generate presigned URL
-	url, err := h.fileStore.GetPresignedURL(ctx, s3Key, urlExpiryTime)
+	signedAt := time.Now()
+	url, err := h.fileStore.GetPresignedURL(ctx, s3Key, h.cfg.URLExpiry, false)
 	if err != nil {
-		h.log.Warn("failed to generate presigned URL, continuing without it",
+		log.Warn("failed to generate presigned URL, continuing without it",
 			"message_id", message.ID,
 			"s3_key", s3Key,
 			"error", err)
@@ -215,15 +372,33 @@ func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Reques
 	event := websocket.ServerMessage{
 		Type: websocket.TypeNewVoiceMessage,
 		Data: websocket.VoiceMessageData{
-			MessageID: message.ID,
-			SenderID:  message.SenderID,
-			Duration:  message.DurationSeconds,
-			URL:       url,
+			MessageID:    message.ID,
+			SenderID:     message.SenderID,
+			Duration:     message.DurationSeconds,
+			URL:          url,
+			URLExpiresAt: h.urlExpiresAt(url, signedAt),
 		},
 	}
 	h.wsManager.BroadcastToRoom(message.RoomID, event)
 
-	h.log.Info("voice message uploaded successfully",
+	// Members without a live connection get a push instead, in the
+	// background so a slow provider doesn't hold up the response
+	go h.notifyOffline(message, claims.Username)
+
+	// Transcripts arrive later as a transcript_ready event
+	if h.transcribes() {
+		go h.transcribeMessage(&EnrichmentJob{
+			MessageID:   message.ID,
+			RoomID:      message.RoomID,
+			S3Key:       message.S3Key,
+			ContentType: &storedContentType,
+		})
+	}
+
+	metrics.VoiceUploads.Inc()
+	metrics.VoiceUploadBytes.Add(float64(fileSize))
+
+	log.Info("voice message uploaded successfully",
 		"message_id", message.ID,
 		"sender_id", senderID,
 		"room_id", roomID,
@@ -231,15 +406,18 @@ func (h *Handler) HandleUploadVoiceMessage(w http.ResponseWriter, r *http.Reques
 		"size_bytes", fileSize)
 
 	response := UploadVoiceMessageResponse{
-		Message: *message,
-		URL:     url,
+		Message:      *message,
+		URL:          url,
+		URLExpiresAt: h.urlExpiresAt(url, signedAt),
 	}
 
 	return httputil.RespondJSON(w, http.StatusCreated, response)
 }
 
-// HandleGetRoomMessages retrieves all voice messages in a room
+// HandleGetRoomMessages retrieves all voice messages in a room.
+// limit defaults to 50 and is capped at httputil.MaxPageLimit
 func (h *Handler) HandleGetRoomMessages(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
 	if err != nil {
@@ -247,25 +425,18 @@ func (h *Handler) HandleGetRoomMessages(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Parse pagination params
-	limit := defaultLimit
-	offset := defaultOffset
-
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-			if limit > 100 {
-				limit = 100
-			}
-		}
+	page, err := httputil.ParsePagination(r, defaultLimit)
+	if err != nil {
+		return err
 	}
+	limit, offset := page.Limit, page.Offset
 
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	download, err := wantsDownload(r)
+	if err != nil {
+		return err
 	}
 
-	h.log.Debug("get room messages request",
+	log.Debug("get room messages request",
 		"user_id", userID,
 		"room_id", roomID,
 		"limit", limit,
@@ -277,52 +448,94 @@ func (h *Handler) HandleGetRoomMessages(w http.ResponseWriter, r *http.Request)
 	// Verify user is in the room
 	isInRoom, err := h.roomStore.IsUserInRoom(ctx, roomID, userID)
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		log.Error("failed to verify room membership",
 			"user_id", userID,
 			"room_id", roomID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 	if !isInRoom {
-		h.log.Warn("get room messages blocked - user not in room",
+		log.Warn("get room messages blocked - user not in room",
 			"user_id", userID,
 			"room_id", roomID)
 		return httputil.Forbidden("You are not a member of this room")
 	}
 
-	messages, err := h.dbStore.GetRoomMessages(ctx, roomID, limit, offset)
+	includeDeleted, err := h.wantsDeleted(ctx, r, roomID, userID)
 	if err != nil {
-		h.log.Error("failed to get room messages from database",
+		return err
+	}
+
+	messages, err := h.dbStore.GetRoomMessages(ctx, roomID, limit, offset, includeDeleted)
+	if err != nil {
+		log.Error("failed to get room messages from database",
 			"room_id", roomID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	// Generate presigned URLs for each message
-	messagesWithURLs := make([]VoiceMessageWithURL, 0, len(messages))
-	for _, msg := range messages {
-		url, err := h.fileStore.GetPresignedURL(ctx, msg.S3Key, urlExpiryTime)
-		if err != nil {
-			h.log.Warn("failed to generate presigned URL for message",
-				"message_id", msg.ID,
-				"s3_key", msg.S3Key,
-				"error", err)
-			url = ""
-		}
-
-		messagesWithURLs = append(messagesWithURLs, VoiceMessageWithURL{
-			VoiceMessage: *msg,
-			URL:          url,
-		})
+	messagesWithURLs, err := h.withURLs(ctx, messages, userID, download)
+	if err != nil {
+		return err
 	}
 
-	h.log.Debug("room messages retrieved",
+	log.Debug("room messages retrieved",
 		"room_id", roomID,
 		"count", len(messages))
 
 	response := GetRoomMessagesResponse{
 		Messages: messagesWithURLs,
 		Count:    len(messagesWithURLs),
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, response)
+}
+
+// HandleGetMyMessages lists the authenticated user's messages across all
+// rooms, newest first. Every message is the user's own, so no membership check
+func (h *Handler) HandleGetMyMessages(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+
+	page, err := httputil.ParsePagination(r, defaultLimit)
+	if err != nil {
+		return err
+	}
+	limit, offset := page.Limit, page.Offset
+
+	download, err := wantsDownload(r)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("get my messages request",
+		"user_id", userID,
+		"limit", limit,
+		"offset", offset)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	messages, err := h.dbStore.GetMessagesBySender(ctx, userID, limit, offset)
+	if err != nil {
+		log.Error("failed to get sender messages from database",
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	messagesWithURLs, err := h.withURLs(ctx, messages, userID, download)
+	if err != nil {
+		return err
+	}
+
+	response := GetMyMessagesResponse{
+		Messages: messagesWithURLs,
+		Count:    len(messagesWithURLs),
+		Limit:    limit,
+		Offset:   offset,
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
@@ -330,71 +543,184 @@ func (h *Handler) HandleGetRoomMessages(w http.ResponseWriter, r *http.Request)
 
 // HandleGetVoiceMessage retrieves a single voice message
 func (h *Handler) HandleGetVoiceMessage(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
 	if err != nil {
 		return httputil.BadRequest("Invalid message ID")
 	}
 
-	h.log.Debug("get voice message request",
+	download, err := wantsDownload(r)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("get voice message request",
 		"user_id", userID,
 		"message_id", messageID)
 
 	ctx, cancel := h.dbCtx(r)
 	defer cancel()
 
-	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID)
+	// Deleted messages are loaded too, the owner check below decides if they're visible
+	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID, true)
 	if err != nil {
-		h.log.Debug("voice message not found",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Message not found")
+		}
+		log.Error("failed to get voice message",
 			"message_id", messageID,
 			"error", err)
-		return httputil.NotFound("Message not found")
+		return httputil.Internal(err)
 	}
 
 	// Verify user is in the room
 	isInRoom, err := h.roomStore.IsUserInRoom(ctx, message.RoomID, userID)
 	if err != nil {
-		h.log.Error("failed to verify room membership",
+		log.Error("failed to verify room membership",
 			"user_id", userID,
 			"room_id", message.RoomID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 	if !isInRoom {
-		h.log.Warn("get voice message blocked - user not in room",
+		log.Warn("get voice message blocked - user not in room",
 			"user_id", userID,
 			"room_id", message.RoomID,
 			"message_id", messageID)
 		return httputil.Forbidden("You are not a member of this room")
 	}
 
+	if message.DeletedAt != nil {
+		includeDeleted, err := h.wantsDeleted(ctx, r, message.RoomID, userID)
+		if err != nil {
+			return err
+		}
+		if !includeDeleted {
+			return httputil.NotFound("Message not found")
+		}
+	}
+
 	// Generate presigned URL
-	url, err := h.fileStore.GetPresignedURL(ctx, message.S3Key, urlExpiryTime)
+	signedAt := time.Now()
+	url, err := h.fileStore.GetPresignedURL(ctx, message.S3Key, h.cfg.URLExpiry, download)
 	if err != nil {
-		h.log.Warn("failed to generate presigned URL",
+		log.Warn("failed to generate presigned URL",
 			"message_id", messageID,
 			"s3_key", message.S3Key,
 			"error", err)
 		url = ""
 	}
 
+	reactions, err := h.reactionStore.GetReactions(ctx, []uuid.UUID{messageID}, userID)
+	if err != nil {
+		log.Error("failed to get reactions",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	plays, err := h.playStore.GetPlayCounts(ctx, []uuid.UUID{messageID}, userID)
+	if err != nil {
+		log.Error("failed to get play count",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
 	response := VoiceMessageWithURL{
 		VoiceMessage: *message,
 		URL:          url,
+		URLExpiresAt: h.urlExpiresAt(url, signedAt),
+		Reactions:    reactionsOrEmpty(reactions[messageID]),
+		Played:       plays[messageID] > 0,
+		PlayCount:    plays[messageID],
 	}
 
 	return httputil.RespondJSON(w, http.StatusOK, response)
 }
 
+// HandleStreamVoiceMessage proxies the audio through the server so clients
+// never see storage URLs. Range requests are supported for seeking
+func (h *Handler) HandleStreamVoiceMessage(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid message ID")
+	}
+
+	log.Debug("stream voice message request",
+		"user_id", userID,
+		"message_id", messageID)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID, false)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Message not found")
+		}
+		log.Error("failed to get voice message for streaming",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	isInRoom, err := h.roomStore.IsUserInRoom(ctx, message.RoomID, userID)
+	if err != nil {
+		log.Error("failed to verify room membership",
+			"user_id", userID,
+			"room_id", message.RoomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !isInRoom {
+		log.Warn("stream voice message blocked - user not in room",
+			"user_id", userID,
+			"room_id", message.RoomID,
+			"message_id", messageID)
+		return httputil.Forbidden("You are not a member of this room")
+	}
+
+	// The download may outlive the DB timeout, so it's bound to the request only
+	object, info, err := h.fileStore.OpenVoiceMessage(r.Context(), message.S3Key)
+	if err != nil {
+		log.Error("failed to open voice message object",
+			"message_id", messageID,
+			"s3_key", message.S3Key,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	defer object.Close()
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if info.ETag != "" {
+		w.Header().Set("ETag", strconv.Quote(info.ETag))
+	}
+
+	// ServeContent handles Range, If-Range, Content-Length and Accept-Ranges
+	http.ServeContent(w, r, "", info.LastModified, object)
+
+	return nil
+}
+
 // HandleDeleteVoiceMessage deletes a voice message (only by sender)
 func (h *Handler) HandleDeleteVoiceMessage(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
 	userID := auth.GetUserID(r.Context())
 	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
 	if err != nil {
 		return httputil.BadRequest("Invalid message ID")
 	}
 
-	h.log.Debug("delete voice message request",
+	log.Debug("delete voice message request",
 		"user_id", userID,
 		"message_id", messageID)
 
@@ -402,46 +728,359 @@ func (h *Handler) HandleDeleteVoiceMessage(w http.ResponseWriter, r *http.Reques
 	defer cancel()
 
 	// Get the message
-	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID)
+	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID, false)
 	if err != nil {
-		h.log.Debug("voice message not found for deletion",
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Message not found")
+		}
+		log.Error("failed to get voice message for deletion",
 			"message_id", messageID,
 			"error", err)
-		return httputil.NotFound("Message not found")
+		return httputil.Internal(err)
 	}
 
 	// Only sender can delete their own messages
 	if message.SenderID != userID {
-		h.log.Warn("delete voice message blocked - not message owner",
+		log.Warn("delete voice message blocked - not message owner",
 			"user_id", userID,
 			"message_id", messageID,
 			"owner_id", message.SenderID)
 		return httputil.Forbidden("You can only delete your messages")
 	}
 
-	// Delete from S3 first
+	// Soft delete, the row stays as a tombstone until purged
+	if err := h.dbStore.DeleteVoiceMessage(ctx, messageID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Message not found")
+		}
+		log.Error(
+			"failed to delete voice message from database",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	// The audio outlives the delete for the grace period, so a mistake can still be undone
+	if h.cfg.DeleteGracePeriod > 0 {
+		h.enqueueDeletion(ctx, message.S3Key, DeletionReasonMessageDeleted, time.Now().Add(h.cfg.DeleteGracePeriod))
+	}
+
+	h.wsManager.BroadcastToRoom(message.RoomID, websocket.ServerMessage{
+		Type: websocket.TypeVoiceMessageDeleted,
+		Data: websocket.VoiceMessageDeletedData{
+			MessageID: message.ID,
+			RoomID:    message.RoomID,
+		},
+	})
+
+	log.Info(
+		"voice message deleted successfully",
+		"message_id", messageID,
+		"deleted_by", userID,
+		"room_id", message.RoomID)
+
+	return httputil.RespondJSON(w, http.StatusOK, "Message deleted successfully")
+}
+
+// HandlePurgeVoiceMessage irrevocably erases a soft-deleted voice message (only by sender).
+// Both the S3 object and the database row are removed
+func (h *Handler) HandlePurgeVoiceMessage(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid message ID")
+	}
+
+	log.Debug("purge voice message request",
+		"user_id", userID,
+		"message_id", messageID)
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID, true)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Message not found")
+		}
+		log.Error("failed to get voice message for purge",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if message.SenderID != userID {
+		log.Warn("purge voice message blocked - not message owner",
+			"user_id", userID,
+			"message_id", messageID,
+			"owner_id", message.SenderID)
+		return httputil.Forbidden("You can only purge your messages")
+	}
+
+	if message.DeletedAt == nil {
+		return httputil.Conflict("Message must be deleted before it can be purged")
+	}
+
+	// Remove the audio first so a failure leaves the row in place for a retry
 	if err := h.fileStore.DeleteVoiceMessage(ctx, message.S3Key); err != nil {
-		h.log.Error("failed to delete voice message from S3",
+		log.Error("failed to purge voice message from S3",
 			"message_id", messageID,
 			"s3_key", message.S3Key,
 			"error", err)
-		// Continue to delete from DB anyway
+		return httputil.Internal(err)
 	}
 
-	// Delete from database
-	if err := h.dbStore.DeleteVoiceMessage(ctx, messageID); err != nil {
-		h.log.Error(
-			"failed to delete voice message from database",
+	if err := h.dbStore.PurgeVoiceMessage(ctx, messageID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httputil.NotFound("Message not found")
+		}
+		log.Error("failed to purge voice message from database",
 			"message_id", messageID,
 			"error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info(
-		"voice message deleted successfully",
+	log.Info("voice message purged",
 		"message_id", messageID,
-		"deleted_by", userID,
+		"purged_by", userID,
 		"room_id", message.RoomID)
 
-	return httputil.RespondJSON(w, http.StatusOK, "Message deleted successfully")
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// withURLs adds presigned URLs, the viewer's reaction summaries and play counts to messages.
+// The returned error is ready to be returned from a handler
+func (h *Handler) withURLs(ctx context.Context, messages []*VoiceMessage, userID uuid.UUID, download bool) ([]VoiceMessageWithURL, error) {
+	log := logger.FromContext(ctx)
+	// Generate presigned URLs for all messages in one batch
+	keys := make([]string, len(messages))
+	for i, msg := range messages {
+		keys[i] = msg.S3Key
+	}
+	signedAt := time.Now()
+	urls, urlErrs := h.fileStore.GetPresignedURLs(ctx, keys, h.cfg.URLExpiry, download)
+
+	ids := make([]uuid.UUID, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	reactions, err := h.reactionStore.GetReactions(ctx, ids, userID)
+	if err != nil {
+		log.Error("failed to get reactions for messages",
+			"user_id", userID,
+			"error", err)
+		return nil, httputil.Internal(err)
+	}
+
+	plays, err := h.playStore.GetPlayCounts(ctx, ids, userID)
+	if err != nil {
+		log.Error("failed to get play counts for messages",
+			"user_id", userID,
+			"error", err)
+		return nil, httputil.Internal(err)
+	}
+
+	messagesWithURLs := make([]VoiceMessageWithURL, 0, len(messages))
+	for i, msg := range messages {
+		if urlErrs[i] != nil {
+			log.Warn("failed to generate presigned URL for message",
+				"message_id", msg.ID,
+				"s3_key", msg.S3Key,
+				"error", urlErrs[i])
+		}
+
+		messagesWithURLs = append(messagesWithURLs, VoiceMessageWithURL{
+			VoiceMessage: *msg,
+			URL:          urls[i],
+			URLExpiresAt: h.urlExpiresAt(urls[i], signedAt),
+			Reactions:    reactionsOrEmpty(reactions[msg.ID]),
+			Played:       plays[msg.ID] > 0,
+			PlayCount:    plays[msg.ID],
+		})
+	}
+
+	return messagesWithURLs, nil
+}
+
+// urlExpiresAt returns when a URL presigned at signedAt stops working, nil when
+// signing failed. signedAt is taken before signing, so the time errs early
+func (h *Handler) urlExpiresAt(url string, signedAt time.Time) *time.Time {
+	if url == "" {
+		return nil
+	}
+	expiresAt := signedAt.Add(h.cfg.URLExpiry)
+	return &expiresAt
+}
+
+// notifyOffline pushes a new message notification to room members who are
+// offline and haven't muted the room
+func (h *Handler) notifyOffline(message *VoiceMessage, senderName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+
+	participants, err := h.roomStore.GetRoomParticipants(ctx, message.RoomID)
+	if err != nil {
+		h.log.Warn("failed to load participants for push",
+			"room_id", message.RoomID,
+			"error", err)
+		return
+	}
+
+	now := time.Now()
+	recipients := make([]uuid.UUID, 0, len(participants))
+	for _, p := range participants {
+		if p.UserID == message.SenderID || p.IsMuted(now) || h.wsManager.IsUserOnline(p.UserID) {
+			continue
+		}
+		recipients = append(recipients, p.UserID)
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	title := "New voice message"
+	if rm, err := h.roomStore.GetRoomByID(ctx, message.RoomID); err == nil && rm.Name != nil {
+		title = *rm.Name
+	}
+
+	h.push.NotifyUsers(ctx, recipients, push.Notification{
+		Title: title,
+		Body:  fmt.Sprintf("%s sent a voice message", senderName),
+		Data: map[string]string{
+			"type":       "new_voice_message",
+			"room_id":    message.RoomID.String(),
+			"message_id": message.ID.String(),
+			"sender_id":  message.SenderID.String(),
+		},
+	})
+}
+
+// rollbackUpload removes the audio of an upload whose database record could not
+// be created. If that fails too the key is queued for the sweeper. The enqueue
+// gets a context of its own, a delete that timed out leaves the first one expired
+func (h *Handler) rollbackUpload(s3Key string) {
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), uploadCleanupTimeout)
+	defer cleanupCancel()
+
+	cleanupErr := h.fileStore.DeleteVoiceMessage(cleanupCtx, s3Key)
+	if cleanupErr == nil {
+		return
+	}
+
+	h.log.Error("failed to cleanup S3 after database error, queueing for sweeper",
+		"s3_key", s3Key,
+		"error", cleanupErr)
+
+	enqueueCtx, enqueueCancel := context.WithTimeout(context.Background(), h.dbTimeout)
+	defer enqueueCancel()
+	h.enqueueDeletion(enqueueCtx, s3Key, DeletionReasonUploadRollback, time.Now())
+}
+
+// enqueueDeletion records an S3 object in pending_deletions so the sweeper removes it after notBefore
+func (h *Handler) enqueueDeletion(ctx context.Context, s3Key, reason string, notBefore time.Time) {
+	log := logger.FromContext(ctx)
+	if err := h.pendingStore.EnqueueDeletion(ctx, s3Key, reason, notBefore); err != nil {
+		log.Error("failed to enqueue orphaned S3 object for deletion",
+			"s3_key", s3Key,
+			"reason", reason,
+			"error", err)
+	}
+}
+
+// wantsDownload reads ?download=, which makes presigned URLs save the file instead of playing it inline
+func wantsDownload(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("download")
+	if raw == "" {
+		return false, nil
+	}
+
+	download, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, httputil.BadRequest("download must be a boolean")
+	}
+	return download, nil
+}
+
+// wantsDeleted reports whether the request asked for soft-deleted messages with
+// include_deleted=true. Only the room owner may see them
+func (h *Handler) wantsDeleted(ctx context.Context, r *http.Request, roomID, userID uuid.UUID) (bool, error) {
+	log := logger.FromContext(r.Context())
+	raw := r.URL.Query().Get("include_deleted")
+	if raw == "" {
+		return false, nil
+	}
+
+	include, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, httputil.BadRequest("include_deleted must be a boolean")
+	}
+	if !include {
+		return false, nil
+	}
+
+	role, err := h.roomStore.GetParticipantRole(ctx, roomID, userID)
+	if err != nil {
+		log.Error("failed to get participant role",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return false, httputil.Internal(err)
+	}
+	if role != room.RoleOwner {
+		return false, httputil.Forbidden("Only the room owner can view deleted messages")
+	}
+
+	return true, nil
+}
+
+// measureDuration returns the real length of the audio in whole seconds,
+// falling back to the declared value when the file doesn't tell
+func (h *Handler) measureDuration(file io.ReaderAt, size int64, format string, declared int) (int, error) {
+	measured, err := audio.Duration(file, size, format)
+	if err != nil {
+		h.log.Debug("could not measure audio duration, using declared value",
+			"format", format,
+			"declared", declared,
+			"error", err)
+		return declared, nil
+	}
+
+	maxDuration := h.cfg.MaxDurationSeconds
+	if measured > time.Duration(maxDuration)*time.Second+durationTolerance {
+		return 0, httputil.BadRequest(fmt.Sprintf("Audio is longer than %d seconds", maxDuration), map[string]any{
+			"measured_seconds": measured.Seconds(),
+		})
+	}
+
+	seconds := min(max(int(measured.Round(time.Second)/time.Second), 1), maxDuration)
+	if seconds != declared {
+		h.log.Debug("declared duration differs from measured, storing measured",
+			"declared", declared,
+			"measured", measured)
+	}
+
+	return seconds, nil
+}
+
+// parseDuration parses the duration_seconds form value.
+// Durations are stored as whole seconds, so fractional values such as "3.5"
+// get a dedicated error instead of the generic range message.
+func parseDuration(value string, maxDuration int) (int, error) {
+	duration, err := strconv.Atoi(value)
+	if err != nil {
+		if _, floatErr := strconv.ParseFloat(value, 64); floatErr == nil {
+			return 0, httputil.BadRequest("duration_seconds must be a whole number of seconds", map[string]string{
+				"duration_seconds": value,
+			})
+		}
+		return 0, httputil.BadRequest("duration_seconds must be an integer")
+	}
+
+	if duration <= 0 || duration > maxDuration {
+		return 0, httputil.BadRequest(fmt.Sprintf("duration_seconds must be between 1 and %d", maxDuration))
+	}
+
+	return duration, nil
 }
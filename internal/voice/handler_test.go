@@ -0,0 +1,137 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/room"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// memberRoomStore reports every user as a member of every room
+type memberRoomStore struct {
+	room.Store
+}
+
+func (memberRoomStore) IsUserInRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+// failingDBStore fails every insert
+type failingDBStore struct {
+	VoiceMessageDBStore
+}
+
+func (failingDBStore) CreateVoiceMessage(ctx context.Context, message *VoiceMessage) error {
+	return errors.New("database unavailable")
+}
+
+// stuckFileStore accepts uploads, but deletes hang until their context expires
+type stuckFileStore struct {
+	VoiceMessageStore
+}
+
+func (stuckFileStore) UploadVoiceMessage(ctx context.Context, messageID uuid.UUID, reader io.Reader, size int64, audioFormat string) (string, error) {
+	return "voice/" + messageID.String() + ".ogg", nil
+}
+
+func (stuckFileStore) DeleteVoiceMessage(ctx context.Context, objectName string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type queuedDeletion struct {
+	s3Key  string
+	reason string
+	ctxErr error
+}
+
+// recordingPendingStore keeps what was queued and the state of the context it came with
+type recordingPendingStore struct {
+	PendingDeletionStore
+
+	mu     sync.Mutex
+	queued []queuedDeletion
+}
+
+func (s *recordingPendingStore) EnqueueDeletion(ctx context.Context, s3Key, reason string, notBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued = append(s.queued, queuedDeletion{s3Key, reason, ctx.Err()})
+	return ctx.Err()
+}
+
+func TestUploadQueuesOrphanWhenRollbackFails(t *testing.T) {
+	pending := &recordingPendingStore{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := NewHandler(
+		failingDBStore{},
+		stuckFileStore{},
+		pending,
+		nil, nil, nil, nil,
+		memberRoomStore{},
+		nil, nil,
+		log,
+		5*time.Second,
+		Config{EnabledFormats: []string{"ogg"}},
+	)
+
+	authService := auth.NewService(auth.NewHMACSigner("test-secret"), time.Minute, time.Hour, nil)
+	token, err := authService.GenerateAccessToken(uuid.New(), "user@example.com", "user", auth.RoleUser, true)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("room_id", uuid.NewString())
+	mw.WriteField("duration_seconds", "3")
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="audio"; filename="a.ogg"`)
+	header.Set("Content-Type", "audio/ogg")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatalf("create audio part: %v", err)
+	}
+	part.Write(append([]byte("OggS"), make([]byte, 512)...))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	auth.Middleware(authService)(httputil.Handler(h.HandleUploadVoiceMessage, log)).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusInternalServerError, rec.Body)
+	}
+
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	if len(pending.queued) != 1 {
+		t.Fatalf("queued %d deletions, want 1", len(pending.queued))
+	}
+	got := pending.queued[0]
+	if got.reason != DeletionReasonUploadRollback {
+		t.Errorf("reason = %q, want %q", got.reason, DeletionReasonUploadRollback)
+	}
+	if got.s3Key == "" {
+		t.Error("queued an empty s3 key")
+	}
+	if got.ctxErr != nil {
+		t.Errorf("enqueue got an expired context: %v", got.ctxErr)
+	}
+}
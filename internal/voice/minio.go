@@ -4,12 +4,21 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
+	"path"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
+	"github.com/rx3lixir/laba_zis/pkg/audio"
 )
 
+var _ VoiceMessageStore = (*MinIOVoiceStore)(nil)
+
+// presignWorkers bounds how many URLs GetPresignedURLs signs concurrently
+const presignWorkers = 8
+
 type MinIOVoiceStore struct {
 	client     *minio.Client
 	bucketName string
@@ -26,7 +35,7 @@ func NewMinIOVoiceStore(client *minio.Client, bucketName string) *MinIOVoiceStor
 func (m *MinIOVoiceStore) generateObjectName(messageID uuid.UUID, audioFormat string) string {
 	now := time.Now()
 
-	// FIXED: Your original code had day/month swapped!
+	// messages/YYYY/MM/DD/<id>.<ext>
 	return fmt.Sprintf(
 		"messages/%d/%02d/%02d/%s.%s",
 		now.Year(),
@@ -47,7 +56,7 @@ func (m *MinIOVoiceStore) UploadVoiceMessage(
 ) (string, error) {
 	objectName := m.generateObjectName(messageID, audioFormat)
 
-	contentType := getContentType(audioFormat)
+	contentType := audio.ContentType(audioFormat)
 
 	_, err := m.client.PutObject(
 		ctx,
@@ -86,6 +95,30 @@ func (m *MinIOVoiceStore) DownloadVoiceMessage(ctx context.Context, objectName s
 	return data, nil
 }
 
+// OpenVoiceMessage opens a voice message for streaming, reads and seeks go to MinIO lazily
+func (m *MinIOVoiceStore) OpenVoiceMessage(ctx context.Context, objectName string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	object, err := m.client.GetObject(ctx, m.bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	stat, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	info := &ObjectInfo{
+		Key:          objectName,
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+	}
+
+	return object, info, nil
+}
+
 // DeleteVoiceMessage deletes a voice message from MinIO
 func (m *MinIOVoiceStore) DeleteVoiceMessage(ctx context.Context, objectName string) error {
 	err := m.client.RemoveObject(ctx, m.bucketName, objectName, minio.RemoveObjectOptions{})
@@ -95,13 +128,71 @@ func (m *MinIOVoiceStore) DeleteVoiceMessage(ctx context.Context, objectName str
 	return nil
 }
 
-// DeleteVoiceMessage deletes a voice message from MinIO
-func (m *MinIOVoiceStore) GetPresignedURL(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
-	url, err := m.client.PresignedGetObject(ctx, m.bucketName, objectName, expiry, nil)
+// ListVoiceMessages lists every object under prefix
+func (m *MinIOVoiceStore) ListVoiceMessages(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+
+	for obj := range m.client.ListObjects(ctx, m.bucketName, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", obj.Err)
+		}
+		objects = append(objects, ObjectInfo{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			ContentType:  obj.ContentType,
+			ETag:         obj.ETag,
+			LastModified: obj.LastModified,
+		})
+	}
+
+	return objects, nil
+}
+
+// GetPresignedURL generates a temporary URL for an object. Objects are served
+// inline unless download is set, then as an attachment named after the object
+func (m *MinIOVoiceStore) GetPresignedURL(ctx context.Context, objectName string, expiry time.Duration, download bool) (string, error) {
+	var reqParams url.Values
+	if download {
+		reqParams = url.Values{}
+		reqParams.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", path.Base(objectName)))
+	}
+
+	presigned, err := m.client.PresignedGetObject(ctx, m.bucketName, objectName, expiry, reqParams)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate presigned url: %w", err)
 	}
-	return url.String(), nil
+	return presigned.String(), nil
+}
+
+// GetPresignedURLs signs the keys on a bounded pool of workers, keeping the input order
+func (m *MinIOVoiceStore) GetPresignedURLs(ctx context.Context, objectNames []string, expiry time.Duration, download bool) ([]string, []error) {
+	urls := make([]string, len(objectNames))
+	errs := make([]error, len(objectNames))
+
+	workers := min(presignWorkers, len(objectNames))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				urls[i], errs[i] = m.GetPresignedURL(ctx, objectNames[i], expiry, download)
+			}
+		}()
+	}
+
+	for i := range objectNames {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return urls, errs
 }
 
 // GetObjectInfo retrieves metadata about a stored object
@@ -112,21 +203,3 @@ func (m *MinIOVoiceStore) GetObjectInfo(ctx context.Context, objectName string)
 	}
 	return &info, nil
 }
-
-// getContentType maps audio format to MIME type
-func getContentType(audioFormat string) string {
-	switch audioFormat {
-	case "webm":
-		return "audio/webm"
-	case "m4a", "mp4":
-		return "audio/mp4"
-	case "mp3":
-		return "audio/mpeg"
-	case "ogg", "opus":
-		return "audio/ogg"
-	case "wav":
-		return "audio/wav"
-	default:
-		return "application/octet-stream"
-	}
-}
@@ -0,0 +1,65 @@
+package voice
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// newBenchStore returns a store whose client signs offline, a fixed region
+// keeps presigning from looking up the bucket location
+func newBenchStore(b *testing.B) *MinIOVoiceStore {
+	b.Helper()
+
+	client, err := minio.New("localhost:9000", &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		b.Fatalf("create minio client: %v", err)
+	}
+
+	return NewMinIOVoiceStore(client, "voice")
+}
+
+func benchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("messages/2025/12/01/%d.ogg", i)
+	}
+	return keys
+}
+
+// BenchmarkGetPresignedURLsSequential signs a page of keys one by one, as the handlers did before batching
+func BenchmarkGetPresignedURLsSequential(b *testing.B) {
+	store := newBenchStore(b)
+	keys := benchKeys(defaultLimit)
+	ctx := context.Background()
+
+	for b.Loop() {
+		for _, key := range keys {
+			if _, err := store.GetPresignedURL(ctx, key, time.Hour, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkGetPresignedURLsBatch(b *testing.B) {
+	store := newBenchStore(b)
+	keys := benchKeys(defaultLimit)
+	ctx := context.Background()
+
+	for b.Loop() {
+		_, errs := store.GetPresignedURLs(ctx, keys, time.Hour, false)
+		for _, err := range errs {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package voice
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/websocket"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+// HandleMarkPlayed records that the user listened to a message. Unlike read
+// receipts every play counts, and the room is told so the sender sees it
+func (h *Handler) HandleMarkPlayed(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid message ID")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	message, err := h.messageForMember(ctx, messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	play, err := h.playStore.RecordPlay(ctx, messageID, userID)
+	if err != nil {
+		log.Error("failed to record message play",
+			"message_id", messageID,
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	// Senders replaying their own message aren't news to anyone
+	if userID != message.SenderID {
+		h.wsManager.BroadcastToRoom(message.RoomID, websocket.ServerMessage{
+			Type: websocket.TypePlayed,
+			Data: websocket.PlayedData{
+				MessageID: messageID,
+				UserID:    userID,
+				PlayCount: play.PlayCount,
+				PlayedAt:  play.LastPlayedAt,
+			},
+		})
+	}
+
+	log.Debug("message played",
+		"message_id", messageID,
+		"user_id", userID,
+		"play_count", play.PlayCount)
+
+	return httputil.RespondJSON(w, http.StatusOK, play)
+}
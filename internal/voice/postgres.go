@@ -9,6 +9,17 @@ import (
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rx3lixir/laba_zis/internal/storage/postgres"
+)
+
+var (
+	_ VoiceMessageDBStore  = (*PostgresStore)(nil)
+	_ PendingDeletionStore = (*PostgresStore)(nil)
+	_ MessageKeyStore      = (*PostgresStore)(nil)
+	_ ReactionStore        = (*PostgresStore)(nil)
+	_ ReadStore            = (*PostgresStore)(nil)
+	_ TranscriptStore      = (*PostgresStore)(nil)
+	_ PlayStore            = (*PostgresStore)(nil)
 )
 
 type PostgresStore struct {
@@ -22,11 +33,14 @@ func NewPostgresStore(pool *pgxpool.Pool) *PostgresStore {
 // CreateVoiceMessage creates a voice message record in the database
 func (s *PostgresStore) CreateVoiceMessage(ctx context.Context, message *VoiceMessage) error {
 	query := `
-		INSERT INTO voice_messages (id, room_id, sender_id, s3_key, duration_seconds, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO voice_messages (id, room_id, sender_id, s3_key, duration_seconds, size_bytes, content_type, enrichment_status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
-	message.ID = uuid.New()
+	// The handler picks the ID up front since it's part of the S3 key
+	if message.ID == uuid.Nil {
+		message.ID = uuid.New()
+	}
 	message.CreatedAt = time.Now()
 
 	_, err := s.pool.Exec(ctx, query,
@@ -35,6 +49,9 @@ func (s *PostgresStore) CreateVoiceMessage(ctx context.Context, message *VoiceMe
 		message.SenderID,
 		message.S3Key,
 		message.DurationSeconds,
+		message.SizeBytes,
+		message.ContentType,
+		message.EnrichmentStatus,
 		message.CreatedAt,
 	)
 	if err != nil {
@@ -48,25 +65,32 @@ func (s *PostgresStore) CreateVoiceMessage(ctx context.Context, message *VoiceMe
 }
 
 // GetVoiceMessageByID retrieves a voice message by ID
-func (s *PostgresStore) GetVoiceMessageByID(ctx context.Context, messageID uuid.UUID) (*VoiceMessage, error) {
+func (s *PostgresStore) GetVoiceMessageByID(ctx context.Context, messageID uuid.UUID, includeDeleted bool) (*VoiceMessage, error) {
 	query := `
-		SELECT id, room_id, sender_id, s3_key, duration_seconds, created_at
+		SELECT id, room_id, sender_id, s3_key, duration_seconds, size_bytes, content_type, transcript, enrichment_status, created_at, deleted_at
 		FROM voice_messages
-		WHERE id = $1
+		WHERE id = $1 AND ($2 OR deleted_at IS NULL)
 	`
 
 	message := &VoiceMessage{}
-	err := s.pool.QueryRow(ctx, query, messageID).Scan(
-		&message.ID,
-		&message.RoomID,
-		&message.SenderID,
-		&message.S3Key,
-		&message.DurationSeconds,
-		&message.CreatedAt,
-	)
+	err := postgres.Retry(ctx, postgres.ReadRetry, func() error {
+		return s.pool.QueryRow(ctx, query, messageID, includeDeleted).Scan(
+			&message.ID,
+			&message.RoomID,
+			&message.SenderID,
+			&message.S3Key,
+			&message.DurationSeconds,
+			&message.SizeBytes,
+			&message.ContentType,
+			&message.Transcript,
+			&message.EnrichmentStatus,
+			&message.CreatedAt,
+			&message.DeletedAt,
+		)
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("voice message not found")
+			return nil, fmt.Errorf("failed to get voice message: %w", ErrNotFound)
 		}
 		return nil, fmt.Errorf("failed to get voice message: %w", err)
 	}
@@ -75,16 +99,22 @@ func (s *PostgresStore) GetVoiceMessageByID(ctx context.Context, messageID uuid.
 }
 
 // GetRoomMessages retrieves all voice messages in a room with pagination
-func (s *PostgresStore) GetRoomMessages(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*VoiceMessage, error) {
+func (s *PostgresStore) GetRoomMessages(ctx context.Context, roomID uuid.UUID, limit, offset int, includeDeleted bool) ([]*VoiceMessage, error) {
 	query := `
-		SELECT id, room_id, sender_id, s3_key, duration_seconds, created_at
+		SELECT id, room_id, sender_id, s3_key, duration_seconds, size_bytes, content_type, transcript, enrichment_status, created_at, deleted_at
 		FROM voice_messages
-		WHERE room_id = $1
+		WHERE room_id = $1 AND ($4 OR deleted_at IS NULL)
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := s.pool.Query(ctx, query, roomID, limit, offset)
+	// Retried up to the first row, once rows are being read a dropped connection is returned
+	var rows pgx.Rows
+	err := postgres.Retry(ctx, postgres.ReadRetry, func() error {
+		var err error
+		rows, err = s.pool.Query(ctx, query, roomID, limit, offset, includeDeleted)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get room messages: %w", err)
 	}
@@ -99,7 +129,12 @@ func (s *PostgresStore) GetRoomMessages(ctx context.Context, roomID uuid.UUID, l
 			&msg.SenderID,
 			&msg.S3Key,
 			&msg.DurationSeconds,
+			&msg.SizeBytes,
+			&msg.ContentType,
+			&msg.Transcript,
+			&msg.EnrichmentStatus,
 			&msg.CreatedAt,
+			&msg.DeletedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan voice message: %w", err)
@@ -114,17 +149,33 @@ func (s *PostgresStore) GetRoomMessages(ctx context.Context, roomID uuid.UUID, l
 	return messages, nil
 }
 
-// DeleteVoiceMessage deletes a voice message record from the database
+// DeleteVoiceMessage marks a voice message deleted, keeping the row as a tombstone
 func (s *PostgresStore) DeleteVoiceMessage(ctx context.Context, messageID uuid.UUID) error {
-	query := `DELETE FROM voice_messages WHERE id = $1`
+	query := `UPDATE voice_messages SET deleted_at = $2 WHERE id = $1 AND deleted_at IS NULL`
 
-	result, err := s.pool.Exec(ctx, query, messageID)
+	result, err := s.pool.Exec(ctx, query, messageID, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to delete voice message: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("voice message not found")
+		return fmt.Errorf("failed to delete voice message: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// PurgeVoiceMessage permanently removes a voice message that was already soft-deleted
+func (s *PostgresStore) PurgeVoiceMessage(ctx context.Context, messageID uuid.UUID) error {
+	query := `DELETE FROM voice_messages WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	result, err := s.pool.Exec(ctx, query, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to purge voice message: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to purge voice message: %w", ErrNotFound)
 	}
 
 	return nil
@@ -133,9 +184,9 @@ func (s *PostgresStore) DeleteVoiceMessage(ctx context.Context, messageID uuid.U
 // GetMessagesBySender retrieves all messages sent by a specific user
 func (s *PostgresStore) GetMessagesBySender(ctx context.Context, senderID uuid.UUID, limit, offset int) ([]*VoiceMessage, error) {
 	query := `
-		SELECT id, room_id, sender_id, s3_key, duration_seconds, created_at
+		SELECT id, room_id, sender_id, s3_key, duration_seconds, size_bytes, content_type, transcript, enrichment_status, created_at, deleted_at
 		FROM voice_messages
-		WHERE sender_id = $1
+		WHERE sender_id = $1 AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3
 	`
@@ -155,7 +206,171 @@ func (s *PostgresStore) GetMessagesBySender(ctx context.Context, senderID uuid.U
 			&msg.SenderID,
 			&msg.S3Key,
 			&msg.DurationSeconds,
+			&msg.SizeBytes,
+			&msg.ContentType,
+			&msg.Transcript,
+			&msg.EnrichmentStatus,
+			&msg.CreatedAt,
+			&msg.DeletedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan voice message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating voice messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// DeleteMessagesBySender removes the sender's rows and queues their S3 keys,
+// so either both happen or neither does
+func (s *PostgresStore) DeleteMessagesBySender(ctx context.Context, senderID uuid.UUID, reason string) (int, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM voice_messages
+			WHERE sender_id = $1
+			RETURNING s3_key
+		), queued AS (
+			INSERT INTO pending_deletions (id, s3_key, reason, not_before, created_at)
+			SELECT gen_random_uuid(), s3_key, $2, $3, $3
+			FROM deleted
+			ON CONFLICT (s3_key) DO NOTHING
+		)
+		SELECT COUNT(*) FROM deleted
+	`
+
+	var count int
+	if err := s.pool.QueryRow(ctx, query, senderID, reason, time.Now()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to delete sender messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// AnonymizeMessagesBySender clears sender_id on the sender's messages
+func (s *PostgresStore) AnonymizeMessagesBySender(ctx context.Context, senderID uuid.UUID) (int, error) {
+	query := `UPDATE voice_messages SET sender_id = NULL WHERE sender_id = $1`
+
+	result, err := s.pool.Exec(ctx, query, senderID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to anonymize sender messages: %w", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
+
+// SetTranscript stores the transcript of a message and marks its enrichment done,
+// the search vector is generated by postgres. An empty transcript is stored as NULL
+func (s *PostgresStore) SetTranscript(ctx context.Context, messageID uuid.UUID, transcript string) error {
+	query := `
+		UPDATE voice_messages
+		SET transcript = NULLIF($2, ''), enrichment_status = 'done', enrichment_retry_at = NULL
+		WHERE id = $1
+	`
+
+	result, err := s.pool.Exec(ctx, query, messageID, transcript)
+	if err != nil {
+		return fmt.Errorf("failed to set transcript: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to set transcript: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// MarkEnrichmentFailed flags the message failed and counts the attempt. A nil
+// retryAt leaves it failed for good
+func (s *PostgresStore) MarkEnrichmentFailed(ctx context.Context, messageID uuid.UUID, retryAt *time.Time) error {
+	query := `
+		UPDATE voice_messages
+		SET enrichment_status = 'failed',
+		    enrichment_attempts = enrichment_attempts + 1,
+		    enrichment_retry_at = $2
+		WHERE id = $1
+	`
+
+	result, err := s.pool.Exec(ctx, query, messageID, retryAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark enrichment failed: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("failed to mark enrichment failed: %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetFailedEnrichments returns live messages whose enrichment failed and is due
+// for a retry, oldest retry first
+func (s *PostgresStore) GetFailedEnrichments(ctx context.Context, limit int) ([]*EnrichmentJob, error) {
+	query := `
+		SELECT id, room_id, s3_key, content_type, enrichment_attempts
+		FROM voice_messages
+		WHERE enrichment_status = 'failed' AND enrichment_retry_at <= $1 AND deleted_at IS NULL
+		ORDER BY enrichment_retry_at
+		LIMIT $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, time.Now(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failed enrichments: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*EnrichmentJob{}
+	for rows.Next() {
+		job := &EnrichmentJob{}
+		if err := rows.Scan(&job.MessageID, &job.RoomID, &job.S3Key, &job.ContentType, &job.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan failed enrichment: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating failed enrichments: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// SearchRoomMessages matches query with websearch syntax ("quoted phrases", -exclusions)
+func (s *PostgresStore) SearchRoomMessages(ctx context.Context, roomID uuid.UUID, query string, limit, offset int) ([]*VoiceMessage, error) {
+	sql := `
+		SELECT id, room_id, sender_id, s3_key, duration_seconds, size_bytes, content_type, transcript, enrichment_status, created_at, deleted_at
+		FROM voice_messages, websearch_to_tsquery('simple', $2) AS q
+		WHERE room_id = $1 AND deleted_at IS NULL AND transcript_tsv @@ q
+		ORDER BY ts_rank(transcript_tsv, q) DESC, created_at DESC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := s.pool.Query(ctx, sql, roomID, query, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search room messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*VoiceMessage{}
+	for rows.Next() {
+		msg := &VoiceMessage{}
+		err := rows.Scan(
+			&msg.ID,
+			&msg.RoomID,
+			&msg.SenderID,
+			&msg.S3Key,
+			&msg.DurationSeconds,
+			&msg.SizeBytes,
+			&msg.ContentType,
+			&msg.Transcript,
+			&msg.EnrichmentStatus,
 			&msg.CreatedAt,
+			&msg.DeletedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan voice message: %w", err)
@@ -169,3 +384,343 @@ func (s *PostgresStore) GetMessagesBySender(ctx context.Context, senderID uuid.U
 
 	return messages, nil
 }
+
+// ExistingS3Keys reports which of the keys belong to a voice message row, soft-deleted rows included
+func (s *PostgresStore) ExistingS3Keys(ctx context.Context, keys []string) (map[string]bool, error) {
+	query := `SELECT s3_key FROM voice_messages WHERE s3_key = ANY($1)`
+
+	rows, err := s.pool.Query(ctx, query, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up s3 keys: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool, len(keys))
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan s3 key: %w", err)
+		}
+		existing[key] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating s3 keys: %w", err)
+	}
+
+	return existing, nil
+}
+
+// ListS3Keys pages through message keys in s3_key order, starting after the given key
+func (s *PostgresStore) ListS3Keys(ctx context.Context, after string, limit int) ([]MessageKey, error) {
+	query := `
+		SELECT id, s3_key
+		FROM voice_messages
+		WHERE s3_key > $1
+		ORDER BY s3_key
+		LIMIT $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list s3 keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []MessageKey{}
+	for rows.Next() {
+		var k MessageKey
+		if err := rows.Scan(&k.ID, &k.S3Key); err != nil {
+			return nil, fmt.Errorf("failed to scan message key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// AddReaction records a reaction, returning false if it already existed
+func (s *PostgresStore) AddReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error) {
+	query := `
+		INSERT INTO message_reactions (message_id, user_id, emoji, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+	`
+
+	tag, err := s.pool.Exec(ctx, query, messageID, userID, emoji, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// RemoveReaction deletes a reaction, returning false if there was none
+func (s *PostgresStore) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error) {
+	query := `DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+
+	tag, err := s.pool.Exec(ctx, query, messageID, userID, emoji)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetReactions counts reactions per message and emoji, most used and then oldest first
+func (s *PostgresStore) GetReactions(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID][]ReactionSummary, error) {
+	query := `
+		SELECT message_id, emoji, COUNT(*), BOOL_OR(user_id = $2)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, COUNT(*) DESC, MIN(created_at)
+	`
+
+	rows, err := s.pool.Query(ctx, query, messageIDs, viewerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := make(map[uuid.UUID][]ReactionSummary, len(messageIDs))
+	for rows.Next() {
+		var (
+			messageID uuid.UUID
+			summary   ReactionSummary
+		)
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &summary.Reacted); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		reactions[messageID] = append(reactions[messageID], summary)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reactions: %w", err)
+	}
+
+	return reactions, nil
+}
+
+// MarkRead inserts a read only for a live message of the room not sent by the reader,
+// so receipts for other rooms or repeated receipts store nothing
+func (s *PostgresStore) MarkRead(ctx context.Context, userID, roomID, messageID uuid.UUID) (time.Time, bool, error) {
+	query := `
+		INSERT INTO message_reads (message_id, user_id, read_at)
+		SELECT id, $2, $4
+		FROM voice_messages
+		WHERE id = $1 AND room_id = $3 AND sender_id IS DISTINCT FROM $2 AND deleted_at IS NULL
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`
+
+	readAt := time.Now()
+	tag, err := s.pool.Exec(ctx, query, messageID, userID, roomID, readAt)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to mark message read: %w", err)
+	}
+
+	return readAt, tag.RowsAffected() == 1, nil
+}
+
+// MarkRoomRead marks the room read in one insert-select, so the cost doesn't
+// grow with the number of unread messages beyond the statement itself
+func (s *PostgresStore) MarkRoomRead(ctx context.Context, userID, roomID uuid.UUID, upTo *uuid.UUID) (time.Time, int, error) {
+	query := `
+		INSERT INTO message_reads (message_id, user_id, read_at)
+		SELECT vm.id, $2, $4
+		FROM voice_messages vm
+		WHERE vm.room_id = $1
+			AND vm.sender_id IS DISTINCT FROM $2
+			AND vm.deleted_at IS NULL
+			AND ($3::uuid IS NULL OR vm.created_at <= (
+				SELECT created_at FROM voice_messages WHERE id = $3 AND room_id = $1
+			))
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`
+
+	readAt := time.Now()
+	tag, err := s.pool.Exec(ctx, query, roomID, userID, upTo, readAt)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to mark room read: %w", err)
+	}
+
+	return readAt, int(tag.RowsAffected()), nil
+}
+
+// GetReads lists the readers of a message with their usernames, earliest first
+func (s *PostgresStore) GetReads(ctx context.Context, messageID uuid.UUID) ([]MessageRead, error) {
+	query := `
+		SELECT mr.user_id, u.username, mr.read_at
+		FROM message_reads mr
+		JOIN users u ON u.id = mr.user_id
+		WHERE mr.message_id = $1
+		ORDER BY mr.read_at
+	`
+
+	rows, err := s.pool.Query(ctx, query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message reads: %w", err)
+	}
+	defer rows.Close()
+
+	reads := []MessageRead{}
+	for rows.Next() {
+		var read MessageRead
+		if err := rows.Scan(&read.UserID, &read.Username, &read.ReadAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message read: %w", err)
+		}
+		reads = append(reads, read)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating message reads: %w", err)
+	}
+
+	return reads, nil
+}
+
+// RecordPlay inserts the first play or bumps the count of a repeat one
+func (s *PostgresStore) RecordPlay(ctx context.Context, messageID, userID uuid.UUID) (*MessagePlay, error) {
+	query := `
+		INSERT INTO message_plays (message_id, user_id, play_count, played_at, last_played_at)
+		VALUES ($1, $2, 1, $3, $3)
+		ON CONFLICT (message_id, user_id) DO UPDATE
+		SET play_count = message_plays.play_count + 1, last_played_at = EXCLUDED.last_played_at
+		RETURNING play_count, played_at, last_played_at
+	`
+
+	play := &MessagePlay{MessageID: messageID, UserID: userID}
+	err := s.pool.QueryRow(ctx, query, messageID, userID, time.Now()).Scan(
+		&play.PlayCount,
+		&play.PlayedAt,
+		&play.LastPlayedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record message play: %w", err)
+	}
+
+	return play, nil
+}
+
+// GetPlayCounts looks up the user's play counts for a page of messages
+func (s *PostgresStore) GetPlayCounts(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]int, error) {
+	query := `
+		SELECT message_id, play_count
+		FROM message_plays
+		WHERE message_id = ANY($1) AND user_id = $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, messageIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get play counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[uuid.UUID]int, len(messageIDs))
+	for rows.Next() {
+		var (
+			messageID uuid.UUID
+			count     int
+		)
+		if err := rows.Scan(&messageID, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan play count: %w", err)
+		}
+		counts[messageID] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating play counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// EnqueueDeletion queues an S3 object for removal. Queuing the same key twice is a no-op
+func (s *PostgresStore) EnqueueDeletion(ctx context.Context, s3Key, reason string, notBefore time.Time) error {
+	query := `
+		INSERT INTO pending_deletions (id, s3_key, reason, not_before, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (s3_key) DO NOTHING
+	`
+
+	_, err := s.pool.Exec(ctx, query, uuid.New(), s3Key, reason, notBefore, time.Now())
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("operation cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("failed to enqueue deletion: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueDeletions returns queued deletions whose not_before time has passed
+func (s *PostgresStore) GetDueDeletions(ctx context.Context, limit int) ([]*PendingDeletion, error) {
+	query := `
+		SELECT id, s3_key, reason, attempts, last_error, not_before, created_at
+		FROM pending_deletions
+		WHERE not_before <= $1
+		ORDER BY not_before ASC
+		LIMIT $2
+	`
+
+	rows, err := s.pool.Query(ctx, query, time.Now(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending deletions: %w", err)
+	}
+	defer rows.Close()
+
+	deletions := []*PendingDeletion{}
+	for rows.Next() {
+		d := &PendingDeletion{}
+		err := rows.Scan(
+			&d.ID,
+			&d.S3Key,
+			&d.Reason,
+			&d.Attempts,
+			&d.LastError,
+			&d.NotBefore,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pending deletion: %w", err)
+		}
+		deletions = append(deletions, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating pending deletions: %w", err)
+	}
+
+	return deletions, nil
+}
+
+// CompleteDeletion removes a processed entry from the queue
+func (s *PostgresStore) CompleteDeletion(ctx context.Context, id uuid.UUID) error {
+	query := `DELETE FROM pending_deletions WHERE id = $1`
+
+	if _, err := s.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to complete pending deletion: %w", err)
+	}
+
+	return nil
+}
+
+// RecordDeletionFailure bumps the attempt counter and reschedules the entry
+func (s *PostgresStore) RecordDeletionFailure(ctx context.Context, id uuid.UUID, errMsg string, retryAt time.Time) error {
+	query := `
+		UPDATE pending_deletions
+		SET attempts = attempts + 1, last_error = $2, not_before = $3
+		WHERE id = $1
+	`
+
+	if _, err := s.pool.Exec(ctx, query, id, errMsg, retryAt); err != nil {
+		return fmt.Errorf("failed to record deletion failure: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package voice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/websocket"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+// maxEmojiLen fits multi-codepoint emoji such as flags and skin-tone or ZWJ sequences
+const maxEmojiLen = 32
+
+// HandleAddReaction reacts to a message as the current user, reacting twice is a no-op
+func (h *Handler) HandleAddReaction(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid message ID")
+	}
+
+	req := new(AddReactionRequest)
+	if err := httputil.DecodeJSON(r, req); err != nil {
+		return err
+	}
+	if err := validateEmoji(req.Emoji); err != nil {
+		return httputil.BadRequest("Validation failed", map[string]string{
+			"emoji": err.Error(),
+		})
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	message, err := h.messageForMember(ctx, messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	added, err := h.reactionStore.AddReaction(ctx, messageID, userID, req.Emoji)
+	if err != nil {
+		log.Error("failed to add reaction",
+			"message_id", messageID,
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+		h.broadcastReaction(message, userID, req.Emoji, websocket.ReactionAdded)
+	}
+
+	return h.respondReactions(ctx, w, status, messageID, userID)
+}
+
+// HandleRemoveReaction takes back one of the current user's reactions
+func (h *Handler) HandleRemoveReaction(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid message ID")
+	}
+
+	// chi matches on the escaped path, so the emoji may still be percent-encoded
+	emoji, err := url.PathUnescape(chi.URLParam(r, "emoji"))
+	if err != nil || validateEmoji(emoji) != nil {
+		return httputil.BadRequest("Invalid emoji")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	message, err := h.messageForMember(ctx, messageID, userID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := h.reactionStore.RemoveReaction(ctx, messageID, userID, emoji)
+	if err != nil {
+		log.Error("failed to remove reaction",
+			"message_id", messageID,
+			"user_id", userID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !removed {
+		return httputil.NotFound("Reaction not found")
+	}
+
+	h.broadcastReaction(message, userID, emoji, websocket.ReactionRemoved)
+
+	return h.respondReactions(ctx, w, http.StatusOK, messageID, userID)
+}
+
+// messageForMember loads a live message and checks the user belongs to its room.
+// The returned error is ready to be returned from a handler
+func (h *Handler) messageForMember(ctx context.Context, messageID, userID uuid.UUID) (*VoiceMessage, error) {
+	log := logger.FromContext(ctx)
+	message, err := h.dbStore.GetVoiceMessageByID(ctx, messageID, false)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, httputil.NotFound("Message not found")
+		}
+		log.Error("failed to get voice message",
+			"message_id", messageID,
+			"error", err)
+		return nil, httputil.Internal(err)
+	}
+
+	isInRoom, err := h.roomStore.IsUserInRoom(ctx, message.RoomID, userID)
+	if err != nil {
+		log.Error("failed to verify room membership",
+			"user_id", userID,
+			"room_id", message.RoomID,
+			"error", err)
+		return nil, httputil.Internal(err)
+	}
+	if !isInRoom {
+		log.Warn("message access blocked - user not in room",
+			"user_id", userID,
+			"room_id", message.RoomID,
+			"message_id", messageID)
+		return nil, httputil.Forbidden("You are not a member of this room")
+	}
+
+	return message, nil
+}
+
+func (h *Handler) respondReactions(ctx context.Context, w http.ResponseWriter, status int, messageID, userID uuid.UUID) error {
+	log := logger.FromContext(ctx)
+	reactions, err := h.reactionStore.GetReactions(ctx, []uuid.UUID{messageID}, userID)
+	if err != nil {
+		log.Error("failed to get reactions",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	return httputil.RespondJSON(w, status, ReactionsResponse{
+		MessageID: messageID,
+		Reactions: reactionsOrEmpty(reactions[messageID]),
+	})
+}
+
+func (h *Handler) broadcastReaction(message *VoiceMessage, userID uuid.UUID, emoji, action string) {
+	h.wsManager.BroadcastToRoom(message.RoomID, websocket.ServerMessage{
+		Type: websocket.TypeReaction,
+		Data: websocket.ReactionData{
+			MessageID: message.ID,
+			UserID:    userID,
+			Emoji:     emoji,
+			Action:    action,
+		},
+	})
+}
+
+// reactionsOrEmpty keeps "reactions" an array in JSON for messages nobody reacted to
+func reactionsOrEmpty(reactions []ReactionSummary) []ReactionSummary {
+	if reactions == nil {
+		return []ReactionSummary{}
+	}
+	return reactions
+}
+
+// validateEmoji accepts a single short token without whitespace or control characters.
+// It doesn't check against an emoji list so new emoji work without a release
+func validateEmoji(emoji string) error {
+	if emoji == "" {
+		return errors.New("emoji is required")
+	}
+	if len(emoji) > maxEmojiLen || !utf8.ValidString(emoji) {
+		return errors.New("emoji is too long or not valid UTF-8")
+	}
+	if strings.IndexFunc(emoji, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r) || r == '/'
+	}) >= 0 {
+		return errors.New("emoji must not contain spaces or control characters")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package voice
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/websocket"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+// HandleGetReads lists who has played a message. Reads are recorded from
+// read_receipt events on the room's WebSocket
+func (h *Handler) HandleGetReads(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid message ID")
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	if _, err := h.messageForMember(ctx, messageID, userID); err != nil {
+		return err
+	}
+
+	reads, err := h.readStore.GetReads(ctx, messageID)
+	if err != nil {
+		log.Error("failed to get message reads",
+			"message_id", messageID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	return httputil.RespondJSON(w, http.StatusOK, GetReadsResponse{
+		MessageID: messageID,
+		Reads:     reads,
+		Count:     len(reads),
+	})
+}
+
+// HandleMarkRoomRead marks every message of the room read for the user, or
+// those up to the message in the optional body. Repeating it is harmless, and
+// the room only hears about it when something was actually unread
+func (h *Handler) HandleMarkRoomRead(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid room ID")
+	}
+
+	req := new(MarkRoomReadRequest)
+	if r.ContentLength != 0 {
+		if err := httputil.DecodeJSON(r, req); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	isInRoom, err := h.roomStore.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		log.Error("failed to verify room membership",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !isInRoom {
+		log.Warn("mark room read blocked - user not in room",
+			"user_id", userID,
+			"room_id", roomID)
+		return httputil.Forbidden("You are not a member of this room")
+	}
+
+	if req.UpTo != nil {
+		message, err := h.dbStore.GetVoiceMessageByID(ctx, *req.UpTo, false)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Error("failed to get voice message",
+				"message_id", *req.UpTo,
+				"error", err)
+			return httputil.Internal(err)
+		}
+		if err != nil || message.RoomID != roomID {
+			return httputil.NotFound("Message not found")
+		}
+	}
+
+	readAt, marked, err := h.readStore.MarkRoomRead(ctx, userID, roomID, req.UpTo)
+	if err != nil {
+		log.Error("failed to mark room read",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	if marked > 0 {
+		h.wsManager.BroadcastToRoom(roomID, websocket.ServerMessage{
+			Type: websocket.TypeRoomRead,
+			Data: websocket.RoomReadData{
+				RoomID: roomID,
+				UserID: userID,
+				UpTo:   req.UpTo,
+				Marked: marked,
+				ReadAt: readAt,
+			},
+		})
+	}
+
+	log.Debug("room marked read",
+		"user_id", userID,
+		"room_id", roomID,
+		"marked", marked)
+
+	return httputil.RespondJSON(w, http.StatusOK, MarkRoomReadResponse{
+		RoomID: roomID,
+		UpTo:   req.UpTo,
+		Marked: marked,
+		ReadAt: readAt,
+	})
+}
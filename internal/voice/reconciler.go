@@ -0,0 +1,188 @@
+package voice
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// messagesPrefix is where UploadVoiceMessage stores audio objects
+	messagesPrefix = "messages/"
+
+	// defaultReconcileGrace skips objects this young, their upload may still be
+	// waiting for the database insert
+	defaultReconcileGrace = time.Hour
+
+	reconcileBatchSize = 500
+)
+
+// ReconcilerOptions tunes the orphan reconciler
+type ReconcilerOptions struct {
+	// Interval between scheduled runs, zero disables the scheduled runner
+	Interval time.Duration
+	// GracePeriod skips recently uploaded objects, defaults to one hour
+	GracePeriod time.Duration
+	// DryRun only logs orphans instead of deleting them
+	DryRun bool
+	// CheckMissing also logs database rows whose object is gone
+	CheckMissing bool
+}
+
+// ReconcileReport summarises one reconciliation pass
+type ReconcileReport struct {
+	Scanned  int `json:"scanned"`
+	Orphaned int `json:"orphaned"`
+	Deleted  int `json:"deleted"`
+	Missing  int `json:"missing"`
+}
+
+// Reconciler removes S3 objects under messages/ that no voice message row references
+type Reconciler struct {
+	keys      MessageKeyStore
+	fileStore VoiceMessageStore
+	log       *slog.Logger
+	opts      ReconcilerOptions
+}
+
+func NewReconciler(
+	keys MessageKeyStore,
+	fileStore VoiceMessageStore,
+	log *slog.Logger,
+	opts ReconcilerOptions,
+) *Reconciler {
+	if opts.GracePeriod <= 0 {
+		opts.GracePeriod = defaultReconcileGrace
+	}
+	return &Reconciler{keys, fileStore, log, opts}
+}
+
+// Run reconciles on every tick until ctx is cancelled. Does nothing if no interval is set
+func (r *Reconciler) Run(ctx context.Context) {
+	if r.opts.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reconcile(ctx); err != nil {
+				r.log.Error("orphan reconciliation failed", "error", err)
+			}
+		}
+	}
+}
+
+// Reconcile compares the bucket against the database once. Objects are matched
+// by s3_key, soft-deleted rows still count as references until they're purged
+func (r *Reconciler) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	objects, err := r.fileStore.ListVoiceMessages(ctx, messagesPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{Scanned: len(objects)}
+	cutoff := time.Now().Add(-r.opts.GracePeriod)
+
+	for batch := range chunk(objects, reconcileBatchSize) {
+		keys := make([]string, 0, len(batch))
+		for _, obj := range batch {
+			if obj.LastModified.Before(cutoff) {
+				keys = append(keys, obj.Key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		existing, err := r.keys.ExistingS3Keys(ctx, keys)
+		if err != nil {
+			return report, err
+		}
+
+		for _, key := range keys {
+			if existing[key] {
+				continue
+			}
+			report.Orphaned++
+
+			if r.opts.DryRun {
+				r.log.Info("orphaned voice object found (dry run)", "s3_key", key)
+				continue
+			}
+
+			if err := r.fileStore.DeleteVoiceMessage(ctx, key); err != nil {
+				r.log.Warn("failed to delete orphaned voice object",
+					"s3_key", key,
+					"error", err)
+				continue
+			}
+			report.Deleted++
+		}
+	}
+
+	if r.opts.CheckMissing {
+		missing, err := r.findMissing(ctx, objects)
+		if err != nil {
+			return report, err
+		}
+		report.Missing = missing
+	}
+
+	r.log.Info("orphan reconciliation finished",
+		"scanned", report.Scanned,
+		"orphaned", report.Orphaned,
+		"deleted", report.Deleted,
+		"missing", report.Missing,
+		"dry_run", r.opts.DryRun)
+
+	return report, nil
+}
+
+// findMissing logs message rows whose object is not in the bucket listing
+func (r *Reconciler) findMissing(ctx context.Context, objects []ObjectInfo) (int, error) {
+	stored := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		stored[obj.Key] = true
+	}
+
+	missing := 0
+	after := ""
+	for {
+		keys, err := r.keys.ListS3Keys(ctx, after, reconcileBatchSize)
+		if err != nil {
+			return missing, err
+		}
+
+		for _, k := range keys {
+			if !stored[k.S3Key] {
+				missing++
+				r.log.Warn("voice message object is missing",
+					"message_id", k.ID,
+					"s3_key", k.S3Key)
+			}
+		}
+
+		if len(keys) < reconcileBatchSize {
+			return missing, nil
+		}
+		after = keys[len(keys)-1].S3Key
+	}
+}
+
+// chunk yields consecutive sub-slices of at most size elements
+func chunk[T any](items []T, size int) func(yield func([]T) bool) {
+	return func(yield func([]T) bool) {
+		for start := 0; start < len(items); start += size {
+			end := min(start+size, len(items))
+			if !yield(items[start:end]) {
+				return
+			}
+		}
+	}
+}
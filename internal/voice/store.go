@@ -2,25 +2,108 @@ package voice
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// ErrNotFound means the voice message doesn't exist
+var ErrNotFound = errors.New("voice message not found")
+
 // VoiceMessageStore handles S3 operations for voice files
 type VoiceMessageStore interface {
 	UploadVoiceMessage(ctx context.Context, messageID uuid.UUID, reader io.Reader, size int64, audioFormat string) (string, error)
 	DownloadVoiceMessage(ctx context.Context, objectName string) ([]byte, error)
+	// OpenVoiceMessage returns a seekable stream of the object, the caller must close it
+	OpenVoiceMessage(ctx context.Context, objectName string) (io.ReadSeekCloser, *ObjectInfo, error)
 	DeleteVoiceMessage(ctx context.Context, objectName string) error
-	GetPresignedURL(ctx context.Context, objectName string, expiry time.Duration) (string, error)
+	// ListVoiceMessages lists every object under prefix
+	ListVoiceMessages(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// GetPresignedURL signs a playback URL. With download set the response asks the
+	// browser to save the file instead of playing it inline
+	GetPresignedURL(ctx context.Context, objectName string, expiry time.Duration, download bool) (string, error)
+	// GetPresignedURLs signs many keys at once. Both slices match objectNames by index,
+	// errs[i] is nil when urls[i] was generated
+	GetPresignedURLs(ctx context.Context, objectNames []string, expiry time.Duration, download bool) (urls []string, errs []error)
 }
 
 // VoiceMessageDBStore handles database operations for voice message metadata
 type VoiceMessageDBStore interface {
 	CreateVoiceMessage(ctx context.Context, message *VoiceMessage) error
-	GetVoiceMessageByID(ctx context.Context, messageID uuid.UUID) (*VoiceMessage, error)
-	GetRoomMessages(ctx context.Context, roomID uuid.UUID, limit, offset int) ([]*VoiceMessage, error)
+	// GetVoiceMessageByID and GetRoomMessages skip soft-deleted messages unless includeDeleted is set
+	GetVoiceMessageByID(ctx context.Context, messageID uuid.UUID, includeDeleted bool) (*VoiceMessage, error)
+	GetRoomMessages(ctx context.Context, roomID uuid.UUID, limit, offset int, includeDeleted bool) ([]*VoiceMessage, error)
+	// DeleteVoiceMessage soft-deletes a message, the row stays as a tombstone until purged
 	DeleteVoiceMessage(ctx context.Context, messageID uuid.UUID) error
+	PurgeVoiceMessage(ctx context.Context, messageID uuid.UUID) error
 	GetMessagesBySender(ctx context.Context, senderID uuid.UUID, limit, offset int) ([]*VoiceMessage, error)
+	// DeleteMessagesBySender deletes every message of the sender, tombstones included,
+	// and queues their audio for deletion in the same transaction
+	DeleteMessagesBySender(ctx context.Context, senderID uuid.UUID, reason string) (int, error)
+	// AnonymizeMessagesBySender keeps the sender's messages but clears their sender
+	AnonymizeMessagesBySender(ctx context.Context, senderID uuid.UUID) (int, error)
+}
+
+// ReactionStore keeps users' emoji reactions to voice messages
+type ReactionStore interface {
+	// AddReaction returns false if the user had already reacted with that emoji
+	AddReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error)
+	// RemoveReaction returns false if there was no such reaction
+	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) (bool, error)
+	// GetReactions summarizes reactions per message, most used first.
+	// Reacted is set for the emoji viewerID used
+	GetReactions(ctx context.Context, messageIDs []uuid.UUID, viewerID uuid.UUID) (map[uuid.UUID][]ReactionSummary, error)
+}
+
+// ReadStore tracks which users have played which messages
+type ReadStore interface {
+	// MarkRead records the first read of a live message of roomID by someone other
+	// than its sender. recorded is false when nothing was stored
+	MarkRead(ctx context.Context, userID, roomID, messageID uuid.UUID) (readAt time.Time, recorded bool, err error)
+	// MarkRoomRead records reads of every live message of roomID sent by others, up to
+	// and including upTo when set. Messages already read are skipped, marked counts the new reads
+	MarkRoomRead(ctx context.Context, userID, roomID uuid.UUID, upTo *uuid.UUID) (readAt time.Time, marked int, err error)
+	// GetReads lists who has read a message, earliest first
+	GetReads(ctx context.Context, messageID uuid.UUID) ([]MessageRead, error)
+}
+
+// PlayStore counts how often users play messages
+type PlayStore interface {
+	// RecordPlay adds one play by userID and returns the totals
+	RecordPlay(ctx context.Context, messageID, userID uuid.UUID) (*MessagePlay, error)
+	// GetPlayCounts returns userID's play count per message, messages never played are left out
+	GetPlayCounts(ctx context.Context, messageIDs []uuid.UUID, userID uuid.UUID) (map[uuid.UUID]int, error)
+}
+
+// TranscriptStore keeps speech-to-text transcripts and searches them
+type TranscriptStore interface {
+	// SetTranscript stores the transcript and marks the message's enrichment done
+	SetTranscript(ctx context.Context, messageID uuid.UUID, transcript string) error
+	// MarkEnrichmentFailed flags the message failed and counts the attempt,
+	// it's retried from retryAt on or never when retryAt is nil
+	MarkEnrichmentFailed(ctx context.Context, messageID uuid.UUID, retryAt *time.Time) error
+	// GetFailedEnrichments lists failed messages that are due for a retry
+	GetFailedEnrichments(ctx context.Context, limit int) ([]*EnrichmentJob, error)
+	// SearchRoomMessages full-text searches the transcripts of a room's live messages, best match first
+	SearchRoomMessages(ctx context.Context, roomID uuid.UUID, query string, limit, offset int) ([]*VoiceMessage, error)
+}
+
+// PendingDeletionStore queues S3 objects whose removal failed or was deferred,
+// so the sweeper can delete them later instead of leaving orphans behind
+type PendingDeletionStore interface {
+	EnqueueDeletion(ctx context.Context, s3Key, reason string, notBefore time.Time) error
+	GetDueDeletions(ctx context.Context, limit int) ([]*PendingDeletion, error)
+	CompleteDeletion(ctx context.Context, id uuid.UUID) error
+	RecordDeletionFailure(ctx context.Context, id uuid.UUID, errMsg string, retryAt time.Time) error
+}
+
+// MessageKeyStore looks up which S3 keys are referenced by voice messages,
+// used by the reconciler to find orphaned objects
+type MessageKeyStore interface {
+	// ExistingS3Keys reports which of the keys belong to a voice message row
+	ExistingS3Keys(ctx context.Context, keys []string) (map[string]bool, error)
+	// ListS3Keys pages through all message keys in s3_key order, starting after the given key
+	ListS3Keys(ctx context.Context, after string, limit int) ([]MessageKey, error)
 }
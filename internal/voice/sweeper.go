@@ -0,0 +1,100 @@
+package voice
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	defaultSweepInterval = time.Minute
+	sweepBatchSize       = 100
+	maxSweepBackoff      = time.Hour
+)
+
+// Deletion reasons recorded in the pending_deletions queue
+const (
+	DeletionReasonUploadRollback = "upload_rollback"
+	DeletionReasonMessageDeleted = "message_deleted"
+	DeletionReasonAccountDeleted = "account_deleted"
+)
+
+// Sweeper periodically removes S3 objects queued in pending_deletions
+type Sweeper struct {
+	pending   PendingDeletionStore
+	fileStore VoiceMessageStore
+	log       *slog.Logger
+	interval  time.Duration
+}
+
+func NewSweeper(
+	pending PendingDeletionStore,
+	fileStore VoiceMessageStore,
+	log *slog.Logger,
+	interval time.Duration,
+) *Sweeper {
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	return &Sweeper{pending, fileStore, log, interval}
+}
+
+// Run sweeps on every tick until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				s.log.Error("pending deletion sweep failed", "error", err)
+			}
+		}
+	}
+}
+
+// Sweep processes one batch of due deletions and returns how many objects were removed
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	deletions, err := s.pending.GetDueDeletions(ctx, sweepBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, d := range deletions {
+		if err := s.fileStore.DeleteVoiceMessage(ctx, d.S3Key); err != nil {
+			// Back off linearly per attempt so a broken key doesn't spin the sweeper
+			backoff := min(time.Duration(d.Attempts+1)*time.Minute, maxSweepBackoff)
+
+			s.log.Warn("pending deletion failed, rescheduling",
+				"s3_key", d.S3Key,
+				"attempts", d.Attempts+1,
+				"retry_in", backoff,
+				"error", err)
+
+			if recErr := s.pending.RecordDeletionFailure(ctx, d.ID, err.Error(), time.Now().Add(backoff)); recErr != nil {
+				s.log.Error("failed to reschedule pending deletion",
+					"s3_key", d.S3Key,
+					"error", recErr)
+			}
+			continue
+		}
+
+		if err := s.pending.CompleteDeletion(ctx, d.ID); err != nil {
+			s.log.Error("failed to complete pending deletion",
+				"s3_key", d.S3Key,
+				"error", err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		s.log.Info("pending deletions swept", "count", removed)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,128 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/rx3lixir/laba_zis/pkg/breaker"
+)
+
+// TranscodedFormat is the audio format uploads are normalized to
+const TranscodedFormat = "ogg"
+
+// Transcoder normalizes uploaded audio to Ogg/Opus
+type Transcoder interface {
+	// ToOpus converts size bytes of in, stored as format, into a temp file
+	ToOpus(ctx context.Context, in io.ReaderAt, size int64, format string) (*TranscodedAudio, error)
+}
+
+// TranscodedAudio is a converted file on disk, Close removes it
+type TranscodedAudio struct {
+	File *os.File
+	Size int64
+}
+
+func (t *TranscodedAudio) Close() error {
+	t.File.Close()
+	return os.Remove(t.File.Name())
+}
+
+// FFmpegTranscoder shells out to ffmpeg. A breaker stops calling it after
+// repeated failures so a broken install doesn't slow down every upload
+type FFmpegTranscoder struct {
+	path    string
+	timeout time.Duration
+	breaker *breaker.Breaker
+}
+
+var _ Transcoder = (*FFmpegTranscoder)(nil)
+
+// NewFFmpegTranscoder fails if the ffmpeg binary can't be found
+func NewFFmpegTranscoder(path string, timeout time.Duration) (*FFmpegTranscoder, error) {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not available: %w", err)
+	}
+
+	return &FFmpegTranscoder{
+		path:    resolved,
+		timeout: timeout,
+		breaker: breaker.New(5, time.Minute),
+	}, nil
+}
+
+func (t *FFmpegTranscoder) ToOpus(ctx context.Context, in io.ReaderAt, size int64, format string) (*TranscodedAudio, error) {
+	var out *TranscodedAudio
+
+	err := t.breaker.Do(func() error {
+		var err error
+		out, err = t.run(ctx, in, size, format)
+		return err
+	})
+	if errors.Is(err, breaker.ErrOpen) {
+		return nil, fmt.Errorf("transcoder disabled after repeated failures: %w", err)
+	}
+
+	return out, err
+}
+
+func (t *FFmpegTranscoder) run(ctx context.Context, in io.ReaderAt, size int64, format string) (*TranscodedAudio, error) {
+	// Inputs go through a file, MP4 needs a seekable input when its index is at the end
+	src, err := os.CreateTemp("", "voice-src-*."+format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcode input: %w", err)
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+
+	if _, err := io.Copy(src, io.NewSectionReader(in, 0, size)); err != nil {
+		return nil, fmt.Errorf("failed to write transcode input: %w", err)
+	}
+
+	dst, err := os.CreateTemp("", "voice-*.ogg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transcode output: %w", err)
+	}
+	out := &TranscodedAudio{File: dst}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, t.path,
+		"-hide_banner", "-loglevel", "error", "-nostdin", "-y",
+		"-i", src.Name(),
+		"-vn", "-map_metadata", "-1",
+		"-c:a", "libopus", "-b:a", "32k",
+		"-f", "ogg", dst.Name(),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		out.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ffmpeg timed out after %s", t.timeout)
+		}
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	stat, err := dst.Stat()
+	if err != nil {
+		out.Close()
+		return nil, fmt.Errorf("failed to stat transcoded file: %w", err)
+	}
+	if stat.Size() == 0 {
+		out.Close()
+		return nil, fmt.Errorf("ffmpeg produced an empty file")
+	}
+	out.Size = stat.Size()
+
+	return out, nil
+}
@@ -0,0 +1,100 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rx3lixir/laba_zis/pkg/breaker"
+)
+
+// Transcriber turns a voice message into text
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio io.Reader, contentType string) (string, error)
+}
+
+// NopTranscriber is used when no speech-to-text service is configured,
+// messages are stored without a transcript
+type NopTranscriber struct{}
+
+func (NopTranscriber) Transcribe(ctx context.Context, audio io.Reader, contentType string) (string, error) {
+	return "", nil
+}
+
+// HTTPTranscriber posts the raw audio to an external STT service which
+// answers with {"text": "..."}. A breaker stops calling it during an outage
+type HTTPTranscriber struct {
+	url     string
+	apiKey  string
+	client  *http.Client
+	breaker *breaker.Breaker
+}
+
+var (
+	_ Transcriber = NopTranscriber{}
+	_ Transcriber = (*HTTPTranscriber)(nil)
+)
+
+// NewHTTPTranscriber sends requests to url, with apiKey as a bearer token when set
+func NewHTTPTranscriber(url, apiKey string, timeout time.Duration) *HTTPTranscriber {
+	return &HTTPTranscriber{
+		url:     url,
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: timeout},
+		breaker: breaker.New(5, time.Minute),
+	}
+}
+
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+func (t *HTTPTranscriber) Transcribe(ctx context.Context, audio io.Reader, contentType string) (string, error) {
+	var text string
+
+	err := t.breaker.Do(func() error {
+		var err error
+		text, err = t.post(ctx, audio, contentType)
+		return err
+	})
+	if errors.Is(err, breaker.ErrOpen) {
+		return "", fmt.Errorf("transcription service unavailable: %w", err)
+	}
+
+	return text, err
+}
+
+func (t *HTTPTranscriber) post(ctx context.Context, audio io.Reader, contentType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, audio)
+	if err != nil {
+		return "", fmt.Errorf("failed to build transcription request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if t.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("transcription service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result transcriptionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode transcription response: %w", err)
+	}
+
+	return strings.TrimSpace(result.Text), nil
+}
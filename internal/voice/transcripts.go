@@ -0,0 +1,258 @@
+package voice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/internal/auth"
+	"github.com/rx3lixir/laba_zis/internal/websocket"
+	"github.com/rx3lixir/laba_zis/pkg/audio"
+	"github.com/rx3lixir/laba_zis/pkg/breaker"
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
+)
+
+const (
+	// maxSearchQueryLength caps q, in characters
+	maxSearchQueryLength = 200
+
+	// Failed transcriptions are retried with a linear backoff until
+	// maxEnrichmentAttempts, then the message stays failed
+	maxEnrichmentAttempts          = 5
+	maxEnrichmentBackoff           = time.Hour
+	defaultEnrichmentRetryInterval = time.Minute
+	enrichmentRetryBatchSize       = 20
+)
+
+// transcribes reports whether a speech-to-text service is configured
+func (h *Handler) transcribes() bool {
+	_, nop := h.cfg.Transcriber.(NopTranscriber)
+	return !nop
+}
+
+// transcribeMessage runs after the upload response has been sent
+func (h *Handler) transcribeMessage(job *EnrichmentJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), transcribeTimeout)
+	defer cancel()
+
+	h.enrich(ctx, job)
+}
+
+// enrich reads the audio back from S3, stores the transcript and tells the room
+// it's ready. On failure the message is marked failed for RunEnrichmentRetries
+func (h *Handler) enrich(ctx context.Context, job *EnrichmentJob) error {
+	body, _, err := h.fileStore.OpenVoiceMessage(ctx, job.S3Key)
+	if err != nil {
+		h.log.Warn("failed to open audio for transcription",
+			"message_id", job.MessageID,
+			"s3_key", job.S3Key,
+			"error", err)
+		h.markEnrichmentFailed(job)
+		return err
+	}
+	defer body.Close()
+
+	contentType := audio.ContentType(strings.TrimPrefix(path.Ext(job.S3Key), "."))
+	if job.ContentType != nil {
+		contentType = *job.ContentType
+	}
+
+	transcript, err := h.cfg.Transcriber.Transcribe(ctx, body, contentType)
+	if err != nil {
+		h.log.Warn("failed to transcribe voice message",
+			"message_id", job.MessageID,
+			"error", err)
+		h.markEnrichmentFailed(job)
+		return err
+	}
+
+	// An empty transcript is stored too, it marks the message done
+	if err := h.transcriptStore.SetTranscript(ctx, job.MessageID, transcript); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			h.log.Debug("message purged before its transcript was stored",
+				"message_id", job.MessageID)
+			return nil
+		}
+		h.log.Error("failed to store transcript",
+			"message_id", job.MessageID,
+			"error", err)
+		h.markEnrichmentFailed(job)
+		return err
+	}
+
+	if transcript == "" {
+		h.log.Debug("transcription returned no text", "message_id", job.MessageID)
+		return nil
+	}
+
+	h.wsManager.BroadcastToRoom(job.RoomID, websocket.ServerMessage{
+		Type: websocket.TypeTranscriptReady,
+		Data: websocket.TranscriptReadyData{
+			MessageID:  job.MessageID,
+			Transcript: transcript,
+		},
+	})
+
+	h.log.Debug("voice message transcribed",
+		"message_id", job.MessageID,
+		"length", utf8.RuneCountInString(transcript))
+
+	return nil
+}
+
+// markEnrichmentFailed schedules the next attempt, backing off linearly per
+// attempt. It gets a context of its own since a timed out transcription
+// leaves the caller's expired
+func (h *Handler) markEnrichmentFailed(job *EnrichmentJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.dbTimeout)
+	defer cancel()
+
+	attempts := job.Attempts + 1
+	var retryAt *time.Time
+	if attempts < maxEnrichmentAttempts {
+		next := time.Now().Add(min(time.Duration(attempts)*time.Minute, maxEnrichmentBackoff))
+		retryAt = &next
+	}
+
+	if err := h.transcriptStore.MarkEnrichmentFailed(ctx, job.MessageID, retryAt); err != nil && !errors.Is(err, ErrNotFound) {
+		h.log.Error("failed to mark enrichment failed",
+			"message_id", job.MessageID,
+			"attempts", attempts,
+			"error", err)
+	}
+}
+
+// RunEnrichmentRetries retries failed transcriptions on every tick until ctx is
+// cancelled. It returns at once when transcription is off
+func (h *Handler) RunEnrichmentRetries(ctx context.Context, interval time.Duration) {
+	if !h.transcribes() {
+		return
+	}
+	if interval <= 0 {
+		interval = defaultEnrichmentRetryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := h.RetryEnrichments(ctx); err != nil {
+				h.log.Error("enrichment retry failed", "error", err)
+			}
+		}
+	}
+}
+
+// RetryEnrichments transcribes one batch of failed messages that are due and
+// returns how many succeeded. The batch stops early while the service's breaker is open
+func (h *Handler) RetryEnrichments(ctx context.Context) (int, error) {
+	jobs, err := h.transcriptStore.GetFailedEnrichments(ctx, enrichmentRetryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, job := range jobs {
+		jobCtx, cancel := context.WithTimeout(ctx, transcribeTimeout)
+		err := h.enrich(jobCtx, job)
+		cancel()
+
+		if errors.Is(err, breaker.ErrOpen) {
+			break
+		}
+		if err == nil {
+			done++
+		}
+	}
+
+	if done > 0 {
+		h.log.Info("failed enrichments retried", "count", done)
+	}
+
+	return done, nil
+}
+
+// HandleSearchRoomMessages finds messages of a room whose transcript matches q,
+// best matches first. limit defaults to 50 and is capped at httputil.MaxPageLimit
+func (h *Handler) HandleSearchRoomMessages(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	userID := auth.GetUserID(r.Context())
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		return httputil.BadRequest("Invalid room ID")
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		return httputil.BadRequest("Search query q is required")
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return httputil.BadRequest("Search query is too long",
+			map[string]int{"max_length": maxSearchQueryLength})
+	}
+
+	page, err := httputil.ParsePagination(r, defaultLimit)
+	if err != nil {
+		return err
+	}
+	limit, offset := page.Limit, page.Offset
+
+	download, err := wantsDownload(r)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := h.dbCtx(r)
+	defer cancel()
+
+	isInRoom, err := h.roomStore.IsUserInRoom(ctx, roomID, userID)
+	if err != nil {
+		log.Error("failed to verify room membership",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+	if !isInRoom {
+		log.Warn("message search blocked - user not in room",
+			"user_id", userID,
+			"room_id", roomID)
+		return httputil.Forbidden("You are not a member of this room")
+	}
+
+	messages, err := h.transcriptStore.SearchRoomMessages(ctx, roomID, query, limit, offset)
+	if err != nil {
+		log.Error("failed to search room messages",
+			"room_id", roomID,
+			"error", err)
+		return httputil.Internal(err)
+	}
+
+	results, err := h.withURLs(ctx, messages, userID, download)
+	if err != nil {
+		return err
+	}
+
+	log.Debug("room messages searched",
+		"room_id", roomID,
+		"count", len(results))
+
+	return httputil.RespondJSON(w, http.StatusOK, SearchMessagesResponse{
+		Query:    query,
+		Messages: results,
+		Count:    len(results),
+		Limit:    limit,
+		Offset:   offset,
+	})
+}
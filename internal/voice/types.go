@@ -8,12 +8,33 @@ import (
 
 // VoiceMessage represents a voice message record in the database
 type VoiceMessage struct {
-	ID              uuid.UUID `json:"id"`
-	RoomID          uuid.UUID `json:"room_id"`
-	SenderID        uuid.UUID `json:"sender_id"`
-	S3Key           string    `json:"s3_key"`
-	DurationSeconds int       `json:"duration_seconds"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID               uuid.UUID  `json:"id"`
+	RoomID           uuid.UUID  `json:"room_id"`
+	SenderID         uuid.UUID  `json:"sender_id"` // uuid.Nil once the sender's account was deleted with anonymize
+	S3Key            string     `json:"s3_key"`
+	DurationSeconds  int        `json:"duration_seconds"`
+	SizeBytes        *int64     `json:"size_bytes,omitempty"`        // NULL for messages uploaded before it was tracked
+	ContentType      *string    `json:"content_type,omitempty"`      // NULL for messages uploaded before it was tracked
+	Transcript       *string    `json:"transcript,omitempty"`        // NULL until transcribed, or when transcription is off
+	EnrichmentStatus *string    `json:"enrichment_status,omitempty"` // Transcription progress, NULL when transcription is off
+	CreatedAt        time.Time  `json:"created_at"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Enrichment statuses of a message. Failed messages are retried by RunEnrichmentRetries
+const (
+	EnrichmentPending = "pending"
+	EnrichmentDone    = "done"
+	EnrichmentFailed  = "failed"
+)
+
+// EnrichmentJob is a message waiting for transcription, Attempts counts earlier failures
+type EnrichmentJob struct {
+	MessageID   uuid.UUID
+	RoomID      uuid.UUID
+	S3Key       string
+	ContentType *string
+	Attempts    int
 }
 
 // UploadVoiceMessageRequest is the metadata for uploading a voice message
@@ -27,16 +48,119 @@ type UploadVoiceMessageRequest struct {
 type UploadVoiceMessageResponse struct {
 	Message VoiceMessage `json:"message"`
 	URL     string       `json:"url"` // Presigned URL for playback
+	// URLExpiresAt is when URL stops working, null when there is no URL
+	URLExpiresAt *time.Time `json:"url_expires_at"`
 }
 
 // GetRoomMessagesResponse returns voice messages for a room
 type GetRoomMessagesResponse struct {
 	Messages []VoiceMessageWithURL `json:"messages"`
 	Count    int                   `json:"count"`
+	Limit    int                   `json:"limit"`
+	Offset   int                   `json:"offset"`
+}
+
+// GetMyMessagesResponse returns the user's own messages across all rooms
+type GetMyMessagesResponse struct {
+	Messages []VoiceMessageWithURL `json:"messages"`
+	Count    int                   `json:"count"`
+	Limit    int                   `json:"limit"`
+	Offset   int                   `json:"offset"`
+}
+
+// SearchMessagesResponse returns the messages whose transcript matched the query
+type SearchMessagesResponse struct {
+	Query    string                `json:"query"`
+	Messages []VoiceMessageWithURL `json:"messages"`
+	Count    int                   `json:"count"`
+	Limit    int                   `json:"limit"`
+	Offset   int                   `json:"offset"`
 }
 
 // VoiceMessageWithURL includes the message and a presigned URL
 type VoiceMessageWithURL struct {
 	VoiceMessage
 	URL string `json:"url"`
+	// URLExpiresAt is when URL stops working, null when there is no URL
+	URLExpiresAt *time.Time        `json:"url_expires_at"`
+	Reactions    []ReactionSummary `json:"reactions"`
+	Played       bool              `json:"played"`     // Whether the requesting user has played it
+	PlayCount    int               `json:"play_count"` // How often the requesting user has played it
+}
+
+// MessageRead is one user who has played a message
+type MessageRead struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	ReadAt   time.Time `json:"read_at"`
+}
+
+type GetReadsResponse struct {
+	MessageID uuid.UUID     `json:"message_id"`
+	Reads     []MessageRead `json:"reads"`
+	Count     int           `json:"count"`
+}
+
+// MarkRoomReadRequest is optional, without it every message is marked read
+type MarkRoomReadRequest struct {
+	UpTo *uuid.UUID `json:"up_to,omitempty"` // Last message to mark, later ones stay unread
+}
+
+type MarkRoomReadResponse struct {
+	RoomID uuid.UUID  `json:"room_id"`
+	UpTo   *uuid.UUID `json:"up_to,omitempty"`
+	Marked int        `json:"marked"` // Messages newly marked read, 0 when nothing was unread
+	ReadAt time.Time  `json:"read_at"`
+}
+
+// MessagePlay is how often a user has played a message
+type MessagePlay struct {
+	MessageID    uuid.UUID `json:"message_id"`
+	UserID       uuid.UUID `json:"user_id"`
+	PlayCount    int       `json:"play_count"`
+	PlayedAt     time.Time `json:"played_at"` // First play
+	LastPlayedAt time.Time `json:"last_played_at"`
+}
+
+// ReactionSummary counts one emoji on a message
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"` // Whether the requesting user is one of them
+}
+
+type AddReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// ReactionsResponse is a message's reactions after a change
+type ReactionsResponse struct {
+	MessageID uuid.UUID         `json:"message_id"`
+	Reactions []ReactionSummary `json:"reactions"`
+}
+
+// PendingDeletion is an S3 object queued for removal by the sweeper
+type PendingDeletion struct {
+	ID        uuid.UUID `json:"id"`
+	S3Key     string    `json:"s3_key"`
+	Reason    string    `json:"reason"`
+	Attempts  int       `json:"attempts"`
+	LastError *string   `json:"last_error,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ObjectInfo describes a stored audio object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// MessageKey pairs a voice message with its S3 object
+type MessageKey struct {
+	ID    uuid.UUID
+	S3Key string
 }
@@ -2,8 +2,13 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -11,29 +16,77 @@ import (
 
 const (
 	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
+	pingPeriod     = 25 * time.Second
 	maxMessageSize = 8192 // 8KB for JSON messages
+
+	// A client that leaves this many pings in a row unanswered is disconnected
+	// by the write pump, maxMissedPongs+1 periods after its last pong at most.
+	// The read deadline is a backstop a little past that
+	maxMissedPongs = 2
+	pongWait       = pingPeriod*(maxMissedPongs+1) + writeWait
+
+	// typingInterval coalesces typing events to at most one per interval per client
+	typingInterval = time.Second
+
+	// Text notes are limited in size and rate per client
+	maxTextLength = 1000 // Runes
+	textInterval  = 250 * time.Millisecond
 )
 
 type Client struct {
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
-	userID uuid.UUID
-	log    *slog.Logger
+	hub      *Hub
+	conn     *websocket.Conn
+	send     chan []byte
+	userID   uuid.UUID
+	username string
+	log      *slog.Logger
+
+	// Only accessed by the read goroutine
+	lastTyping time.Time
+	lastText   time.Time
+
+	// Guards send so it's closed once, and never written to by SendMessage
+	// after that. The hub writes to send directly, it's the only closer
+	sendMu sync.Mutex
+	closed bool
+
+	// Ping bookkeeping in unix nanoseconds, written by the write pump and the pong handler
+	lastPing    atomic.Int64
+	lastPong    atomic.Int64
+	missedPongs atomic.Int32
+
+	// closeCode goes in the close frame once send is closed, zero means normal
+	// closure. Set by the hub goroutine before closeSend
+	closeCode int
+
+	// onClose runs once the connection is gone (releases the user's connection slot)
+	onClose func()
+
+	// onReadReceipt records a read receipt, nil when receipts aren't persisted
+	onReadReceipt func(messageID uuid.UUID)
+
+	// onRoomFocus marks the room read when the client focuses it, nil when
+	// reads aren't persisted
+	onRoomFocus func()
+
+	// broadcast sends client events to the whole room, across instances when
+	// the manager has a broker. Nil falls back to the local hub
+	broadcast func(ServerMessage)
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, log *slog.Logger) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, username string, log *slog.Logger) *Client {
 	return &Client{
-		hub:    hub,
-		conn:   conn,
-		send:   make(chan []byte, 256),
-		userID: userID,
-		log:    log,
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, 256),
+		userID:   userID,
+		username: username,
+		log:      log,
 	}
 }
 
+// SendMessage queues a message for this client only, safe from any goroutine.
+// Messages to a closed client are dropped
 func (c *Client) SendMessage(msg ServerMessage) {
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -41,6 +94,12 @@ func (c *Client) SendMessage(msg ServerMessage) {
 		return
 	}
 
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.closed {
+		return
+	}
+
 	select {
 	case c.send <- data:
 	default:
@@ -48,17 +107,38 @@ func (c *Client) SendMessage(msg ServerMessage) {
 	}
 }
 
+// closeSend signals the write pump to stop, safe to call more than once
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
 // readPump pumps messages from WebSocket to hub
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.tryUnregister(c)
 		c.conn.Close()
+
+		if c.onClose != nil {
+			c.onClose()
+		}
 	}()
 
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(appData string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		now := time.Now()
+		c.conn.SetReadDeadline(now.Add(pongWait))
+
+		if sent := c.lastPing.Load(); sent > 0 {
+			c.hub.recordPong(now.Sub(time.Unix(0, sent)))
+		}
+		c.lastPong.Store(now.UnixNano())
+		c.missedPongs.Store(0)
 		return nil
 	})
 
@@ -97,7 +177,11 @@ func (c *Client) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// Hub closed the channel
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				code := c.closeCode
+				if code == 0 {
+					code = websocket.CloseNormalClosure
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""))
 				return
 			}
 
@@ -107,7 +191,9 @@ func (c *Client) writePump() {
 			}
 			w.Write(message)
 
-			// Add queued messages to current websocket frame (optimization)
+			// Add queued messages to current websocket frame (optimization).
+			// With permessage-deflate the batch is compressed as one message
+			// when the writer closes, so batching compresses better too
 			n := len(c.send)
 			for i := 0; i < n; i++ {
 				w.Write([]byte{'\n'})
@@ -119,29 +205,172 @@ func (c *Client) writePump() {
 			}
 
 		case <-ticker.C:
+			if c.awaitingPong() && c.missedPongs.Add(1) >= maxMissedPongs {
+				c.log.Warn("client stopped answering pings, disconnecting",
+					"user_id", c.userID,
+					"room_id", c.hub.roomID,
+					"last_pong", c.LastPong())
+				c.hub.recordPingTimeout()
+				// Closing the socket fails the read pump, which unregisters the client
+				return
+			}
+
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			c.lastPing.Store(time.Now().UnixNano())
 		}
 	}
 }
 
+// awaitingPong reports whether the last ping hasn't been answered yet
+func (c *Client) awaitingPong() bool {
+	sent := c.lastPing.Load()
+	return sent > 0 && c.lastPong.Load() < sent
+}
+
+// LastPong is when the client last answered a ping, zero if it never has
+func (c *Client) LastPong() time.Time {
+	if pong := c.lastPong.Load(); pong > 0 {
+		return time.Unix(0, pong)
+	}
+	return time.Time{}
+}
+
 func (c *Client) handleClientMessage(msg ClientMessage) {
 	switch msg.Type {
 	case TypePing:
 		c.SendMessage(ServerMessage{Type: TypePong})
 
 	case TypeTyping:
-		// Could broadcast typing indicators
-		c.log.Debug("user typing", "user_id", c.userID)
+		c.handleTyping(msg.Data)
+
+	case TypeActiveRoom:
+		var data ActiveRoomData
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			c.sendError("invalid active_room payload")
+			return
+		}
+		focused := data.RoomID != nil && *data.RoomID == c.hub.roomID
+		c.hub.setFocus(c, focused)
+
+		// A user looking at the room has seen what's in it
+		if focused && c.onRoomFocus != nil {
+			c.onRoomFocus()
+		}
 
 	case TypeReadReceipt:
-		// Handle read receipts
-		c.log.Debug("read receipt", "user_id", c.userID)
+		c.handleReadReceipt(msg.Data)
+
+	case TypeTextMessage:
+		c.handleTextMessage(msg.Data)
+
+	case TypeRecording:
+		c.handleRecording(msg.Data)
 
 	default:
 		c.log.Warn("unknown message type", "type", msg.Type, "user_id", c.userID)
+		c.sendError("unknown message type")
+	}
+}
+
+// handleTyping rebroadcasts a typing event to everyone else in the room
+func (c *Client) handleTyping(raw json.RawMessage) {
+	var data TypingData
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			c.sendError("invalid typing payload")
+			return
+		}
+	}
+
+	roomID := c.hub.roomID
+	if data.RoomID != nil && *data.RoomID != roomID {
+		c.sendError("typing room_id does not match connection")
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(c.lastTyping) < typingInterval {
+		return
+	}
+	c.lastTyping = now
+
+	c.toRoom(ServerMessage{
+		Type:    TypeTyping,
+		Data:    TypingData{RoomID: &roomID, UserID: c.userID},
+		exclude: c,
+	})
+}
+
+// handleTextMessage validates a text note and forwards it to the rest of the room
+func (c *Client) handleTextMessage(raw json.RawMessage) {
+	var data TextMessageData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		c.sendError("invalid text_message payload")
+		return
+	}
+
+	text := strings.TrimSpace(data.Text)
+	if text == "" {
+		c.sendError("text_message text is required")
+		return
+	}
+	if utf8.RuneCountInString(text) > maxTextLength {
+		c.sendError(fmt.Sprintf("text_message is longer than %d characters", maxTextLength))
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(c.lastText) < textInterval {
+		c.sendError("sending text messages too fast")
+		return
+	}
+	c.lastText = now
+
+	c.toRoom(ServerMessage{
+		Type:    TypeTextMessage,
+		Data:    TextMessageData{Text: text, UserID: c.userID, Username: c.username},
+		exclude: c,
+	})
+}
+
+// handleRecording forwards a recording started/stopped notice to the rest of the room
+func (c *Client) handleRecording(raw json.RawMessage) {
+	var data RecordingData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		c.sendError("invalid recording payload")
+		return
+	}
+
+	c.toRoom(ServerMessage{
+		Type:    TypeRecording,
+		Data:    RecordingData{Active: data.Active, UserID: c.userID},
+		exclude: c,
+	})
+}
+
+// toRoom broadcasts an event raised by this client
+func (c *Client) toRoom(msg ServerMessage) {
+	if c.broadcast != nil {
+		c.broadcast(msg)
+		return
+	}
+	c.hub.Send(msg)
+}
+
+// handleReadReceipt runs on the read goroutine, so a client sending receipts
+// faster than they can be stored is slowed down instead of piling up work
+func (c *Client) handleReadReceipt(raw json.RawMessage) {
+	var data ReadReceiptData
+	if err := json.Unmarshal(raw, &data); err != nil || data.MessageID == uuid.Nil {
+		c.sendError("invalid read_receipt payload")
+		return
+	}
+
+	if c.onReadReceipt != nil {
+		c.onReadReceipt(data.MessageID)
 	}
 }
 
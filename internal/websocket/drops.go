@@ -0,0 +1,207 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultDropAlertWindow = time.Minute
+
+// DropAlert describes a drop rate that crossed the configured threshold.
+// RoomID is uuid.Nil for the instance-wide rate
+type DropAlert struct {
+	RoomID        uuid.UUID `json:"room_id"`
+	Rate          float64   `json:"rate"`      // Dropped messages per second
+	Threshold     float64   `json:"threshold"` // Configured messages per second
+	WindowSeconds int       `json:"window_seconds"`
+	At            time.Time `json:"at"`
+}
+
+// DropAlertFunc is invoked (in its own goroutine) when a drop alert fires
+type DropAlertFunc func(DropAlert)
+
+// rateWindow counts events in one-second buckets over a sliding window
+type rateWindow struct {
+	mu     sync.Mutex
+	counts []int64
+	secs   []int64
+}
+
+func newRateWindow(window time.Duration) *rateWindow {
+	n := max(int(window/time.Second), 1)
+	return &rateWindow{
+		counts: make([]int64, n),
+		secs:   make([]int64, n),
+	}
+}
+
+func (w *rateWindow) add(now time.Time, n int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sec := now.Unix()
+	i := sec % int64(len(w.counts))
+	if w.secs[i] != sec {
+		w.secs[i] = sec
+		w.counts[i] = 0
+	}
+	w.counts[i] += n
+}
+
+// rate returns the average events per second over the window
+func (w *rateWindow) rate(now time.Time) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sec := now.Unix()
+	size := int64(len(w.counts))
+
+	var total int64
+	for i, s := range w.secs {
+		if sec-s < size {
+			total += w.counts[i]
+		}
+	}
+
+	return float64(total) / float64(size)
+}
+
+// dropMonitor tracks the instance-wide drop rate and fires alerts
+// when either a hub or the whole instance exceeds the threshold
+type dropMonitor struct {
+	window    time.Duration
+	threshold float64
+	onAlert   DropAlertFunc
+	global    *rateWindow
+
+	mu        sync.Mutex
+	lastAlert map[uuid.UUID]time.Time
+	lastPrune time.Time
+}
+
+func newDropMonitor(window time.Duration, threshold float64, onAlert DropAlertFunc) *dropMonitor {
+	if window <= 0 {
+		window = defaultDropAlertWindow
+	}
+	return &dropMonitor{
+		window:    window,
+		threshold: threshold,
+		onAlert:   onAlert,
+		global:    newRateWindow(window),
+		lastAlert: make(map[uuid.UUID]time.Time),
+	}
+}
+
+// record is called by a hub for every dropped message with the hub's own rate window
+func (m *dropMonitor) record(roomID uuid.UUID, hubWindow *rateWindow) {
+	now := time.Now()
+	hubWindow.add(now, 1)
+	m.global.add(now, 1)
+
+	if m.threshold <= 0 || m.onAlert == nil {
+		return
+	}
+
+	m.check(roomID, hubWindow.rate(now), now)
+	m.check(uuid.Nil, m.global.rate(now), now)
+}
+
+// check fires at most one alert per scope per window
+func (m *dropMonitor) check(scope uuid.UUID, rate float64, now time.Time) {
+	if rate <= m.threshold {
+		return
+	}
+
+	m.mu.Lock()
+	if last, ok := m.lastAlert[scope]; ok && now.Sub(last) < m.window {
+		m.mu.Unlock()
+		return
+	}
+	m.lastAlert[scope] = now
+	m.prune(now)
+	m.mu.Unlock()
+
+	go m.onAlert(DropAlert{
+		RoomID:        scope,
+		Rate:          rate,
+		Threshold:     m.threshold,
+		WindowSeconds: int(m.window / time.Second),
+		At:            now,
+	})
+}
+
+// prune forgets alerts older than the window, which no longer suppress anything,
+// so rooms that are long gone don't pile up. Runs at most once per window, m.mu held
+func (m *dropMonitor) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < m.window {
+		return
+	}
+	m.lastPrune = now
+
+	for scope, last := range m.lastAlert {
+		if now.Sub(last) >= m.window {
+			delete(m.lastAlert, scope)
+		}
+	}
+}
+
+// GlobalRate returns the instance-wide drop rate in messages per second
+func (m *dropMonitor) GlobalRate() float64 {
+	return m.global.rate(time.Now())
+}
+
+// NewLogDropAlert returns a DropAlertFunc that only logs the alert
+func NewLogDropAlert(log *slog.Logger) DropAlertFunc {
+	return func(alert DropAlert) {
+		log.Warn("websocket drop rate above threshold",
+			"room_id", alert.RoomID,
+			"rate", alert.Rate,
+			"threshold", alert.Threshold)
+	}
+}
+
+// NewWebhookDropAlert returns a DropAlertFunc that logs the alert and POSTs it as JSON to url
+func NewWebhookDropAlert(url string, log *slog.Logger) DropAlertFunc {
+	client := &http.Client{Timeout: 5 * time.Second}
+	logAlert := NewLogDropAlert(log)
+
+	return func(alert DropAlert) {
+		logAlert(alert)
+
+		body, err := json.Marshal(alert)
+		if err != nil {
+			log.Error("failed to marshal drop alert", "error", err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Error("failed to build drop alert request", "error", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Error("failed to send drop alert webhook", "error", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			log.Error("drop alert webhook rejected",
+				"error", fmt.Errorf("unexpected status %d", resp.StatusCode))
+		}
+	}
+}
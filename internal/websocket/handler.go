@@ -2,17 +2,25 @@ package websocket
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 	"github.com/rx3lixir/laba_zis/internal/auth"
 	"github.com/rx3lixir/laba_zis/internal/room"
 	"github.com/rx3lixir/laba_zis/pkg/httputil"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
 )
 
+// AuthSubprotocol lets browsers, which can't set headers on a WebSocket,
+// send the access token as Sec-WebSocket-Protocol: bearer, <token>
+const AuthSubprotocol = "bearer"
+
 type Handler struct {
 	connManager *ConnectionManager
 	authService *auth.Service
@@ -35,11 +43,24 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 	r.Get("/", httputil.Handler(h.HandleConnection, h.log))
 }
 
+// RegisterAdminRoutes adds the routes mounted under /admin
+func (h *Handler) RegisterAdminRoutes(r chi.Router) {
+	r.Get("/ws/diagnostics", httputil.Handler(h.HandleDiagnostics, h.log))
+}
+
 func (h *Handler) dbCtx(r *http.Request) (context.Context, context.CancelFunc) {
 	return context.WithTimeout(r.Context(), h.dbTimeout)
 }
 
 func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request) error {
+	log := logger.FromContext(r.Context())
+	// Checked before upgrading so we can answer with a proper 403
+	if !h.connManager.CheckOrigin(r) {
+		log.Warn("websocket connection from disallowed origin",
+			"origin", r.Header.Get("Origin"))
+		return httputil.Forbidden("Origin not allowed")
+	}
+
 	query := r.URL.Query()
 
 	roomIDstr := query.Get("room_id")
@@ -52,10 +73,14 @@ func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request) error
 		return httputil.BadRequest("Invalid room_id format")
 	}
 
-	token := query.Get("token")
+	token, fromQuery := accessToken(r)
 	if token == "" {
 		return httputil.Unauthorized("Missing authorization token")
 	}
+	if fromQuery {
+		log.Warn("websocket token passed in query param, which is deprecated",
+			"room_id", roomID)
+	}
 
 	claims, err := h.authService.ValidateAccessToken(token)
 	if err != nil {
@@ -71,15 +96,51 @@ func (h *Handler) HandleConnection(w http.ResponseWriter, r *http.Request) error
 	}
 
 	// Upgrade connection
-	if err := h.connManager.HandleConnection(w, r, claims.UserID, roomID); err != nil {
-		h.log.Error("webSocket upgrade failed", "error", err)
+	if err := h.connManager.HandleConnection(w, r, claims.UserID, claims.Username, roomID); err != nil {
+		switch {
+		case errors.Is(err, ErrTooManyConnections):
+			log.Warn("websocket connection rejected - user limit",
+				"user_id", claims.UserID)
+			return httputil.TooManyRequests("Too many open connections", 0)
+		case errors.Is(err, ErrRoomFull):
+			log.Warn("websocket connection rejected - room full",
+				"room_id", roomID)
+			return httputil.Forbidden("Room connection limit reached")
+		}
+		log.Error("webSocket upgrade failed", "error", err)
 		return httputil.Internal(err)
 	}
 
-	h.log.Info("establishing websocket connection",
+	log.Info("establishing websocket connection",
 		"user_id", claims.UserID,
 		"room_id", roomID,
 		"username", claims.Username)
 
 	return nil
 }
+
+// accessToken reads the token from the Authorization header, then the auth
+// subprotocol, then the token query param. fromQuery is set for the last one,
+// it ends up in proxy and access logs and is only kept for older clients
+func accessToken(r *http.Request) (token string, fromQuery bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		parts := strings.Split(header, " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			return parts[1], false
+		}
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i, p := range protocols {
+		if p == AuthSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1], false
+		}
+	}
+
+	return r.URL.Query().Get("token"), true
+}
+
+// HandleDiagnostics reports hub metrics and current drop rates
+func (h *Handler) HandleDiagnostics(w http.ResponseWriter, r *http.Request) error {
+	return httputil.RespondJSON(w, http.StatusOK, h.connManager.GetDiagnostics())
+}
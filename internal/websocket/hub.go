@@ -3,10 +3,12 @@ package websocket
 import (
 	"encoding/json"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
 type Hub struct {
@@ -25,31 +27,69 @@ type Hub struct {
 	// Unregister requests from clients
 	unregister chan *Client
 
+	// Clients currently viewing the room (only accessed by hub goroutine)
+	focused map[*Client]bool
+
+	// Focus changes reported by clients
+	focus chan focusChange
+
+	// Participants removed from the room, their connections are closed
+	kick chan KickedData
+
+	// Idle checks from the manager's janitor, answered with true if the hub stopped
+	idleCheck chan chan bool
+
+	// Maximum number of clients, zero means unlimited
+	maxClients int
+
 	// Shutdown signal
-	shutdown chan struct{}
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 
 	// Metrics with atomic oprations for thread-safety
 	metrics *HubMetrics
 
+	// Recent drops for rate computation and alerting
+	drops   *rateWindow
+	monitor *dropMonitor
+
 	log *slog.Logger
 }
 
+type focusChange struct {
+	client  *Client
+	focused bool
+}
+
 type HubMetrics struct {
-	ConnectedClients int32
-	MessagesSent     int64
-	MessagesDropped  int64
-	LastActivity     time.Time
+	ConnectedClients int32     `json:"connected_clients"`
+	MessagesSent     int64     `json:"messages_sent"`
+	MessagesDropped  int64     `json:"messages_dropped"`
+	DropRate         float64   `json:"drop_rate"` // Dropped messages per second over the alert window
+	Pongs            int64     `json:"pongs"`
+	AvgPongRTTMillis float64   `json:"avg_pong_rtt_ms"`
+	PingTimeouts     int64     `json:"ping_timeouts"` // Clients disconnected for missing pongs
+	LastActivity     time.Time `json:"last_activity"`
+
+	pongRTTTotal int64 // Nanoseconds, for the average
 }
 
-func NewHub(roomID uuid.UUID, log *slog.Logger) *Hub {
+func NewHub(roomID uuid.UUID, log *slog.Logger, monitor *dropMonitor, maxClients int) *Hub {
 	return &Hub{
 		roomID:     roomID,
 		clients:    make(map[*Client]bool),
 		broadcast:  make(chan ServerMessage, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		focused:    make(map[*Client]bool),
+		focus:      make(chan focusChange),
+		kick:       make(chan KickedData),
+		idleCheck:  make(chan chan bool),
 		shutdown:   make(chan struct{}),
 		metrics:    &HubMetrics{LastActivity: time.Now()},
+		drops:      newRateWindow(monitor.window),
+		monitor:    monitor,
+		maxClients: maxClients,
 		log:        log,
 	}
 }
@@ -70,6 +110,23 @@ func (h *Hub) Run() {
 		case message := <-h.broadcast:
 			h.handleBroadcast(message)
 
+		case change := <-h.focus:
+			h.handleFocus(change)
+
+		case kicked := <-h.kick:
+			h.handleKick(kicked)
+
+		case reply := <-h.idleCheck:
+			if len(h.clients) > 0 {
+				reply <- false
+				continue
+			}
+			// Stop before replying so no register can slip in after the check
+			h.Shutdown()
+			h.handleShutdown()
+			reply <- true
+			return
+
 		case <-ticker.C:
 			h.handleHealthCheck()
 
@@ -81,6 +138,22 @@ func (h *Hub) Run() {
 }
 
 func (h *Hub) handleRegister(client *Client) {
+	if h.maxClients > 0 && len(h.clients) >= h.maxClients {
+		h.log.Warn("room connection limit reached, rejecting client",
+			"room_id", h.roomID,
+			"user_id", client.userID,
+			"max_clients", h.maxClients,
+		)
+		client.SendMessage(ServerMessage{
+			Type:      TypeError,
+			Data:      map[string]string{"error": ErrRoomFull.Error()},
+			Timestamp: time.Now().Unix(),
+		})
+		// The write pump flushes the error and then sends a close frame
+		client.closeSend()
+		return
+	}
+
 	h.clients[client] = true
 
 	// Update metrics atimically
@@ -103,14 +176,21 @@ func (h *Hub) handleRegister(client *Client) {
 	}
 	client.SendMessage(ack)
 
+	client.SendMessage(ServerMessage{
+		Type:      TypePresence,
+		Data:      h.presence(),
+		Timestamp: time.Now().Unix(),
+	})
+
 	// Notify others
-	h.broadcastUserJoined(client.userID)
+	h.broadcastUserJoined(client)
 }
 
 func (h *Hub) handleUnregister(client *Client) {
 	if _, ok := h.clients[client]; ok {
 		delete(h.clients, client)
-		close(client.send) // Signal client to stop
+		delete(h.focused, client)
+		client.closeSend() // Signal client to stop
 
 		atomic.StoreInt32(&h.metrics.ConnectedClients, int32(len(h.clients)))
 
@@ -121,8 +201,94 @@ func (h *Hub) handleUnregister(client *Client) {
 		)
 
 		// Notify others
-		h.broadcastUserLeft(client.userID)
+		h.broadcastUserLeft(client)
+	}
+}
+
+func (h *Hub) handleFocus(change focusChange) {
+	if _, ok := h.clients[change.client]; !ok {
+		return
+	}
+
+	userID := change.client.userID
+	before := h.userStatus(userID)
+
+	if change.focused {
+		h.focused[change.client] = true
+	} else {
+		delete(h.focused, change.client)
+	}
+
+	after := h.userStatus(userID)
+	if before == after {
+		return
+	}
+
+	h.log.Debug("user status changed",
+		"room_id", h.roomID,
+		"user_id", userID,
+		"status", after)
+
+	h.handleBroadcast(ServerMessage{
+		Type: TypeUserStatus,
+		Data: UserStatusData{UserID: userID, Status: after},
+	})
+}
+
+// handleKick tells everyone, the removed user included, and then closes the
+// removed user's connections. The rest of the room also gets user_left for them
+func (h *Hub) handleKick(kicked KickedData) {
+	h.handleBroadcast(ServerMessage{Type: TypeKicked, Data: kicked})
+
+	var removed []*Client
+	for client := range h.clients {
+		if client.userID == kicked.UserID {
+			removed = append(removed, client)
+		}
+	}
+
+	for _, client := range removed {
+		client.closeCode = websocket.ClosePolicyViolation
+		h.handleUnregister(client)
+	}
+
+	if len(removed) > 0 {
+		h.log.Info("kicked user disconnected",
+			"room_id", h.roomID,
+			"user_id", kicked.UserID,
+			"connections", len(removed))
+	}
+}
+
+// presence lists connected users once each, even with several connections
+func (h *Hub) presence() PresenceData {
+	seen := make(map[uuid.UUID]bool, len(h.clients))
+	users := make([]PresenceUser, 0, len(h.clients))
+
+	for client := range h.clients {
+		if seen[client.userID] {
+			continue
+		}
+		seen[client.userID] = true
+
+		users = append(users, PresenceUser{
+			UserID:   client.userID,
+			Username: client.username,
+			Status:   h.userStatus(client.userID),
+		})
+	}
+
+	return PresenceData{Users: users}
+}
+
+// userStatus is "viewing" if any of the user's connections has the room focused
+func (h *Hub) userStatus(userID uuid.UUID) string {
+	for client := range h.focused {
+		if client.userID == userID {
+			return StatusViewing
+		}
 	}
+	return StatusOnline
 }
 
 func (h *Hub) handleBroadcast(message ServerMessage) {
@@ -135,8 +301,14 @@ func (h *Hub) handleBroadcast(message ServerMessage) {
 		return
 	}
 
-	// Send to all clients
+	// Send to all clients. Slow clients are collected and unregistered
+	// after the loop so h.clients isn't mutated while ranging over it
+	var slow []*Client
 	for client := range h.clients {
+		if client == message.exclude {
+			continue
+		}
+
 		select {
 		case client.send <- data:
 			// Success - increment sent counter atomically
@@ -147,10 +319,14 @@ func (h *Hub) handleBroadcast(message ServerMessage) {
 				"user_id", client.userID,
 				"room_id", h.roomID,
 			)
-			atomic.AddInt64(&h.metrics.MessagesDropped, 1)
-			h.handleUnregister(client)
+			h.recordDrop()
+			slow = append(slow, client)
 		}
 	}
+
+	for _, client := range slow {
+		h.handleUnregister(client)
+	}
 }
 
 func (h *Hub) handleHealthCheck() {
@@ -164,27 +340,91 @@ func (h *Hub) handleHealthCheck() {
 func (h *Hub) handleShutdown() {
 	h.log.Info("shutting down hub", "room_id", h.roomID)
 
-	// Gracefully close all clients
+	// Deliver broadcasts that were already queued before telling clients we're leaving
+	for range len(h.broadcast) {
+		h.handleBroadcast(<-h.broadcast)
+	}
+
+	notice := ServerMessage{
+		Type:      TypeServerShutdown,
+		Data:      ServerShutdownData{Reason: "server restarting", Reconnect: true},
+		Timestamp: time.Now().Unix(),
+	}
+
+	// The write pumps flush the notice and send a close frame, then close the socket
 	for client := range h.clients {
-		close(client.send)
-		client.conn.Close()
+		client.SendMessage(notice)
+		client.closeCode = websocket.CloseServiceRestart
+		client.closeSend()
 	}
 
-	close(h.broadcast)
+	// h.broadcast is left open: Send may still be called from handlers
+	// after shutdown and sending on a closed channel would panic
 	h.clients = nil
 }
 
-func (h *Hub) broadcastUserJoined(userID uuid.UUID) {
-	h.broadcast <- ServerMessage{
+// broadcastUserJoined and broadcastUserLeft run on the hub goroutine, so they
+// deliver directly: sending on h.broadcast would block on a full buffer that
+// only this goroutine drains
+func (h *Hub) broadcastUserJoined(client *Client) {
+	h.handleBroadcast(ServerMessage{
 		Type: TypeUserJoined,
-		Data: map[string]any{"user_id": userID},
-	}
+		Data: UserJoinedData{UserID: client.userID, Username: client.username},
+	})
 }
 
-func (h *Hub) broadcastUserLeft(userID uuid.UUID) {
-	h.broadcast <- ServerMessage{
+func (h *Hub) broadcastUserLeft(client *Client) {
+	h.handleBroadcast(ServerMessage{
 		Type: TypeUserLeft,
-		Data: map[string]any{"user_id": userID},
+		Data: UserLeftData{UserID: client.userID, Username: client.username},
+	})
+}
+
+// tryRegister hands the client to the hub, returning false if the hub has stopped
+func (h *Hub) tryRegister(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.shutdown:
+		return false
+	}
+}
+
+// tryUnregister hands the client's departure to the hub, doing nothing if the
+// hub has stopped since shutdown already closed the client
+func (h *Hub) tryUnregister(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.shutdown:
+	}
+}
+
+// stopIfIdle asks the hub goroutine to stop if it has no clients.
+// Returns true if the hub is stopped (including when it already was)
+func (h *Hub) stopIfIdle() bool {
+	reply := make(chan bool, 1)
+
+	select {
+	case h.idleCheck <- reply:
+		return <-reply
+	case <-h.shutdown:
+		return true
+	}
+}
+
+// setFocus is called from the client's read goroutine
+func (h *Hub) setFocus(client *Client, focused bool) {
+	select {
+	case h.focus <- focusChange{client, focused}:
+	case <-h.shutdown:
+	}
+}
+
+// Kick disconnects a removed participant, called from outside the hub goroutine
+func (h *Hub) Kick(kicked KickedData) {
+	select {
+	case h.kick <- kicked:
+	case <-h.shutdown:
 	}
 }
 
@@ -196,20 +436,50 @@ func (h *Hub) Send(message ServerMessage) {
 	default:
 		// Channel full - increment dropped counter atomically
 		h.log.Error("hub broadcast channel full", "room_id", h.roomID)
-		atomic.AddInt64(&h.metrics.MessagesDropped, 1)
+		h.recordDrop()
 	}
 }
 
+// recordDrop is safe to call from any goroutine
+func (h *Hub) recordDrop() {
+	atomic.AddInt64(&h.metrics.MessagesDropped, 1)
+	h.monitor.record(h.roomID, h.drops)
+}
+
+// recordPong is called from client read goroutines
+func (h *Hub) recordPong(rtt time.Duration) {
+	atomic.AddInt64(&h.metrics.Pongs, 1)
+	atomic.AddInt64(&h.metrics.pongRTTTotal, int64(rtt))
+}
+
+// recordPingTimeout is called from client write goroutines
+func (h *Hub) recordPingTimeout() {
+	atomic.AddInt64(&h.metrics.PingTimeouts, 1)
+}
+
 // GetMetricsSnapshot returns a thread-safe copy of current metrics
 func (h *Hub) GetMetricsSnapshot() HubMetrics {
+	pongs := atomic.LoadInt64(&h.metrics.Pongs)
+	var avgRTT float64
+	if pongs > 0 {
+		avgRTT = float64(atomic.LoadInt64(&h.metrics.pongRTTTotal)) / float64(pongs) / float64(time.Millisecond)
+	}
+
 	return HubMetrics{
 		ConnectedClients: atomic.LoadInt32(&h.metrics.ConnectedClients),
 		MessagesSent:     atomic.LoadInt64(&h.metrics.MessagesSent),
 		MessagesDropped:  atomic.LoadInt64(&h.metrics.MessagesDropped),
+		DropRate:         h.drops.rate(time.Now()),
+		Pongs:            pongs,
+		AvgPongRTTMillis: avgRTT,
+		PingTimeouts:     atomic.LoadInt64(&h.metrics.PingTimeouts),
 		LastActivity:     h.metrics.LastActivity, // Only read from hub goroutine
 	}
 }
 
+// Shutdown stops the hub, safe to call more than once
 func (h *Hub) Shutdown() {
-	close(h.shutdown)
+	h.shutdownOnce.Do(func() {
+		close(h.shutdown)
+	})
 }
@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestHubUnregisterRacesShutdown unregisters clients while the hub shuts down,
+// run it with -race. Every client must end up closed and nothing may block
+func TestHubUnregisterRacesShutdown(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for range 20 {
+		hub := NewHub(uuid.New(), log, newDropMonitor(0, 0, nil), 0)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			hub.Run()
+		}()
+
+		clients := make([]*Client, 32)
+		for i := range clients {
+			clients[i] = NewClient(hub, nil, uuid.New(), "user", log)
+			if !hub.tryRegister(clients[i]) {
+				t.Fatal("hub stopped before shutdown")
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, client := range clients {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				hub.tryUnregister(client)
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hub.Shutdown()
+		}()
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			<-stopped
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("unregister and shutdown deadlocked")
+		}
+
+		for _, client := range clients {
+			client.sendMu.Lock()
+			closed := client.closed
+			client.sendMu.Unlock()
+			if !closed {
+				t.Fatalf("client %s was left open", client.userID)
+			}
+		}
+	}
+}
@@ -1,29 +1,164 @@
 package websocket
 
 import (
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // tighten in prod!
-	},
-}
+var (
+	// ErrTooManyConnections means the user already has the maximum number of open connections
+	ErrTooManyConnections = errors.New("too many connections for user")
+	// ErrRoomFull means the room's hub already has the maximum number of clients
+	ErrRoomFull = errors.New("room connection limit reached")
+	// ErrShuttingDown means the manager no longer accepts connections
+	ErrShuttingDown = errors.New("websocket manager is shutting down")
+)
+
+const (
+	defaultJanitorInterval = 5 * time.Minute
+
+	relayPublishTimeout = 2 * time.Second
+	readReceiptTimeout  = 5 * time.Second
+	relayRetryDelay     = 5 * time.Second
+)
 
 type ConnectionManager struct {
-	hubs sync.Map // map[uuid.UUID]*Hub
-	log  *slog.Logger
+	hubs           sync.Map // map[uuid.UUID]*Hub
+	drops          *dropMonitor
+	upgrader       websocket.Upgrader
+	origins        map[string]bool
+	allowAnyOrigin bool
+	log            *slog.Logger
+
+	maxClientsPerHub int
+	maxConnsPerUser  int
+	userConnsMu      sync.Mutex
+	userConns        map[uuid.UUID]int
+	userClients      map[uuid.UUID]map[*Client]struct{} // Registered clients per user, for SendToUser
+	onUserOffline    func(userID uuid.UUID, at time.Time)
+	recordRead       ReadReceiptFunc
+	markRoomRead     RoomReadFunc
+
+	done         chan struct{}
+	shutdownOnce sync.Once
+	janitor      sync.WaitGroup
+
+	// Live clients and their write pumps, so Shutdown can wait for them to
+	// flush and force-close the stragglers
+	clients sync.Map // map[*Client]struct{}
+	pumps   sync.WaitGroup
+
+	// Cross-instance relay, nil broker means single-node mode
+	broker     Broker
+	instanceID string
+	stopRelay  context.CancelFunc
+	relayDone  sync.WaitGroup
 }
 
-func NewConnectionManager(log *slog.Logger) *ConnectionManager {
-	return &ConnectionManager{log: log}
+// Options tunes optional ConnectionManager behaviour
+type Options struct {
+	// DropAlertThreshold is the drop rate (messages per second, averaged over
+	// DropAlertWindow) above which OnDropAlert fires. Zero disables alerting
+	DropAlertThreshold float64
+	DropAlertWindow    time.Duration
+	OnDropAlert        DropAlertFunc
+
+	// AllowedOrigins are the browser origins allowed to open a connection
+	AllowedOrigins []string
+	// AllowAnyOrigin skips the origin check, only meant for local development
+	AllowAnyOrigin bool
+
+	// MaxClientsPerRoom caps connections to a single room's hub, zero means unlimited
+	MaxClientsPerRoom int
+	// MaxConnectionsPerUser caps a user's connections across all rooms, zero means unlimited
+	MaxConnectionsPerUser int
+
+	// OnUserOffline runs in its own goroutine when a user's last connection closes
+	OnUserOffline func(userID uuid.UUID, at time.Time)
+
+	// Broker relays BroadcastToRoom to other instances, nil keeps delivery local
+	Broker Broker
+
+	// RecordReadReceipt persists read receipts sent by clients, nil ignores them
+	RecordReadReceipt ReadReceiptFunc
+	// MarkRoomRead marks the room read when a client focuses it, nil leaves focus as presence only
+	MarkRoomRead RoomReadFunc
+
+	// EnableCompression negotiates permessage-deflate with clients that offer it
+	EnableCompression bool
+}
+
+// ReadReceiptFunc stores that userID has read a message of roomID. It reports
+// recorded=false for duplicates or messages outside the room, which aren't broadcast
+type ReadReceiptFunc func(ctx context.Context, userID, roomID, messageID uuid.UUID) (readAt time.Time, recorded bool, err error)
+
+// RoomReadFunc stores that userID has read every message of roomID sent by
+// others. marked counts the new reads, nothing is broadcast when it's zero
+type RoomReadFunc func(ctx context.Context, userID, roomID uuid.UUID) (readAt time.Time, marked int, err error)
+
+func NewConnectionManager(log *slog.Logger, opts Options) *ConnectionManager {
+	origins := make(map[string]bool, len(opts.AllowedOrigins))
+	for _, origin := range opts.AllowedOrigins {
+		origins[strings.ToLower(origin)] = true
+	}
+
+	cm := &ConnectionManager{
+		drops:          newDropMonitor(opts.DropAlertWindow, opts.DropAlertThreshold, opts.OnDropAlert),
+		origins:        origins,
+		allowAnyOrigin: opts.AllowAnyOrigin,
+		log:            log,
+
+		maxClientsPerHub: opts.MaxClientsPerRoom,
+		maxConnsPerUser:  opts.MaxConnectionsPerUser,
+		userConns:        make(map[uuid.UUID]int),
+		userClients:      make(map[uuid.UUID]map[*Client]struct{}),
+		onUserOffline:    opts.OnUserOffline,
+		recordRead:       opts.RecordReadReceipt,
+		markRoomRead:     opts.MarkRoomRead,
+		done:             make(chan struct{}),
+	}
+	cm.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     cm.CheckOrigin,
+		// Clients that don't offer permessage-deflate still connect uncompressed
+		EnableCompression: opts.EnableCompression,
+		// Echoed back when the client authenticates with the subprotocol,
+		// browsers drop the connection if no offered protocol is selected
+		Subprotocols: []string{AuthSubprotocol},
+	}
+
+	if opts.Broker != nil {
+		cm.startRelay(opts.Broker)
+	}
+
+	return cm
+}
+
+// CheckOrigin reports whether the request's Origin header is allowed.
+// Requests without an Origin header don't come from a browser and are allowed
+func (cm *ConnectionManager) CheckOrigin(r *http.Request) bool {
+	if cm.allowAnyOrigin {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	return cm.origins[strings.ToLower(origin)]
 }
 
 // GetOrCreateHub returns existing hub or creates new one
@@ -32,7 +167,7 @@ func (cm *ConnectionManager) GetOrCreateHub(roomID uuid.UUID) *Hub {
 		return hub.(*Hub)
 	}
 
-	hub := NewHub(roomID, cm.log)
+	hub := NewHub(roomID, cm.log, cm.drops, cm.maxClientsPerHub)
 	actual, loaded := cm.hubs.LoadOrStore(roomID, hub)
 
 	if !loaded {
@@ -44,13 +179,231 @@ func (cm *ConnectionManager) GetOrCreateHub(roomID uuid.UUID) *Hub {
 	return actual.(*Hub)
 }
 
-// BroadcastToRoom sends message to all clients in a room
+// BroadcastToRoom sends message to all clients in a room, on this instance
+// directly and on the others through the broker
 func (cm *ConnectionManager) BroadcastToRoom(roomID uuid.UUID, message ServerMessage) {
 	if hub, ok := cm.hubs.Load(roomID); ok {
 		hub.(*Hub).Send(message)
-	} else {
+	} else if cm.broker == nil {
 		cm.log.Warn("attempted to broadcast to non-existent room", "room_id", roomID)
 	}
+
+	if cm.broker != nil {
+		cm.publish(roomID, message)
+	}
+}
+
+// KickFromRoom tells the room a participant was removed by kickedBy and
+// closes the removed user's connections to it, on every instance
+func (cm *ConnectionManager) KickFromRoom(roomID, userID, kickedBy uuid.UUID) {
+	kicked := KickedData{RoomID: roomID, UserID: userID, KickedBy: kickedBy}
+
+	if hub, ok := cm.hubs.Load(roomID); ok {
+		hub.(*Hub).Kick(kicked)
+	}
+
+	if cm.broker != nil {
+		cm.publish(roomID, ServerMessage{Type: TypeKicked, Data: kicked})
+	}
+}
+
+// SendToUser delivers message to every connection the user has open, in any
+// room and on any instance
+func (cm *ConnectionManager) SendToUser(userID uuid.UUID, message ServerMessage) {
+	cm.sendToLocalUser(userID, message)
+
+	if cm.broker == nil {
+		return
+	}
+
+	data, err := json.Marshal(message.Data)
+	if err != nil {
+		cm.log.Error("failed to marshal relayed message", "user_id", userID, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), relayPublishTimeout)
+	defer cancel()
+
+	err = cm.broker.Publish(ctx, RelayMessage{
+		Origin: cm.instanceID,
+		UserID: userID,
+		Type:   message.Type,
+		Data:   data,
+	})
+	if err != nil {
+		cm.log.Error("failed to relay user message", "user_id", userID, "error", err)
+	}
+}
+
+// AddedToRoom tells the user about a room they were just added to
+func (cm *ConnectionManager) AddedToRoom(roomID, userID, addedBy uuid.UUID) {
+	cm.SendToUser(userID, ServerMessage{
+		Type: TypeAddedToRoom,
+		Data: AddedToRoomData{RoomID: roomID, AddedBy: addedBy},
+	})
+}
+
+func (cm *ConnectionManager) sendToLocalUser(userID uuid.UUID, message ServerMessage) {
+	cm.userConnsMu.Lock()
+	clients := make([]*Client, 0, len(cm.userClients[userID]))
+	for client := range cm.userClients[userID] {
+		clients = append(clients, client)
+	}
+	cm.userConnsMu.Unlock()
+
+	message.Timestamp = time.Now().Unix()
+	for _, client := range clients {
+		client.SendMessage(message)
+	}
+}
+
+func (cm *ConnectionManager) indexClient(client *Client) {
+	cm.userConnsMu.Lock()
+	defer cm.userConnsMu.Unlock()
+
+	clients, ok := cm.userClients[client.userID]
+	if !ok {
+		clients = make(map[*Client]struct{})
+		cm.userClients[client.userID] = clients
+	}
+	clients[client] = struct{}{}
+}
+
+func (cm *ConnectionManager) unindexClient(client *Client) {
+	cm.userConnsMu.Lock()
+	defer cm.userConnsMu.Unlock()
+
+	delete(cm.userClients[client.userID], client)
+	if len(cm.userClients[client.userID]) == 0 {
+		delete(cm.userClients, client.userID)
+	}
+}
+
+// handleReadReceipt stores a client's read receipt and tells the room about new ones
+func (cm *ConnectionManager) handleReadReceipt(userID, roomID, messageID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), readReceiptTimeout)
+	defer cancel()
+
+	readAt, recorded, err := cm.recordRead(ctx, userID, roomID, messageID)
+	if err != nil {
+		cm.log.Error("failed to record read receipt",
+			"user_id", userID,
+			"message_id", messageID,
+			"error", err)
+		return
+	}
+	if !recorded {
+		return
+	}
+
+	cm.BroadcastToRoom(roomID, ServerMessage{
+		Type: TypeReadReceipt,
+		Data: ReadReceiptData{MessageID: messageID, UserID: userID, ReadAt: &readAt},
+	})
+}
+
+// handleRoomFocus marks the room read for a user who just focused it and tells
+// the room, like POST /rooms/{roomID}/read does
+func (cm *ConnectionManager) handleRoomFocus(userID, roomID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), readReceiptTimeout)
+	defer cancel()
+
+	readAt, marked, err := cm.markRoomRead(ctx, userID, roomID)
+	if err != nil {
+		cm.log.Error("failed to mark focused room read",
+			"user_id", userID,
+			"room_id", roomID,
+			"error", err)
+		return
+	}
+	if marked == 0 {
+		return
+	}
+
+	cm.BroadcastToRoom(roomID, ServerMessage{
+		Type: TypeRoomRead,
+		Data: RoomReadData{RoomID: roomID, UserID: userID, Marked: marked, ReadAt: readAt},
+	})
+}
+
+// startRelay subscribes to broadcasts from other instances until Shutdown
+func (cm *ConnectionManager) startRelay(broker Broker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cm.broker = broker
+	cm.instanceID = uuid.NewString()
+	cm.stopRelay = cancel
+
+	cm.relayDone.Add(1)
+	go func() {
+		defer cm.relayDone.Done()
+
+		// Retry until shut down, a dropped subscription would silently cut this instance off
+		for {
+			if err := broker.Subscribe(ctx, cm.deliverRelayed); err != nil {
+				cm.log.Error("websocket relay subscription failed", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(relayRetryDelay):
+			}
+		}
+	}()
+}
+
+// publish hands a local broadcast to the broker for the other instances
+func (cm *ConnectionManager) publish(roomID uuid.UUID, message ServerMessage) {
+	data, err := json.Marshal(message.Data)
+	if err != nil {
+		cm.log.Error("failed to marshal relayed message", "room_id", roomID, "error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), relayPublishTimeout)
+	defer cancel()
+
+	err = cm.broker.Publish(ctx, RelayMessage{
+		Origin: cm.instanceID,
+		RoomID: roomID,
+		Type:   message.Type,
+		Data:   data,
+	})
+	if err != nil {
+		cm.log.Error("failed to relay broadcast", "room_id", roomID, "error", err)
+	}
+}
+
+// deliverRelayed hands a message from another instance to the local hub, if any.
+// Our own messages were already delivered locally and are skipped
+func (cm *ConnectionManager) deliverRelayed(msg RelayMessage) {
+	if msg.Origin == cm.instanceID {
+		return
+	}
+
+	if msg.UserID != uuid.Nil {
+		cm.sendToLocalUser(msg.UserID, ServerMessage{Type: msg.Type, Data: msg.Data})
+		return
+	}
+
+	hub, ok := cm.hubs.Load(msg.RoomID)
+	if !ok {
+		return
+	}
+
+	// Kicks also disconnect the user's connections on this instance
+	if msg.Type == TypeKicked {
+		var kicked KickedData
+		if err := json.Unmarshal(msg.Data, &kicked); err != nil {
+			cm.log.Error("invalid relayed kick", "room_id", msg.RoomID, "error", err)
+			return
+		}
+		hub.(*Hub).Kick(kicked)
+		return
+	}
+
+	hub.(*Hub).Send(ServerMessage{Type: msg.Type, Data: msg.Data})
 }
 
 // HandleConnection upgrades HTTP to WebSocket
@@ -58,28 +411,146 @@ func (cm *ConnectionManager) HandleConnection(
 	w http.ResponseWriter,
 	r *http.Request,
 	userID uuid.UUID,
+	username string,
 	roomID uuid.UUID,
 ) error {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// Limits are checked before upgrading so the caller can still answer over HTTP
+	if err := cm.reserve(userID, roomID); err != nil {
+		return err
+	}
+
+	conn, err := cm.upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		cm.release(userID)
 		return err
 	}
+	if cm.upgrader.EnableCompression {
+		// No-ops when the client didn't negotiate compression. Payloads are
+		// small and mostly URLs, the fastest level gets nearly all of the gain
+		conn.EnableWriteCompression(true)
+		conn.SetCompressionLevel(flate.BestSpeed)
+	}
 
-	hub := cm.GetOrCreateHub(roomID)
-	client := NewClient(hub, conn, userID, cm.log)
+	// The janitor may stop an idle hub right after we looked it up,
+	// in that case retry with a fresh one
+	var client *Client
+	for {
+		select {
+		case <-cm.done:
+			conn.Close()
+			cm.release(userID)
+			return ErrShuttingDown
+		default:
+		}
 
-	// Register with hub
-	hub.register <- client
+		hub := cm.GetOrCreateHub(roomID)
+		client = NewClient(hub, conn, userID, username, cm.log)
+		if hub.tryRegister(client) {
+			break
+		}
+		cm.hubs.CompareAndDelete(roomID, hub)
+	}
+	cm.clients.Store(client, struct{}{})
+	cm.indexClient(client)
+	client.broadcast = func(msg ServerMessage) { cm.BroadcastToRoom(roomID, msg) }
+	if cm.recordRead != nil {
+		client.onReadReceipt = func(messageID uuid.UUID) {
+			cm.handleReadReceipt(userID, roomID, messageID)
+		}
+	}
+	if cm.markRoomRead != nil {
+		client.onRoomFocus = func() {
+			cm.handleRoomFocus(userID, roomID)
+		}
+	}
+	client.onClose = func() {
+		cm.clients.Delete(client)
+		cm.unindexClient(client)
+		cm.release(userID)
+	}
 
 	// Start client pumps
-	go client.writePump()
+	cm.pumps.Add(1)
+	go func() {
+		defer cm.pumps.Done()
+		client.writePump()
+	}()
 	go client.readPump()
 
 	return nil
 }
 
-// Shutdown gracefully shuts down all hubs
-func (cm *ConnectionManager) Shutdown() {
+// reserve takes one of the user's connection slots, failing if either limit is reached.
+// The room check is best effort, the hub enforces its limit again on register
+func (cm *ConnectionManager) reserve(userID, roomID uuid.UUID) error {
+	if cm.maxClientsPerHub > 0 {
+		if hub, ok := cm.hubs.Load(roomID); ok {
+			clients := atomic.LoadInt32(&hub.(*Hub).metrics.ConnectedClients)
+			if int(clients) >= cm.maxClientsPerHub {
+				return ErrRoomFull
+			}
+		}
+	}
+
+	cm.userConnsMu.Lock()
+	defer cm.userConnsMu.Unlock()
+
+	if cm.maxConnsPerUser > 0 && cm.userConns[userID] >= cm.maxConnsPerUser {
+		return ErrTooManyConnections
+	}
+	cm.userConns[userID]++
+
+	return nil
+}
+
+// release returns a slot taken by reserve
+func (cm *ConnectionManager) release(userID uuid.UUID) {
+	cm.userConnsMu.Lock()
+	if cm.userConns[userID] > 1 {
+		cm.userConns[userID]--
+		cm.userConnsMu.Unlock()
+		return
+	}
+	delete(cm.userConns, userID)
+	cm.userConnsMu.Unlock()
+
+	if cm.onUserOffline != nil {
+		go cm.onUserOffline(userID, time.Now())
+	}
+}
+
+// IsUserOnline reports whether the user has at least one open connection.
+// It's a map lookup, cheap enough to call per room member
+func (cm *ConnectionManager) IsUserOnline(userID uuid.UUID) bool {
+	cm.userConnsMu.Lock()
+	defer cm.userConnsMu.Unlock()
+
+	return cm.userConns[userID] > 0
+}
+
+// OnlineUsers returns every user with at least one open connection
+func (cm *ConnectionManager) OnlineUsers() []uuid.UUID {
+	cm.userConnsMu.Lock()
+	defer cm.userConnsMu.Unlock()
+
+	users := make([]uuid.UUID, 0, len(cm.userConns))
+	for userID := range cm.userConns {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// Shutdown stops the janitor and all hubs. Clients get a server_shutdown message
+// and a close frame, connections still open when ctx ends are closed abruptly
+func (cm *ConnectionManager) Shutdown(ctx context.Context) {
+	cm.shutdownOnce.Do(func() { close(cm.done) })
+	cm.janitor.Wait()
+
+	if cm.stopRelay != nil {
+		cm.stopRelay()
+		cm.relayDone.Wait()
+	}
+
 	cm.log.Info("shutting down all websocket hubs")
 	cm.hubs.Range(func(key, value any) bool {
 		hub := value.(*Hub)
@@ -91,7 +562,22 @@ func (cm *ConnectionManager) Shutdown() {
 		return true
 	})
 
-	cm.log.Info("all websocket hubs shut down")
+	flushed := make(chan struct{})
+	go func() {
+		cm.pumps.Wait()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+		cm.log.Info("all websocket hubs shut down")
+	case <-ctx.Done():
+		cm.log.Warn("websocket drain timed out, closing remaining connections")
+		cm.clients.Range(func(key, _ any) bool {
+			key.(*Client).conn.Close()
+			return true
+		})
+	}
 }
 
 // GetMetrics returns metrics for monitoring (now thread-safe)
@@ -111,6 +597,17 @@ func (cm *ConnectionManager) GetMetrics() map[uuid.UUID]HubMetrics {
 	return metrics
 }
 
+// GetDiagnostics returns per-hub metrics along with the instance-wide drop rate
+func (cm *ConnectionManager) GetDiagnostics() Diagnostics {
+	hubs := cm.GetMetrics()
+
+	return Diagnostics{
+		HubCount: len(hubs),
+		DropRate: cm.drops.GlobalRate(),
+		Hubs:     hubs,
+	}
+}
+
 // GetHubCount returns the number of active hubs
 func (cm *ConnectionManager) GetHubCount() int {
 	count := 0
@@ -121,7 +618,33 @@ func (cm *ConnectionManager) GetHubCount() int {
 	return count
 }
 
-// CleanupIdleHubs removes hubs with no clients (call periodically)
+// StartJanitor periodically removes hubs without clients until Shutdown is called
+func (cm *ConnectionManager) StartJanitor(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+
+	cm.janitor.Add(1)
+	go func() {
+		defer cm.janitor.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cm.CleanupIdleHubs()
+			case <-cm.done:
+				return
+			}
+		}
+	}()
+}
+
+// CleanupIdleHubs removes hubs with no clients. The hub goroutine itself
+// confirms it's empty and stops, so a client registering concurrently
+// either lands before the check (hub stays) or retries on a new hub
 func (cm *ConnectionManager) CleanupIdleHubs() int {
 	removed := 0
 
@@ -129,13 +652,14 @@ func (cm *ConnectionManager) CleanupIdleHubs() int {
 		hub := value.(*Hub)
 		roomID := key.(uuid.UUID)
 
-		metrics := hub.GetMetricsSnapshot()
+		// Cheap pre-check, the authoritative one happens in the hub goroutine
+		if hub.GetMetricsSnapshot().ConnectedClients > 0 {
+			return true
+		}
 
-		// If no clients, shut down and remove
-		if metrics.ConnectedClients == 0 {
-			cm.log.Debug("cleaning up idle hub", "room_id", roomID)
-			hub.Shutdown()
-			cm.hubs.Delete(roomID)
+		if hub.stopIfIdle() {
+			cm.log.Debug("cleaned up idle hub", "room_id", roomID)
+			cm.hubs.CompareAndDelete(roomID, hub)
 			removed++
 		}
 
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Broker relays room broadcasts between API instances, so a message sent on
+// one instance reaches clients connected to another. Without a broker the
+// manager only delivers to its own clients
+type Broker interface {
+	Publish(ctx context.Context, msg RelayMessage) error
+	// Subscribe calls deliver for every message published by any instance
+	// (including this one) until ctx is cancelled
+	Subscribe(ctx context.Context, deliver func(RelayMessage)) error
+}
+
+// RelayMessage is a room broadcast, or a message to one user when UserID
+// is set, as it travels between instances
+type RelayMessage struct {
+	Origin string          `json:"origin"` // Instance that published it
+	RoomID uuid.UUID       `json:"room_id"`
+	UserID uuid.UUID       `json:"user_id,omitempty"`
+	Type   MessageType     `json:"type"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+const defaultChannelPrefix = "laba_zis:ws:room:"
+
+// RedisBroker publishes each room and user on its own channel and pattern-subscribes to all of them
+type RedisBroker struct {
+	client *redis.Client
+	prefix string
+}
+
+var _ Broker = (*RedisBroker)(nil)
+
+func NewRedisBroker(client *redis.Client, channelPrefix string) *RedisBroker {
+	if channelPrefix == "" {
+		channelPrefix = defaultChannelPrefix
+	}
+	return &RedisBroker{client: client, prefix: channelPrefix}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, msg RelayMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal relay message: %w", err)
+	}
+
+	channel := b.prefix + msg.RoomID.String()
+	if msg.UserID != uuid.Nil {
+		channel = b.prefix + "user:" + msg.UserID.String()
+	}
+
+	if err := b.client.Publish(ctx, channel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish relay message: %w", err)
+	}
+
+	return nil
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, deliver func(RelayMessage)) error {
+	sub := b.client.PSubscribe(ctx, b.prefix+"*")
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed so startup errors surface
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to relay channels: %w", err)
+	}
+
+	// The channel survives reconnects, go-redis resubscribes on its own
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if !strings.HasPrefix(m.Channel, b.prefix) {
+				continue
+			}
+
+			var msg RelayMessage
+			if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+				continue
+			}
+			deliver(msg)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -14,14 +15,34 @@ const (
 	TypePing        MessageType = "ping"
 	TypeTyping      MessageType = "typing"
 	TypeReadReceipt MessageType = "read_receipt"
+	TypeActiveRoom  MessageType = "active_room"
+	// Also rebroadcast to the room
+	TypeTextMessage MessageType = "text_message"
+	TypeRecording   MessageType = "recording"
 
 	// Server -> Client
-	TypePong            MessageType = "pong"
-	TypeNewVoiceMessage MessageType = "new_voice_message"
-	TypeUserJoined      MessageType = "user_joined"
-	TypeUserLeft        MessageType = "user_left"
-	TypeError           MessageType = "error"
-	TypeConnectionAck   MessageType = "connection_ack"
+	TypePong                MessageType = "pong"
+	TypeNewVoiceMessage     MessageType = "new_voice_message"
+	TypeVoiceMessageDeleted MessageType = "voice_message_deleted"
+	TypeUserJoined          MessageType = "user_joined"
+	TypeUserLeft            MessageType = "user_left"
+	TypeError               MessageType = "error"
+	TypeConnectionAck       MessageType = "connection_ack"
+	TypeUserStatus          MessageType = "user_status"
+	TypePresence            MessageType = "presence"
+	TypeServerShutdown      MessageType = "server_shutdown"
+	TypeReaction            MessageType = "reaction"
+	TypeTranscriptReady     MessageType = "transcript_ready"
+	TypeKicked              MessageType = "kicked"
+	TypeAddedToRoom         MessageType = "added_to_room"
+	TypePlayed              MessageType = "played"
+	TypeRoomRead            MessageType = "room_read"
+)
+
+// Presence statuses reported in user_status events
+const (
+	StatusOnline  = "online"  // Connected to the room
+	StatusViewing = "viewing" // Connected and actively looking at the room
 )
 
 // ClientMessage represents any message from client
@@ -35,6 +56,9 @@ type ServerMessage struct {
 	Type      MessageType `json:"type"`
 	Data      any         `json:"data,omitempty"`
 	Timestamp int64       `json:"timestamp"`
+
+	// exclude is skipped by the hub when broadcasting (usually the sender)
+	exclude *Client
 }
 
 // VoiceMessageData is the payload for new voice messages
@@ -43,4 +67,144 @@ type VoiceMessageData struct {
 	SenderID  uuid.UUID `json:"sender_id"`
 	Duration  int       `json:"duration"`
 	URL       string    `json:"url"`
+	// URLExpiresAt is when URL stops working, null when there is no URL
+	URLExpiresAt *time.Time `json:"url_expires_at"`
+}
+
+// VoiceMessageDeletedData is the payload for deleted voice messages
+type VoiceMessageDeletedData struct {
+	MessageID uuid.UUID `json:"message_id"`
+	RoomID    uuid.UUID `json:"room_id"`
+}
+
+// ActiveRoomData is sent by a client when it switches focus.
+// A null or different room_id means the client is no longer viewing this room.
+// Focusing the room marks it read and the room gets a room_read event
+type ActiveRoomData struct {
+	RoomID *uuid.UUID `json:"room_id"`
+}
+
+// TypingData is sent by a client while typing or recording and rebroadcast
+// to the other room members with the sender's user ID filled in
+type TypingData struct {
+	RoomID *uuid.UUID `json:"room_id,omitempty"`
+	UserID uuid.UUID  `json:"user_id"`
+}
+
+// ReadReceiptData is sent by a client once it has played a message and
+// rebroadcast to the room with the reader and time filled in
+type ReadReceiptData struct {
+	MessageID uuid.UUID  `json:"message_id"`
+	UserID    uuid.UUID  `json:"user_id,omitempty"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+// RoomReadData tells the room a member caught up on many messages at once,
+// in place of a read_receipt per message
+type RoomReadData struct {
+	RoomID uuid.UUID  `json:"room_id"`
+	UserID uuid.UUID  `json:"user_id"`
+	UpTo   *uuid.UUID `json:"up_to,omitempty"` // Last message read, all of them when omitted
+	Marked int        `json:"marked"`
+	ReadAt time.Time  `json:"read_at"`
+}
+
+// PlayedData tells the room a member listened to a message
+type PlayedData struct {
+	MessageID uuid.UUID `json:"message_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	PlayCount int       `json:"play_count"`
+	PlayedAt  time.Time `json:"played_at"`
+}
+
+// Reaction actions reported in reaction events
+const (
+	ReactionAdded   = "added"
+	ReactionRemoved = "removed"
+)
+
+// ReactionData is the payload for reaction events
+type ReactionData struct {
+	MessageID uuid.UUID `json:"message_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Emoji     string    `json:"emoji"`
+	Action    string    `json:"action"`
+}
+
+// TranscriptReadyData is sent once a voice message has been transcribed
+type TranscriptReadyData struct {
+	MessageID  uuid.UUID `json:"message_id"`
+	Transcript string    `json:"transcript"`
+}
+
+// ServerShutdownData is sent right before the server closes the connection
+// for a restart, so clients can reconnect instead of reporting a network error
+type ServerShutdownData struct {
+	Reason    string `json:"reason"`
+	Reconnect bool   `json:"reconnect"`
+}
+
+// TextMessageData is a short text note sent over the socket. It isn't stored,
+// only members connected at the time receive it
+type TextMessageData struct {
+	Text     string    `json:"text"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// RecordingData tells the room a member started or stopped recording a voice message
+type RecordingData struct {
+	Active bool      `json:"active"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// UserJoinedData is the payload for user_joined events
+type UserJoinedData struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// KickedData tells the room, and the removed user before they are
+// disconnected, that the owner removed a participant
+type KickedData struct {
+	RoomID   uuid.UUID `json:"room_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	KickedBy uuid.UUID `json:"kicked_by"`
+}
+
+// AddedToRoomData is sent to a user on all their connections when they are
+// added to a room, so clients can list it without polling
+type AddedToRoomData struct {
+	RoomID  uuid.UUID `json:"room_id"`
+	AddedBy uuid.UUID `json:"added_by"`
+}
+
+// UserLeftData is the payload for user_left events
+type UserLeftData struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// PresenceData lists everyone connected to the room, sent to a client right after it connects
+type PresenceData struct {
+	Users []PresenceUser `json:"users"`
+}
+
+type PresenceUser struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+	Status   string    `json:"status"`
+}
+
+// UserStatusData is the payload for user status changes
+type UserStatusData struct {
+	UserID uuid.UUID `json:"user_id"`
+	Status string    `json:"status"`
+}
+
+// Diagnostics is the payload of the diagnostics endpoint
+type Diagnostics struct {
+	HubCount int                      `json:"hub_count"`
+	DropRate float64                  `json:"drop_rate"` // Instance-wide, messages per second
+	Hubs     map[uuid.UUID]HubMetrics `json:"hubs"`
 }
@@ -0,0 +1,293 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// durationTailSize is how much of the end of a file is read to find the last Ogg page or WebM cluster
+const durationTailSize = 256 * 1024
+
+// EBML element IDs needed for the duration
+const (
+	ebmlIDInfo          = 0x1549A966
+	ebmlIDTimecodeScale = 0x2AD7B1
+	ebmlIDDuration      = 0x4489
+	ebmlIDTimecode      = 0xE7
+	ebmlIDSimpleBlock   = 0xA3
+	ebmlIDBlockGroup    = 0xA0
+	ebmlIDBlock         = 0xA1
+)
+
+// Duration measures the playback length of a file stored in the given format.
+// ErrUnsupported is returned when the format or this particular file doesn't
+// carry enough information to tell
+func Duration(r io.ReaderAt, size int64, format string) (time.Duration, error) {
+	switch format {
+	case "ogg":
+		return durationOgg(r, size)
+	case "webm":
+		return durationWebM(r, size)
+	case "wav":
+		return durationWAV(r, size)
+	case "m4a":
+		return durationMP4(r, size)
+	default:
+		return 0, ErrUnsupported
+	}
+}
+
+// readTail reads up to n bytes from the end of the file
+func readTail(r io.ReaderAt, size int64, n int) ([]byte, error) {
+	off := max(size-int64(n), 0)
+	return readAt(r, off, n, size)
+}
+
+func durationOgg(r io.ReaderAt, size int64) (time.Duration, error) {
+	head, err := readAt(r, 0, probeHeaderSize, size)
+	if err != nil {
+		return 0, err
+	}
+
+	packet, ok := firstOggPacket(head)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	var rate, preSkip int64
+	switch {
+	case len(packet) >= 19 && string(packet[:8]) == "OpusHead":
+		// Opus granule positions always count 48kHz samples
+		rate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:]))
+	case len(packet) >= 16 && string(packet[:7]) == "\x01vorbis":
+		rate = int64(binary.LittleEndian.Uint32(packet[12:]))
+	default:
+		return 0, ErrUnsupported
+	}
+	if rate == 0 {
+		return 0, ErrUnsupported
+	}
+
+	tail, err := readTail(r, size, durationTailSize)
+	if err != nil {
+		return 0, err
+	}
+
+	granule, ok := lastOggGranule(tail)
+	if !ok || granule < preSkip {
+		return 0, ErrUnsupported
+	}
+
+	return seconds(float64(granule-preSkip) / float64(rate)), nil
+}
+
+// lastOggGranule returns the granule position of the last page that has one
+func lastOggGranule(b []byte) (int64, bool) {
+	for end := len(b); end > 0; {
+		i := bytes.LastIndex(b[:end], []byte("OggS"))
+		if i < 0 {
+			return 0, false
+		}
+		end = i
+
+		// Version 0 and a full header, -1 means no packet finishes on this page
+		if len(b)-i < 27 || b[i+4] != 0 {
+			continue
+		}
+		granule := int64(binary.LittleEndian.Uint64(b[i+6:]))
+		if granule >= 0 {
+			return granule, true
+		}
+	}
+	return 0, false
+}
+
+func durationWebM(r io.ReaderAt, size int64) (time.Duration, error) {
+	head, err := readAt(r, 0, probeHeaderSize, size)
+	if err != nil {
+		return 0, err
+	}
+
+	segment, ok := webmSegment(head)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	// Timecodes are in TimecodeScale nanoseconds, 1ms unless stated otherwise
+	scale := uint64(1_000_000)
+	var declared float64
+
+	ebmlChildren(segment, func(id uint64, data []byte) bool {
+		if id != ebmlIDInfo {
+			return id != ebmlIDCluster
+		}
+		ebmlChildren(data, func(id uint64, data []byte) bool {
+			switch id {
+			case ebmlIDTimecodeScale:
+				if v := ebmlUint(data); v > 0 {
+					scale = v
+				}
+			case ebmlIDDuration:
+				declared = ebmlFloat(data)
+			}
+			return true
+		})
+		return false
+	})
+
+	if declared > 0 {
+		return seconds(declared * float64(scale) / 1e9), nil
+	}
+
+	// Recorders that stream (MediaRecorder) never write Duration,
+	// so fall back to the timecode of the last block
+	tail, err := readTail(r, size, durationTailSize)
+	if err != nil {
+		return 0, err
+	}
+
+	timecode, ok := lastWebMTimecode(tail)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+
+	return seconds(float64(timecode) * float64(scale) / 1e9), nil
+}
+
+// lastWebMTimecode finds the last cluster in b and returns the absolute
+// timecode of its last block
+func lastWebMTimecode(b []byte) (int64, bool) {
+	i := bytes.LastIndex(b, []byte{0x1F, 0x43, 0xB6, 0x75})
+	if i < 0 {
+		return 0, false
+	}
+
+	var (
+		clusterTime int64
+		lastBlock   int64
+		found       bool
+	)
+
+	ebmlChildren(b[i:], func(id uint64, cluster []byte) bool {
+		ebmlChildren(cluster, func(id uint64, data []byte) bool {
+			switch id {
+			case ebmlIDTimecode:
+				clusterTime = int64(ebmlUint(data))
+			case ebmlIDSimpleBlock:
+				if t, ok := webmBlockTimecode(data); ok {
+					lastBlock, found = max(lastBlock, t), true
+				}
+			case ebmlIDBlockGroup:
+				ebmlChildren(data, func(id uint64, block []byte) bool {
+					if id == ebmlIDBlock {
+						if t, ok := webmBlockTimecode(block); ok {
+							lastBlock, found = max(lastBlock, t), true
+						}
+					}
+					return true
+				})
+			}
+			return true
+		})
+		return false
+	})
+
+	if !found {
+		return 0, false
+	}
+	return clusterTime + lastBlock, true
+}
+
+// webmBlockTimecode reads the cluster-relative timecode after the track number
+func webmBlockTimecode(block []byte) (int64, bool) {
+	_, n, _, ok := readVint(block, false)
+	if !ok || len(block) < n+2 {
+		return 0, false
+	}
+	return int64(int16(binary.BigEndian.Uint16(block[n:]))), true
+}
+
+func durationWAV(r io.ReaderAt, size int64) (time.Duration, error) {
+	b, err := readAt(r, 0, probeHeaderSize, size)
+	if err != nil {
+		return 0, err
+	}
+
+	fmtChunk, ok := findWAVChunk(b, "fmt ")
+	if !ok || len(fmtChunk) < 16 {
+		return 0, ErrUnsupported
+	}
+
+	byteRate := int64(binary.LittleEndian.Uint32(fmtChunk[8:]))
+	dataOffset, dataSize, ok := wavDataChunk(b)
+	if !ok || byteRate == 0 {
+		return 0, ErrUnsupported
+	}
+
+	// Streaming writers leave the size at 0 or 0xFFFFFFFF, use what's actually there
+	if dataSize == 0 || dataSize == 0xFFFFFFFF || dataOffset+dataSize > size {
+		dataSize = size - dataOffset
+	}
+
+	return seconds(float64(dataSize) / float64(byteRate)), nil
+}
+
+// wavDataChunk returns the file offset and declared size of the data chunk
+func wavDataChunk(b []byte) (offset, size int64, ok bool) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return 0, 0, false
+	}
+
+	for off := 12; off+8 <= len(b); {
+		chunkSize := int(binary.LittleEndian.Uint32(b[off+4:]))
+		if string(b[off:off+4]) == "data" {
+			return int64(off + 8), int64(chunkSize), true
+		}
+		off += 8 + chunkSize + chunkSize&1
+	}
+
+	return 0, 0, false
+}
+
+func durationMP4(r io.ReaderAt, size int64) (time.Duration, error) {
+	moov, err := readMP4Moov(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	mvhd, ok := mp4Find(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return 0, ErrUnsupported
+	}
+
+	var timescale, duration uint64
+	if mvhd[0] == 1 {
+		// Version 1 uses 64-bit creation/modification times and duration
+		if len(mvhd) < 32 {
+			return 0, ErrUnsupported
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:]))
+		duration = binary.BigEndian.Uint64(mvhd[24:])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:]))
+	}
+
+	if timescale == 0 {
+		return 0, ErrUnsupported
+	}
+
+	return seconds(float64(duration) / float64(timescale)), nil
+}
+
+// seconds converts without overflowing on bogus header values
+func seconds(s float64) time.Duration {
+	if s < 0 || s > float64(math.MaxInt64/int64(time.Second)) {
+		return math.MaxInt64
+	}
+	return time.Duration(s * float64(time.Second))
+}
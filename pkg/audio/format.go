@@ -2,41 +2,82 @@ package audio
 
 import (
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
-// detectAudioFormat determines file extension based on Content-Type and filename
+// Format describes an audio format the server knows how to store
+type Format struct {
+	Name        string   `json:"name"`         // Canonical name, used as the stored file extension
+	ContentType string   `json:"content_type"` // MIME type served back to clients
+	Extensions  []string `json:"extensions"`   // Accepted filename extensions
+	MIMETypes   []string `json:"-"`            // Substrings matched against the declared Content-Type
+}
+
+// registry is the single source of truth for supported formats.
+// Order matters for Content-Type matching
+var registry = []Format{
+	{Name: "webm", ContentType: "audio/webm", Extensions: []string{".webm"}, MIMETypes: []string{"webm"}},
+	{Name: "m4a", ContentType: "audio/mp4", Extensions: []string{".m4a", ".mp4"}, MIMETypes: []string{"mp4", "aac"}},
+	{Name: "mp3", ContentType: "audio/mpeg", Extensions: []string{".mp3"}, MIMETypes: []string{"mpeg", "mp3"}},
+	{Name: "ogg", ContentType: "audio/ogg", Extensions: []string{".ogg", ".opus"}, MIMETypes: []string{"ogg"}},
+	{Name: "wav", ContentType: "audio/wav", Extensions: []string{".wav"}, MIMETypes: []string{"wav"}},
+}
+
+// Formats returns every format known to the registry
+func Formats() []Format {
+	return slices.Clone(registry)
+}
+
+// FormatNames returns the canonical names of every known format
+func FormatNames() []string {
+	names := make([]string, len(registry))
+	for i, f := range registry {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Lookup finds a format by its canonical name
+func Lookup(name string) (Format, bool) {
+	for _, f := range registry {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// ContentType maps a format name to its MIME type
+func ContentType(name string) string {
+	if f, ok := Lookup(name); ok {
+		return f.ContentType
+	}
+	return "application/octet-stream"
+}
+
+// DetectAudioFormat determines the format name based on filename and Content-Type.
+// Returns an empty string when neither matches a known format
 func DetectAudioFormat(contentType, filename string) string {
 	// Priority 1: Trust filename extension
 	if filename != "" {
 		ext := strings.ToLower(filepath.Ext(filename))
-		switch ext {
-		case ".webm":
-			return "webm"
-		case ".m4a", ".mp4":
-			return "m4a"
-		case ".mp3":
-			return "mp3"
-		case ".ogg", ".opus":
-			return "ogg"
-		case ".wav":
-			return "wav"
+		for _, f := range registry {
+			if slices.Contains(f.Extensions, ext) {
+				return f.Name
+			}
 		}
 	}
 
 	// Priority 2: Trust Content-Type
-	switch {
-	case strings.Contains(contentType, "webm"):
-		return "webm"
-	case strings.Contains(contentType, "mp4"), strings.Contains(contentType, "aac"):
-		return "m4a"
-	case strings.Contains(contentType, "mpeg"), strings.Contains(contentType, "mp3"):
-		return "mp3"
-	case strings.Contains(contentType, "ogg"):
-		return "ogg"
-	case strings.Contains(contentType, "wav"):
-		return "wav"
-	default:
-		return "webm"
+	contentType = strings.ToLower(contentType)
+	for _, f := range registry {
+		for _, mime := range f.MIMETypes {
+			if strings.Contains(contentType, mime) {
+				return f.Name
+			}
+		}
 	}
+
+	return ""
 }
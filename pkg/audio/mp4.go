@@ -0,0 +1,138 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// maxMoovSize bounds how much of an MP4 file is loaded to read its metadata
+const maxMoovSize = 4 * 1024 * 1024
+
+func probeMP4(r io.ReaderAt, size int64) (*Info, error) {
+	moov, err := readMP4Moov(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *Info
+	mp4Children(moov, func(typ string, trak []byte) bool {
+		if typ != "trak" {
+			return true
+		}
+		mdia, ok := mp4Find(trak, "mdia")
+		if !ok || !isSoundTrack(mdia) {
+			return true
+		}
+		stsd, ok := mp4Find(mdia, "minf", "stbl", "stsd")
+		if !ok || len(stsd) < 8 {
+			return true
+		}
+		// Skip version/flags and entry count, the first entry is an AudioSampleEntry
+		mp4Children(stsd[8:], func(_ string, entry []byte) bool {
+			if len(entry) >= 28 {
+				info = &Info{
+					Channels:   int(binary.BigEndian.Uint16(entry[16:])),
+					SampleRate: int(binary.BigEndian.Uint32(entry[24:]) >> 16),
+				}
+			}
+			return false
+		})
+		return info == nil
+	})
+
+	if info == nil {
+		return nil, ErrUnsupported
+	}
+	return info, nil
+}
+
+func isSoundTrack(mdia []byte) bool {
+	hdlr, ok := mp4Find(mdia, "hdlr")
+	return ok && len(hdlr) >= 12 && string(hdlr[8:12]) == "soun"
+}
+
+// readMP4Moov walks the top-level boxes and loads the moov box body,
+// which may sit at the end of files that weren't written for streaming
+func readMP4Moov(r io.ReaderAt, size int64) ([]byte, error) {
+	for off := int64(0); off+8 <= size; {
+		h, err := readAt(r, off, 16, size)
+		if err != nil {
+			return nil, err
+		}
+
+		boxSize, headerLen, ok := mp4BoxSize(h, size-off)
+		if !ok {
+			return nil, ErrUnsupported
+		}
+
+		if string(h[4:8]) == "moov" {
+			if boxSize-headerLen > maxMoovSize {
+				return nil, ErrUnsupported
+			}
+			return readAt(r, off+headerLen, int(boxSize-headerLen), size)
+		}
+
+		off += boxSize
+	}
+
+	return nil, ErrUnsupported
+}
+
+// mp4BoxSize decodes a box header, handling 64-bit and to-end-of-file sizes
+func mp4BoxSize(h []byte, remaining int64) (size, headerLen int64, ok bool) {
+	if len(h) < 8 {
+		return 0, 0, false
+	}
+
+	size, headerLen = int64(binary.BigEndian.Uint32(h)), 8
+	switch size {
+	case 0:
+		size = remaining
+	case 1:
+		if len(h) < 16 {
+			return 0, 0, false
+		}
+		size, headerLen = int64(binary.BigEndian.Uint64(h[8:])), 16
+	}
+
+	if size < headerLen || size > remaining {
+		return 0, 0, false
+	}
+	return size, headerLen, true
+}
+
+// mp4Children iterates boxes stored back to back in b until fn returns false
+func mp4Children(b []byte, fn func(typ string, body []byte) bool) {
+	for off := 0; off+8 <= len(b); {
+		size, headerLen, ok := mp4BoxSize(b[off:], int64(len(b)-off))
+		if !ok {
+			return
+		}
+		if !fn(string(b[off+4:off+8]), b[off+int(headerLen):off+int(size)]) {
+			return
+		}
+		off += int(size)
+	}
+}
+
+// mp4Find descends through the given box path and returns the innermost body
+func mp4Find(b []byte, path ...string) ([]byte, bool) {
+	for _, typ := range path {
+		var (
+			next  []byte
+			found bool
+		)
+		mp4Children(b, func(t string, body []byte) bool {
+			if t == typ {
+				next, found = body, true
+				return false
+			}
+			return true
+		})
+		if !found {
+			return nil, false
+		}
+		b = next
+	}
+	return b, true
+}
@@ -0,0 +1,230 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrUnsupported is returned when a file can't be parsed as the given format
+var ErrUnsupported = errors.New("audio: unsupported or unrecognized format")
+
+// probeHeaderSize is how much of the file is read when looking for stream headers
+const probeHeaderSize = 64 * 1024
+
+// Info holds stream parameters read from an audio file header
+type Info struct {
+	SampleRate int `json:"sample_rate"`
+	Channels   int `json:"channels"`
+}
+
+// Probe reads stream parameters of a file stored in the given format
+func Probe(r io.ReaderAt, size int64, format string) (*Info, error) {
+	switch format {
+	case "wav":
+		return probeWAV(r, size)
+	case "ogg":
+		return probeOgg(r, size)
+	case "mp3":
+		return probeMP3(r, size)
+	case "webm":
+		return probeWebM(r, size)
+	case "m4a":
+		return probeMP4(r, size)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// BitrateKbps returns the average bitrate of a file of size bytes lasting seconds
+func BitrateKbps(size int64, seconds float64) int {
+	if seconds <= 0 {
+		return 0
+	}
+	return int(float64(size*8) / seconds / 1000)
+}
+
+// readAt reads up to n bytes at off, returning a short slice near the end of the file
+func readAt(r io.ReaderAt, off int64, n int, size int64) ([]byte, error) {
+	if off >= size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if remaining := size - off; int64(n) > remaining {
+		n = int(remaining)
+	}
+
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+func probeWAV(r io.ReaderAt, size int64) (*Info, error) {
+	b, err := readAt(r, 0, probeHeaderSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	fmtChunk, ok := findWAVChunk(b, "fmt ")
+	if !ok || len(fmtChunk) < 16 {
+		return nil, ErrUnsupported
+	}
+
+	return &Info{
+		Channels:   int(binary.LittleEndian.Uint16(fmtChunk[2:])),
+		SampleRate: int(binary.LittleEndian.Uint32(fmtChunk[4:])),
+	}, nil
+}
+
+// findWAVChunk walks RIFF chunks and returns the body of the first chunk with the given id
+func findWAVChunk(b []byte, id string) ([]byte, bool) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		return nil, false
+	}
+
+	for off := 12; off+8 <= len(b); {
+		chunkID := string(b[off : off+4])
+		chunkSize := int(binary.LittleEndian.Uint32(b[off+4:]))
+		body := off + 8
+
+		if chunkID == id {
+			end := min(body+chunkSize, len(b))
+			return b[body:end], true
+		}
+
+		// Chunks are padded to an even size
+		off = body + chunkSize + chunkSize&1
+	}
+
+	return nil, false
+}
+
+func probeOgg(r io.ReaderAt, size int64) (*Info, error) {
+	b, err := readAt(r, 0, probeHeaderSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	packet, ok := firstOggPacket(b)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	switch {
+	case len(packet) >= 19 && string(packet[:8]) == "OpusHead":
+		rate := int(binary.LittleEndian.Uint32(packet[12:]))
+		if rate == 0 {
+			// Opus always decodes at 48kHz, the input rate is informational
+			rate = 48000
+		}
+		return &Info{Channels: int(packet[9]), SampleRate: rate}, nil
+
+	case len(packet) >= 16 && string(packet[:7]) == "\x01vorbis":
+		return &Info{
+			Channels:   int(packet[11]),
+			SampleRate: int(binary.LittleEndian.Uint32(packet[12:])),
+		}, nil
+	}
+
+	return nil, ErrUnsupported
+}
+
+// firstOggPacket returns the payload of the first Ogg page
+func firstOggPacket(b []byte) ([]byte, bool) {
+	if len(b) < 27 || string(b[:4]) != "OggS" {
+		return nil, false
+	}
+
+	segments := int(b[26])
+	headerLen := 27 + segments
+	if len(b) < headerLen {
+		return nil, false
+	}
+
+	payloadLen := 0
+	for _, lacing := range b[27:headerLen] {
+		payloadLen += int(lacing)
+	}
+
+	end := min(headerLen+payloadLen, len(b))
+	return b[headerLen:end], true
+}
+
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG 2.5
+	{},                    // reserved
+	{22050, 24000, 16000}, // MPEG 2
+	{44100, 48000, 32000}, // MPEG 1
+}
+
+func probeMP3(r io.ReaderAt, size int64) (*Info, error) {
+	start, err := id3v2Size(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := readAt(r, start, probeHeaderSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i+4 <= len(b); i++ {
+		if h, ok := parseMP3FrameHeader(b[i:]); ok {
+			return &Info{SampleRate: h.sampleRate, Channels: h.channels}, nil
+		}
+	}
+
+	return nil, ErrUnsupported
+}
+
+type mp3FrameHeader struct {
+	sampleRate int
+	channels   int
+}
+
+func parseMP3FrameHeader(b []byte) (mp3FrameHeader, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3FrameHeader{}, false
+	}
+
+	version := (b[1] >> 3) & 0x03
+	layer := (b[1] >> 1) & 0x03
+	bitrateIndex := b[2] >> 4
+	rateIndex := (b[2] >> 2) & 0x03
+
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 0x0F || rateIndex == 3 {
+		return mp3FrameHeader{}, false
+	}
+
+	channels := 2
+	if b[3]>>6 == 3 {
+		channels = 1
+	}
+
+	return mp3FrameHeader{
+		sampleRate: mp3SampleRates[version][rateIndex],
+		channels:   channels,
+	}, true
+}
+
+// id3v2Size returns the length of a leading ID3v2 tag, or 0 if there is none
+func id3v2Size(r io.ReaderAt, size int64) (int64, error) {
+	b, err := readAt(r, 0, 10, size)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) < 10 || string(b[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	// Tag size is a 28-bit syncsafe integer
+	tagSize := int64(b[6])<<21 | int64(b[7])<<14 | int64(b[8])<<7 | int64(b[9])
+	total := 10 + tagSize
+	if b[5]&0x10 != 0 {
+		total += 10 // footer present
+	}
+
+	return total, nil
+}
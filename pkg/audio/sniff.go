@@ -0,0 +1,35 @@
+package audio
+
+import "bytes"
+
+// SniffHeaderSize is how many leading bytes SniffFormat needs to see
+const SniffHeaderSize = 512
+
+// SniffFormat identifies an audio container from the leading bytes of a file
+// and returns its format name, or "" if the bytes don't look like audio we support
+func SniffFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "ogg"
+
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// EBML header, WebM is a Matroska subset
+		return "webm"
+
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return "m4a"
+
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return "wav"
+
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return "mp3"
+	}
+
+	// Raw MPEG audio without an ID3 tag starts with a frame sync
+	if _, ok := parseMP3FrameHeader(data); ok {
+		return "mp3"
+	}
+
+	return ""
+}
@@ -0,0 +1,175 @@
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// EBML element IDs used by WebM/Matroska
+const (
+	ebmlIDHeader            = 0x1A45DFA3
+	ebmlIDSegment           = 0x18538067
+	ebmlIDTracks            = 0x1654AE6B
+	ebmlIDTrackEntry        = 0xAE
+	ebmlIDAudio             = 0xE1
+	ebmlIDSamplingFrequency = 0xB5
+	ebmlIDChannels          = 0x9F
+	ebmlIDCluster           = 0x1F43B675
+)
+
+func probeWebM(r io.ReaderAt, size int64) (*Info, error) {
+	b, err := readAt(r, 0, probeHeaderSize, size)
+	if err != nil {
+		return nil, err
+	}
+
+	segment, ok := webmSegment(b)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	var info *Info
+	ebmlChildren(segment, func(id uint64, data []byte) bool {
+		if id == ebmlIDTracks {
+			info = parseWebMTracks(data)
+			return false
+		}
+		// Tracks always precede the first cluster
+		return id != ebmlIDCluster
+	})
+
+	if info == nil {
+		return nil, ErrUnsupported
+	}
+	return info, nil
+}
+
+// webmSegment skips the EBML header and returns the body of the Segment element
+func webmSegment(b []byte) ([]byte, bool) {
+	var (
+		segment []byte
+		found   bool
+		index   int
+	)
+
+	ebmlChildren(b, func(id uint64, data []byte) bool {
+		switch {
+		case index == 0 && id != ebmlIDHeader:
+			return false
+		case id == ebmlIDSegment:
+			segment, found = data, true
+			return false
+		}
+		index++
+		return true
+	})
+
+	return segment, found
+}
+
+func parseWebMTracks(tracks []byte) *Info {
+	var info *Info
+
+	ebmlChildren(tracks, func(id uint64, entry []byte) bool {
+		if id != ebmlIDTrackEntry {
+			return true
+		}
+		ebmlChildren(entry, func(id uint64, audio []byte) bool {
+			if id != ebmlIDAudio {
+				return true
+			}
+			// Matroska defaults: 8kHz mono when the elements are absent
+			info = &Info{SampleRate: 8000, Channels: 1}
+			ebmlChildren(audio, func(id uint64, data []byte) bool {
+				switch id {
+				case ebmlIDSamplingFrequency:
+					info.SampleRate = int(ebmlFloat(data))
+				case ebmlIDChannels:
+					info.Channels = int(ebmlUint(data))
+				}
+				return true
+			})
+			return false
+		})
+		return info == nil
+	})
+
+	return info
+}
+
+// ebmlChildren iterates the elements stored back to back in b and calls fn
+// for each one until it returns false. Elements of unknown size, or whose size
+// runs past the buffer, extend to the end of b
+func ebmlChildren(b []byte, fn func(id uint64, data []byte) bool) {
+	for off := 0; off < len(b); {
+		id, idLen, _, ok := readVint(b[off:], true)
+		if !ok {
+			return
+		}
+
+		size, sizeLen, unknown, ok := readVint(b[off+idLen:], false)
+		if !ok {
+			return
+		}
+
+		start := off + idLen + sizeLen
+		end := len(b)
+		if !unknown && size <= uint64(len(b)-start) {
+			end = start + int(size)
+		}
+
+		if !fn(id, b[start:end]) {
+			return
+		}
+		off = end
+	}
+}
+
+// readVint decodes an EBML variable-length integer. Element IDs keep their
+// length marker, sizes have it stripped. unknown reports the reserved all-ones size
+func readVint(b []byte, keepMarker bool) (value uint64, length int, unknown bool, ok bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false, false
+	}
+
+	length = bits.LeadingZeros8(b[0]) + 1
+	if len(b) < length {
+		return 0, 0, false, false
+	}
+
+	if keepMarker {
+		value = uint64(b[0])
+	} else {
+		value = uint64(b[0] & (0xFF >> length))
+	}
+	for _, c := range b[1:length] {
+		value = value<<8 | uint64(c)
+	}
+
+	if !keepMarker {
+		unknown = value == 1<<(7*length)-1
+	}
+
+	return value, length, unknown, true
+}
+
+func ebmlUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func ebmlFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	default:
+		return 0
+	}
+}
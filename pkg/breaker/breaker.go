@@ -0,0 +1,139 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Do when the breaker is rejecting calls
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// Closed lets every call through and counts consecutive failures
+	Closed State = iota
+	// Open rejects calls until the cooldown has passed
+	Open
+	// HalfOpen lets a single trial call through to probe the dependency
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker tracks the health of an external dependency (STT, transcoder, ...)
+// so callers can skip it during an outage instead of retrying in a tight loop
+type Breaker struct {
+	mu sync.Mutex
+
+	failureThreshold int
+	cooldown         time.Duration
+
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// New creates a breaker that opens after failureThreshold consecutive
+// failures and allows a trial call once cooldown has elapsed
+func New(failureThreshold int, cooldown time.Duration) *Breaker {
+	if failureThreshold <= 0 {
+		failureThreshold = 5
+	}
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &Breaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+	}
+}
+
+// Allow reports whether a call may be made right now
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = HalfOpen
+		b.trial = true
+		return true
+	case HalfOpen:
+		// Only one trial call at a time
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success records a successful call and closes the breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = Closed
+	b.failures = 0
+	b.trial = false
+}
+
+// Failure records a failed call, opening the breaker when the threshold is hit
+// or when the half-open trial fails
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	b.failures++
+
+	if b.state == HalfOpen || b.failures >= b.failureThreshold {
+		b.state = Open
+		b.openedAt = time.Now()
+	}
+}
+
+// Do runs fn if the breaker allows it and records the outcome
+func (b *Breaker) Do(fn func() error) error {
+	if !b.Allow() {
+		return ErrOpen
+	}
+
+	if err := fn(); err != nil {
+		b.Failure()
+		return err
+	}
+
+	b.Success()
+	return nil
+}
+
+// State returns the current breaker state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
@@ -1,7 +1,10 @@
 package httputil
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 )
 
 // APIError represents an error that can be sent to clients
@@ -10,6 +13,8 @@ type HTTPError struct {
 	Message string // User-facing message
 	Cause   error  // Optional wrapped internal error (for logging)
 	Details any    // Optional extra context (e.g. validation errors)
+
+	RetryAfter time.Duration // Sent as Retry-After header when set
 }
 
 // Error implements the error interface
@@ -55,6 +60,51 @@ func Forbidden(msg string) error {
 	return &HTTPError{Status: http.StatusForbidden, Message: msg}
 }
 
+// Error with 409 status code
+func Conflict(msg string) error {
+	return &HTTPError{Status: http.StatusConflict, Message: msg}
+}
+
+// Error with 413 status code, for request bodies over the accepted size
+func PayloadTooLarge(msg string, details ...any) error {
+	return &HTTPError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: msg,
+		Details: singleOrSlice(details),
+	}
+}
+
+// TooLarge turns the error http.MaxBytesReader returns once the body passes
+// its limit into a 413 naming the limit, and returns nil for any other error
+func TooLarge(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return PayloadTooLarge(
+		fmt.Sprintf("Request body too large (max %d bytes)", maxBytesErr.Limit),
+		map[string]int64{"max_bytes": maxBytesErr.Limit},
+	)
+}
+
+// Error with 429 status code, retryAfter tells the client when to try again
+func TooManyRequests(msg string, retryAfter time.Duration) error {
+	return &HTTPError{
+		Status:     http.StatusTooManyRequests,
+		Message:    msg,
+		RetryAfter: retryAfter,
+	}
+}
+
+// Error with 504 status code, used when the request deadline passes
+func GatewayTimeout(err error) error {
+	return &HTTPError{
+		Status:  http.StatusGatewayTimeout,
+		Message: "Request timed out",
+		Cause:   err,
+	}
+}
+
 // tiny helper so you can pass one detail or many
 func singleOrSlice(v []any) any {
 	switch len(v) {
@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
+	"github.com/rx3lixir/laba_zis/pkg/logger"
 )
 
 // HandlerFunc is a custom handler that can return errors
@@ -39,6 +42,15 @@ func RespondError(w http.ResponseWriter, r *http.Request, err error, log *slog.L
 		}
 	}
 
+	// A server error caused by the request deadline is reported as a timeout
+	if httpErr.Status >= 500 && errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		httpErr = GatewayTimeout(err).(*HTTPError)
+	}
+
+	// The request logger already carries request_id and user_id, log is only
+	// used outside the router's middleware
+	log = logger.FromContextOr(r.Context(), log.With("request_id", reqID))
+
 	// Logging based on severity
 	if httpErr.Status >= 500 {
 		log.Error(
@@ -46,7 +58,6 @@ func RespondError(w http.ResponseWriter, r *http.Request, err error, log *slog.L
 			"error", err,
 			"status", httpErr.Status,
 			"path", r.URL.Path,
-			"request_id", reqID,
 		)
 	} else {
 		log.Warn(
@@ -54,11 +65,15 @@ func RespondError(w http.ResponseWriter, r *http.Request, err error, log *slog.L
 			"error", err,
 			"status", httpErr.Status,
 			"path", r.URL.Path,
-			"request_id", reqID,
 		)
 	}
 
 	// Send response
+	if httpErr.RetryAfter > 0 {
+		// Round up so clients never retry too early
+		seconds := int(math.Ceil(httpErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpErr.Status)
 
@@ -91,6 +106,9 @@ func DecodeJSON(r *http.Request, target any) error {
 	decoder.DisallowUnknownFields()
 
 	if err := decoder.Decode(target); err != nil {
+		if tooLarge := TooLarge(err); tooLarge != nil {
+			return tooLarge
+		}
 		return BadRequest("Invalid JSON format", map[string]string{
 			"parse_error": err.Error(),
 		})
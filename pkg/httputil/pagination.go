@@ -0,0 +1,41 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// MaxPageLimit is the largest page size any list endpoint accepts
+const MaxPageLimit = 100
+
+// Pagination holds the effective limit and offset of a list request
+type Pagination struct {
+	Limit  int
+	Offset int
+}
+
+// ParsePagination reads limit and offset query params.
+// Malformed or out-of-range values are rejected with a 400 instead of being
+// silently clamped, so clients always get exactly the page size they asked for
+func ParsePagination(r *http.Request, defaultLimit int) (Pagination, error) {
+	p := Pagination{Limit: defaultLimit}
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return p, BadRequest(fmt.Sprintf("limit must be an integer between 1 and %d", MaxPageLimit))
+		}
+		p.Limit = limit
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return p, BadRequest("offset must be a non-negative integer")
+		}
+		p.Offset = offset
+	}
+
+	return p, nil
+}
@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+type contextKey struct{}
+
+// WithContext stores l in ctx for FromContext
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the request-scoped logger, or the default logger
+// when ctx doesn't carry one
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// FromContextOr is FromContext with fallback in place of the default logger
+func FromContextOr(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return fallback
+}
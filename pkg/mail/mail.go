@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogMailer writes emails to the log instead of sending them (dev/test)
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) *LogMailer {
+	return &LogMailer{log: log}
+}
+
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.log.Info("email not sent, no SMTP server configured",
+		"to", to,
+		"subject", subject,
+		"body", body)
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP server using PLAIN auth
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: net.JoinHostPort(host, fmt.Sprint(port)),
+		from: from,
+		auth: auth,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid email header value")
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	// net/smtp has no context support, so only bail out if we're already cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Notification is a push message shown on the user's devices
+type Notification struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Notifier delivers push notifications to device tokens
+type Notifier interface {
+	Send(ctx context.Context, tokens []string, n Notification) error
+}
+
+// NopNotifier drops notifications, used when no push provider is configured
+type NopNotifier struct {
+	log *slog.Logger
+}
+
+func NewNopNotifier(log *slog.Logger) *NopNotifier {
+	return &NopNotifier{log: log}
+}
+
+func (n *NopNotifier) Send(ctx context.Context, tokens []string, notification Notification) error {
+	n.log.Debug("push notification not sent, no provider configured",
+		"devices", len(tokens),
+		"title", notification.Title)
+	return nil
+}
+
+// HTTPNotifier posts notifications to an FCM-style HTTP endpoint
+type HTTPNotifier struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+func NewHTTPNotifier(endpoint, apiKey string) *HTTPNotifier {
+	return &HTTPNotifier{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type httpPayload struct {
+	RegistrationIDs []string          `json:"registration_ids"`
+	Notification    Notification      `json:"notification"`
+	Data            map[string]string `json:"data,omitempty"`
+}
+
+func (n *HTTPNotifier) Send(ctx context.Context, tokens []string, notification Notification) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(httpPayload{
+		RegistrationIDs: tokens,
+		Notification:    notification,
+		Data:            notification.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal push notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.apiKey != "" {
+		req.Header.Set("Authorization", "key="+n.apiKey)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("push provider returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
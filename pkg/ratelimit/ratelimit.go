@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rx3lixir/laba_zis/pkg/httputil"
+)
+
+// Rate is a token bucket refilled at PerSecond tokens per second holding at most Burst tokens
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Limiter decides whether a request identified by key may proceed.
+// When it may not, retryAfter tells how long until it would be allowed
+type Limiter interface {
+	Allow(ctx context.Context, key string) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// KeyFunc extracts the limiting key from a request, "" skips limiting
+type KeyFunc func(r *http.Request) string
+
+// Middleware rejects requests over the limit with 429 and Retry-After.
+// If the limiter itself fails the request is let through
+func Middleware(l Limiter, key KeyFunc, log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, retryAfter, err := l.Allow(r.Context(), k)
+			if err != nil {
+				log.Error("rate limiter failed, allowing request", "key", k, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !allowed {
+				httputil.RespondError(w, r, httputil.TooManyRequests("Too many requests", retryAfter), log)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// idleAfter is how long a full bucket is kept before being forgotten
+const idleAfter = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryLimiter keeps token buckets in process memory, fine for a single instance
+type MemoryLimiter struct {
+	rate Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+var _ Limiter = (*MemoryLimiter)(nil)
+
+func NewMemoryLimiter(rate Rate) *MemoryLimiter {
+	return &MemoryLimiter{
+		rate:      rate,
+		buckets:   make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(m.rate.Burst), last: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = min(float64(m.rate.Burst), b.tokens+now.Sub(b.last).Seconds()*m.rate.PerSecond)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	if m.rate.PerSecond <= 0 {
+		return false, time.Hour, nil
+	}
+	wait := time.Duration((1 - b.tokens) / m.rate.PerSecond * float64(time.Second))
+	return false, wait, nil
+}
+
+// prune drops buckets idle long enough to be full again. Callers hold m.mu
+func (m *MemoryLimiter) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < idleAfter {
+		return
+	}
+	m.lastPrune = now
+
+	for key, b := range m.buckets {
+		if now.Sub(b.last) > idleAfter {
+			delete(m.buckets, key)
+		}
+	}
+}